@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	alertNotifiersEnvName      = "ALERT_NOTIFIERS"
+	alertNotifierTypeWebhook   = "webhook"
+	alertNotifierTypeSlack     = "slack"
+	alertNotifierTypePagerDuty = "pagerduty"
+	defaultPagerDutyEventsURL  = "https://events.pagerduty.com/v2/enqueue"
+	alertNotifierTimeout       = 10 * time.Second
+	alertNotifierMaxBodyBytes  = 1 << 10
+)
+
+// alertNotifier sends the firing and resolved notifications of the alert rules
+type alertNotifier interface {
+	name() string
+	notify(ctx context.Context, notification *alertNotification) error
+}
+
+// rawAlertNotifier is an ALERT_NOTIFIERS entry
+type rawAlertNotifier struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	URL        string `json:"url"`
+	RoutingKey string `json:"routing_key"`
+}
+
+// webhookNotifier posts the notification as is, for any endpoint that takes JSON
+type webhookNotifier struct {
+	notifierName string
+	url          string
+	client       *http.Client
+}
+
+// slackNotifier posts a text message, which Slack incoming webhooks and compatible endpoints (Mattermost, Teams connectors) take
+type slackNotifier struct {
+	notifierName string
+	url          string
+	client       *http.Client
+}
+
+// pagerDutyNotifier sends PagerDuty Events API v2 events, which trigger and resolve an incident per rule and address
+type pagerDutyNotifier struct {
+	notifierName string
+	url          string
+	routingKey   string
+	client       *http.Client
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string             `json:"summary"`
+	Source        string             `json:"source"`
+	Severity      string             `json:"severity"`
+	CustomDetails *alertNotification `json:"custom_details"`
+}
+
+func getAlertNotifiers(envValue string) (map[string]alertNotifier, error) {
+	notifiers := make(map[string]alertNotifier)
+	if envValue == "" {
+		return notifiers, nil
+	}
+
+	rawNotifiers := make([]*rawAlertNotifier, 0)
+	if err := json.Unmarshal([]byte(envValue), &rawNotifiers); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON array of notifiers: %v", alertNotifiersEnvName, err)
+	}
+
+	client := &http.Client{Timeout: alertNotifierTimeout}
+
+	for _, rawNotifier := range rawNotifiers {
+		if rawNotifier.Name == "" {
+			return nil, fmt.Errorf("%s contains a notifier without a name", alertNotifiersEnvName)
+		}
+
+		if _, ok := notifiers[rawNotifier.Name]; ok {
+			return nil, fmt.Errorf("%s contains more than one notifier named %s", alertNotifiersEnvName, rawNotifier.Name)
+		}
+
+		if rawNotifier.URL == "" && rawNotifier.Type != alertNotifierTypePagerDuty {
+			return nil, fmt.Errorf("%s notifier %s must have a url", alertNotifiersEnvName, rawNotifier.Name)
+		}
+
+		switch rawNotifier.Type {
+		case alertNotifierTypeWebhook:
+			notifiers[rawNotifier.Name] = &webhookNotifier{notifierName: rawNotifier.Name, url: rawNotifier.URL, client: client}
+		case alertNotifierTypeSlack:
+			notifiers[rawNotifier.Name] = &slackNotifier{notifierName: rawNotifier.Name, url: rawNotifier.URL, client: client}
+		case alertNotifierTypePagerDuty:
+			if rawNotifier.RoutingKey == "" {
+				return nil, fmt.Errorf("%s notifier %s must have a routing_key", alertNotifiersEnvName, rawNotifier.Name)
+			}
+
+			eventsURL := rawNotifier.URL
+			if eventsURL == "" {
+				eventsURL = defaultPagerDutyEventsURL
+			}
+
+			notifiers[rawNotifier.Name] = &pagerDutyNotifier{notifierName: rawNotifier.Name, url: eventsURL, routingKey: rawNotifier.RoutingKey, client: client}
+		default:
+			return nil, fmt.Errorf("%s notifier %s has an unknown type: %s", alertNotifiersEnvName, rawNotifier.Name, rawNotifier.Type)
+		}
+	}
+
+	return notifiers, nil
+}
+
+func (wn *webhookNotifier) name() string {
+	return wn.notifierName
+}
+
+func (wn *webhookNotifier) notify(ctx context.Context, notification *alertNotification) error {
+	return postAlertJSON(ctx, wn.client, wn.url, notification)
+}
+
+func (sn *slackNotifier) name() string {
+	return sn.notifierName
+}
+
+func (sn *slackNotifier) notify(ctx context.Context, notification *alertNotification) error {
+	return postAlertJSON(ctx, sn.client, sn.url, &slackMessage{Text: notification.getSummary()})
+}
+
+func (pdn *pagerDutyNotifier) name() string {
+	return pdn.notifierName
+}
+
+func (pdn *pagerDutyNotifier) notify(ctx context.Context, notification *alertNotification) error {
+	event := &pagerDutyEvent{
+		RoutingKey:  pdn.routingKey,
+		EventAction: "trigger",
+		DedupKey:    notification.getKey(),
+	}
+
+	if notification.Status == alertStatusResolved {
+		event.EventAction = "resolve"
+	} else {
+		event.Payload = &pagerDutyPayload{
+			Summary:       notification.getSummary(),
+			Source:        notification.Address,
+			Severity:      notification.Severity,
+			CustomDetails: notification,
+		}
+	}
+
+	return postAlertJSON(ctx, pdn.client, pdn.url, event)
+}
+
+func postAlertJSON(ctx context.Context, client *http.Client, notifierURL string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshaling notification: %v", err)
+	}
+
+	// Webhook and Slack URLs are secrets, so they are left out of the errors
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, notifierURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating notification request: %v", stripURLError(err))
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %w", stripURLError(err))
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, alertNotifierMaxBodyBytes))
+		return &httpStatusError{backend: "notifier", statusCode: response.StatusCode, status: response.Status, body: string(responseBody)}
+	}
+
+	return nil
+}
+
+// stripURLError returns the error a *url.Error wraps, without the request URL
+func stripURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
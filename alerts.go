@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	alertRulesEnvName        = "ALERT_RULES"
+	alertStateKey            = "alerts"
+	alertMetricLossRatio     = "loss_ratio"
+	alertMetricRttAvg        = "rtt_avg"
+	alertMetricRttMax        = "rtt_max"
+	alertMetricRttP50        = "rtt_p50"
+	alertMetricRttP90        = "rtt_p90"
+	alertMetricRttP99        = "rtt_p99"
+	alertMetricTLSExpiryDays = "tls_expiry_days"
+	alertStatusFiring        = "firing"
+	alertStatusResolved      = "resolved"
+	defaultAlertSeverity     = "warning"
+	tlsExpiryCheckTimeout    = 10 * time.Second
+)
+
+var (
+	alertMetrics    = []string{alertMetricLossRatio, alertMetricRttAvg, alertMetricRttMax, alertMetricRttP50, alertMetricRttP90, alertMetricRttP99, alertMetricTLSExpiryDays}
+	alertOperators  = []string{">", ">=", "<", "<="}
+	alertSeverities = []string{"critical", "error", "warning", "info"}
+)
+
+// alertRule fires for each selected target whose metric compares to the threshold with the operator
+type alertRule struct {
+	Name      string          `json:"name"`
+	Selector  *targetSelector `json:"selector"`
+	Metric    string          `json:"metric"`
+	Operator  string          `json:"operator"`
+	Threshold float64         `json:"threshold"`
+	Severity  string          `json:"severity"`
+	Notifiers []string        `json:"notifiers"`
+}
+
+// alertState is the last notified state of a rule for a target, and since when it is in that state
+type alertState struct {
+	Firing     bool      `json:"firing"`
+	Since      time.Time `json:"since"`
+	NotifiedAt time.Time `json:"notified_at"`
+}
+
+// alertNotification is sent when a rule starts or stops firing for a target
+type alertNotification struct {
+	Status    string            `json:"status"`
+	Rule      string            `json:"rule"`
+	Address   string            `json:"address"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Metric    string            `json:"metric"`
+	Operator  string            `json:"operator"`
+	Threshold float64           `json:"threshold"`
+	Value     float64           `json:"value"`
+	Severity  string            `json:"severity"`
+	StartedAt time.Time         `json:"started_at"`
+	RunID     string            `json:"run_id,omitempty"`
+}
+
+// alertTransition is a rule that started or stopped firing for a target
+type alertTransition struct {
+	key          string
+	rule         *alertRule
+	firing       bool
+	changedAt    time.Time
+	notification *alertNotification
+}
+
+// alertEvaluator evaluates the alert rules after each run, and notifies only when a rule starts or stops
+// firing for a target, by keeping the last notified states in the state store
+type alertEvaluator struct {
+	rules            []*alertRule
+	notifiers        map[string]alertNotifier
+	store            stateStore
+	lock             sync.Mutex
+	tlsExpiryChecker func(ctx context.Context, address string) (time.Time, error)
+}
+
+// newAlertEvaluator returns the evaluator of ALERT_RULES, or nil if there are no rules
+func newAlertEvaluator(rulesEnvValue string, notifiersEnvValue string, addresses []string) (*alertEvaluator, error) {
+	if rulesEnvValue == "" {
+		return nil, nil
+	}
+
+	rules, err := getAlertRules(rulesEnvValue, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	notifiers, err := getAlertNotifiers(notifiersEnvValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(notifiers) == 0 {
+		return nil, fmt.Errorf("%s must not be empty when %s is set", alertNotifiersEnvName, alertRulesEnvName)
+	}
+
+	for _, rule := range rules {
+		for _, notifierName := range rule.Notifiers {
+			if _, ok := notifiers[notifierName]; !ok {
+				return nil, fmt.Errorf("%s rule %s has a notifier that is not in %s: %s", alertRulesEnvName, rule.Name, alertNotifiersEnvName, notifierName)
+			}
+		}
+	}
+
+	store, err := newStateStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return &alertEvaluator{
+		rules:            rules,
+		notifiers:        notifiers,
+		store:            store,
+		tlsExpiryChecker: getTLSExpiry,
+	}, nil
+}
+
+func getAlertRules(envValue string, addresses []string) ([]*alertRule, error) {
+	rules := make([]*alertRule, 0)
+	if err := json.Unmarshal([]byte(envValue), &rules); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON array of rules: %v", alertRulesEnvName, err)
+	}
+
+	ruleNames := make([]string, 0, len(rules))
+
+	for _, rule := range rules {
+		if !stateKeyRegexp.MatchString(rule.Name) {
+			return nil, fmt.Errorf("%s rule names must contain only letters, digits, hyphens and underscores: %s", alertRulesEnvName, rule.Name)
+		}
+
+		if containsString(ruleNames, rule.Name) {
+			return nil, fmt.Errorf("%s contains more than one rule named %s", alertRulesEnvName, rule.Name)
+		}
+
+		ruleNames = append(ruleNames, rule.Name)
+
+		if !containsString(alertMetrics, rule.Metric) {
+			return nil, fmt.Errorf("%s rule %s has an unknown metric: %s (supported: %s)", alertRulesEnvName, rule.Name, rule.Metric, strings.Join(alertMetrics, ", "))
+		}
+
+		if !containsString(alertOperators, rule.Operator) {
+			return nil, fmt.Errorf("%s rule %s has an unknown operator: %s", alertRulesEnvName, rule.Name, rule.Operator)
+		}
+
+		if rule.Severity == "" {
+			rule.Severity = defaultAlertSeverity
+		}
+
+		if !containsString(alertSeverities, rule.Severity) {
+			return nil, fmt.Errorf("%s rule %s has an unknown severity: %s", alertRulesEnvName, rule.Name, rule.Severity)
+		}
+
+		if rule.Selector != nil {
+			if err := rule.Selector.normalize(addresses); err != nil {
+				return nil, fmt.Errorf("%s rule %s selector: %v", alertRulesEnvName, rule.Name, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// evaluate checks the rules against the results and sends the notifications of the rules that started or stopped
+// firing. A state is saved only once all of its notifiers succeeded, so a failed notification is sent again on the next run.
+func (ae *alertEvaluator) evaluate(ctx context.Context, pingsStats []*pingStatistics) {
+	transitions := ae.getTransitions(ctx, pingsStats)
+
+	// The notifications are sent without the lock, so a slow notifier doesn't hold up the cycles of the other targets
+	notified := make([]*alertTransition, 0, len(transitions))
+	for _, transition := range transitions {
+		if ae.notify(ctx, transition.rule, transition.notification) {
+			notified = append(notified, transition)
+		}
+	}
+
+	if len(notified) > 0 {
+		ae.saveTransitions(ctx, notified)
+	}
+}
+
+// getTransitions returns the rules that started or stopped firing for the targets
+func (ae *alertEvaluator) getTransitions(ctx context.Context, pingsStats []*pingStatistics) []*alertTransition {
+	// The values are computed before taking the lock, since a TLS handshake can take seconds
+	evaluations := make([]*alertTransition, 0)
+
+	for _, rule := range ae.rules {
+		for _, pingStats := range pingsStats {
+			// Alerts neither fire nor resolve during maintenance
+			if pingStats.maintenance || !rule.Selector.matches(pingStats.address, pingStats.labels) {
+				continue
+			}
+
+			value, ok := ae.getMetricValue(ctx, rule.Metric, pingStats)
+			if !ok {
+				continue
+			}
+
+			now := time.Now().UTC()
+			evaluations = append(evaluations, &alertTransition{
+				key:       rule.Name + "/" + pingStats.address,
+				rule:      rule,
+				firing:    compareAlertValue(value, rule.Operator, rule.Threshold),
+				changedAt: now,
+				notification: &alertNotification{
+					Status:    alertStatusFiring,
+					Rule:      rule.Name,
+					Address:   pingStats.address,
+					Labels:    pingStats.labels,
+					Metric:    rule.Metric,
+					Operator:  rule.Operator,
+					Threshold: rule.Threshold,
+					Value:     value,
+					Severity:  rule.Severity,
+					StartedAt: now,
+					RunID:     pingStats.runID,
+				},
+			})
+		}
+	}
+
+	if len(evaluations) == 0 {
+		return nil
+	}
+
+	ae.lock.Lock()
+	states := ae.loadStates(ctx)
+	ae.lock.Unlock()
+
+	transitions := make([]*alertTransition, 0)
+
+	for _, evaluation := range evaluations {
+		state, ok := states[evaluation.key]
+		if !ok {
+			state = &alertState{}
+		}
+
+		if evaluation.firing == state.Firing {
+			continue
+		}
+
+		if !evaluation.firing {
+			evaluation.notification.Status = alertStatusResolved
+			evaluation.notification.StartedAt = state.Since
+		}
+
+		transitions = append(transitions, evaluation)
+	}
+
+	return transitions
+}
+
+// saveTransitions saves the states of the notified transitions. The states are loaded again, since the daemon
+// evaluates each target as its probes are done, and other targets may have saved theirs in the meantime.
+func (ae *alertEvaluator) saveTransitions(ctx context.Context, transitions []*alertTransition) {
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	states := ae.loadStates(ctx)
+	for _, transition := range transitions {
+		states[transition.key] = &alertState{Firing: transition.firing, Since: transition.changedAt, NotifiedAt: time.Now().UTC()}
+	}
+
+	if err := ae.store.save(ctx, alertStateKey, states); err != nil {
+		errorLogger.Println("Error saving the alert states:", err)
+	}
+}
+
+// loadStates returns the stored states. The caller holds the lock.
+func (ae *alertEvaluator) loadStates(ctx context.Context) map[string]*alertState {
+	states := make(map[string]*alertState)
+	if _, err := ae.store.load(ctx, alertStateKey, &states); err != nil {
+		errorLogger.Println("Error loading the alert states, starting over:", err)
+	}
+
+	return states
+}
+
+// notify sends the notification to the notifiers of the rule, or to all of them if the rule has none,
+// and returns whether all of them succeeded
+func (ae *alertEvaluator) notify(ctx context.Context, rule *alertRule, notification *alertNotification) bool {
+	notifierNames := rule.Notifiers
+	if len(notifierNames) == 0 {
+		for notifierName := range ae.notifiers {
+			notifierNames = append(notifierNames, notifierName)
+		}
+
+		sort.Strings(notifierNames)
+	}
+
+	infoLogger.Println("Alert", notification.getSummary())
+
+	success := true
+
+	for _, notifierName := range notifierNames {
+		if err := ae.notifiers[notifierName].notify(ctx, notification); err != nil {
+			errorLogger.Println("Error sending alert notification with", notifierName, "notifier:", err)
+			success = false
+		}
+	}
+
+	return success
+}
+
+// getMetricValue returns the value of the metric for the target, and false if it has none in this run
+func (ae *alertEvaluator) getMetricValue(ctx context.Context, metric string, pingStats *pingStatistics) (float64, bool) {
+	switch metric {
+	case alertMetricLossRatio:
+		if pingStats.probesSent == 0 {
+			return 0, false
+		}
+
+		return float64(pingStats.probesFailed) / float64(pingStats.probesSent), true
+	case alertMetricTLSExpiryDays:
+		notAfter, err := ae.tlsExpiryChecker(ctx, pingStats.address)
+		if err != nil {
+			errorLogger.Println("Error getting the TLS certificate expiry of", pingStats.address, ":", err)
+			return 0, false
+		}
+
+		return time.Until(notAfter).Hours() / 24, true
+	}
+
+	rttStats := getRttStatistics(pingStats.rtts)
+	if rttStats == nil {
+		return 0, false
+	}
+
+	switch metric {
+	case alertMetricRttAvg:
+		return rttStats.avg, true
+	case alertMetricRttMax:
+		return rttStats.max, true
+	case alertMetricRttP50:
+		return getRttPercentile(pingStats.rtts, 50), true
+	case alertMetricRttP90:
+		return getRttPercentile(pingStats.rtts, 90), true
+	default:
+		return getRttPercentile(pingStats.rtts, 99), true
+	}
+}
+
+// getRttPercentile returns the nearest-rank percentile of the rtts
+func getRttPercentile(rtts []float64, percentile float64) float64 {
+	sortedRtts := append([]float64{}, rtts...)
+	sort.Float64s(sortedRtts)
+
+	rank := int(math.Ceil(percentile / 100 * float64(len(sortedRtts))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sortedRtts[rank-1]
+}
+
+func compareAlertValue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	default:
+		return value <= threshold
+	}
+}
+
+// getTLSExpiry returns when the certificate the address serves expires. The probes only open TCP connections,
+// so the certificate is read with a handshake of its own.
+func getTLSExpiry(ctx context.Context, address string) (time.Time, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tlsExpiryCheckTimeout)
+	defer cancel()
+
+	// The certificate is only read, and an invalid one must still report its expiry
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, InsecureSkipVerify: true}} // #nosec G402
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return time.Time{}, fmt.Errorf("no certificate was served")
+	}
+
+	return certificates[0].NotAfter, nil
+}
+
+func (an *alertNotification) getKey() string {
+	return an.Rule + "/" + an.Address
+}
+
+func (an *alertNotification) getSummary() string {
+	return fmt.Sprintf("[%s] %s on %s: %s is %s (threshold %s %s)", strings.ToUpper(an.Status), an.Rule, an.Address,
+		an.Metric, formatAlertValue(an.Value), an.Operator, formatAlertValue(an.Threshold))
+}
+
+func formatAlertValue(value float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", value), "0"), ".")
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notificationRecorder is an endpoint that records the bodies it receives, and fails while failing is set
+type notificationRecorder struct {
+	lock    sync.Mutex
+	bodies  []map[string]interface{}
+	failing bool
+}
+
+func (nr *notificationRecorder) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+
+	if nr.failing {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := make(map[string]interface{})
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	nr.bodies = append(nr.bodies, body)
+}
+
+func (nr *notificationRecorder) getBodies() []map[string]interface{} {
+	nr.lock.Lock()
+	defer nr.lock.Unlock()
+
+	return append([]map[string]interface{}{}, nr.bodies...)
+}
+
+func newTestAlertEvaluator(t *testing.T, stateDir string, rules string, notifiers string) *alertEvaluator {
+	err := os.Setenv(stateDirEnvName, stateDir)
+	require.NoError(t, err)
+
+	defer os.Clearenv()
+
+	alerts, err := newAlertEvaluator(rules, notifiers, []string{"www.google.com:80", "listener.logz.io:8053"})
+	require.NoError(t, err)
+	require.NotNil(t, alerts)
+
+	return alerts
+}
+
+func TestNewAlertEvaluator_NoRules(t *testing.T) {
+	alerts, err := newAlertEvaluator("", "", nil)
+	require.NoError(t, err)
+	assert.Nil(t, alerts)
+}
+
+func TestNewAlertEvaluator_Invalid(t *testing.T) {
+	err := os.Setenv(stateDirEnvName, t.TempDir())
+	require.NoError(t, err)
+
+	defer os.Clearenv()
+
+	addresses := []string{"www.google.com:80"}
+	notifiers := `[{"name": "ops", "type": "webhook", "url": "http://localhost"}]`
+
+	invalidRules := []string{
+		`{"name": "loss"}`,
+		`[{"name": "loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2}, {"name": "loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.5}]`,
+		`[{"name": "high loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2}]`,
+		`[{"name": "loss", "metric": "jitter", "operator": ">", "threshold": 0.2}]`,
+		`[{"name": "loss", "metric": "loss_ratio", "operator": "!=", "threshold": 0.2}]`,
+		`[{"name": "loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2, "severity": "fatal"}]`,
+		`[{"name": "loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2, "selector": {"addresses": ["www.example.com"]}}]`,
+		`[{"name": "loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2, "notifiers": ["pager"]}]`,
+	}
+
+	for _, invalidRule := range invalidRules {
+		_, err = newAlertEvaluator(invalidRule, notifiers, addresses)
+		assert.Error(t, err, invalidRule)
+	}
+
+	rules := `[{"name": "loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2}]`
+	invalidNotifiers := []string{
+		``,
+		`[{"name": "ops", "type": "email", "url": "http://localhost"}]`,
+		`[{"name": "ops", "type": "webhook"}]`,
+		`[{"name": "pager", "type": "pagerduty"}]`,
+		`[{"type": "slack", "url": "http://localhost"}]`,
+	}
+
+	for _, invalidNotifier := range invalidNotifiers {
+		_, err = newAlertEvaluator(rules, invalidNotifier, addresses)
+		assert.Error(t, err, invalidNotifier)
+	}
+}
+
+func TestAlertEvaluator_NotifiesOnTransitionsOnly(t *testing.T) {
+	recorder := &notificationRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	stateDir := t.TempDir()
+	alerts := newTestAlertEvaluator(t, stateDir,
+		`[{"name": "high_loss", "selector": {"addresses": ["https://listener.logz.io:8053"]}, "metric": "loss_ratio", "operator": ">", "threshold": 0.2, "severity": "critical"}]`,
+		`[{"name": "ops", "type": "webhook", "url": "`+server.URL+`"}]`)
+
+	pingsStats := getTestPingsStats()
+
+	alerts.evaluate(context.Background(), pingsStats)
+	alerts.evaluate(context.Background(), pingsStats)
+
+	bodies := recorder.getBodies()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, alertStatusFiring, bodies[0]["status"])
+	assert.Equal(t, "high_loss", bodies[0]["rule"])
+	assert.Equal(t, "listener.logz.io:8053", bodies[0]["address"])
+	assert.Equal(t, float64(1), bodies[0]["value"])
+	assert.Equal(t, "critical", bodies[0]["severity"])
+
+	// The state is kept in the store, so a new evaluator, like the next Lambda invocation, resolves the alert it notified
+	alerts = newTestAlertEvaluator(t, stateDir, `[{"name": "high_loss", "metric": "loss_ratio", "operator": ">", "threshold": 0.2}]`,
+		`[{"name": "ops", "type": "webhook", "url": "`+server.URL+`"}]`)
+
+	pingsStats[1].successfulProbes = 3
+	pingsStats[1].probesFailed = 0
+	pingsStats[1].rtts = []float64{20, 21, 22}
+
+	alerts.evaluate(context.Background(), pingsStats)
+
+	bodies = recorder.getBodies()
+	require.Len(t, bodies, 3)
+	assert.Equal(t, alertStatusFiring, bodies[1]["status"])
+	assert.Equal(t, "www.google.com:80", bodies[1]["address"])
+	assert.Equal(t, alertStatusResolved, bodies[2]["status"])
+	assert.Equal(t, "listener.logz.io:8053", bodies[2]["address"])
+	assert.Equal(t, bodies[0]["started_at"], bodies[2]["started_at"])
+}
+
+func TestAlertEvaluator_ResolvesAndRetriesFailedNotifications(t *testing.T) {
+	recorder := &notificationRecorder{failing: true}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	alerts := newTestAlertEvaluator(t, t.TempDir(), `[{"name": "slow", "metric": "rtt_p90", "operator": ">", "threshold": 300}]`,
+		`[{"name": "ops", "type": "webhook", "url": "`+server.URL+`"}]`)
+
+	pingsStats := getTestPingsStats()[:1]
+	pingsStats[0].rtts = []float64{100, 500, 600}
+
+	alerts.evaluate(context.Background(), pingsStats)
+	assert.Empty(t, recorder.getBodies())
+
+	recorder.failing = false
+	alerts.evaluate(context.Background(), pingsStats)
+
+	bodies := recorder.getBodies()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, alertStatusFiring, bodies[0]["status"])
+	assert.Equal(t, float64(600), bodies[0]["value"])
+
+	pingsStats[0].rtts = []float64{100, 110, 120}
+	alerts.evaluate(context.Background(), pingsStats)
+
+	bodies = recorder.getBodies()
+	require.Len(t, bodies, 2)
+	assert.Equal(t, alertStatusResolved, bodies[1]["status"])
+	assert.Equal(t, bodies[0]["started_at"], bodies[1]["started_at"])
+}
+
+func TestAlertEvaluator_SlowNotifierDoesNotBlockOtherTargets(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		received <- struct{}{}
+		<-release
+	}))
+	defer slowServer.Close()
+
+	recorder := &notificationRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	stateDir := t.TempDir()
+	rules := `[
+		{"name": "slow", "selector": {"addresses": ["listener.logz.io:8053"]}, "metric": "loss_ratio", "operator": ">", "threshold": 0.2, "notifiers": ["slow"]},
+		{"name": "fast", "selector": {"addresses": ["www.google.com:80"]}, "metric": "loss_ratio", "operator": ">", "threshold": 0.2, "notifiers": ["fast"]}
+	]`
+	notifiers := `[{"name": "slow", "type": "webhook", "url": "` + slowServer.URL + `"}, {"name": "fast", "type": "webhook", "url": "` + server.URL + `"}]`
+	alerts := newTestAlertEvaluator(t, stateDir, rules, notifiers)
+
+	pingsStats := getTestPingsStats()
+
+	done := make(chan struct{})
+	go func() {
+		alerts.evaluate(context.Background(), pingsStats[1:])
+		close(done)
+	}()
+
+	<-received
+
+	// The daemon evaluates the other target while the slow notification is still being sent
+	alerts.evaluate(context.Background(), pingsStats[:1])
+	require.Len(t, recorder.getBodies(), 1)
+
+	close(release)
+	<-done
+
+	// Both states were saved, so nothing is notified again
+	alerts = newTestAlertEvaluator(t, stateDir, rules, notifiers)
+	alerts.evaluate(context.Background(), pingsStats)
+	assert.Len(t, recorder.getBodies(), 1)
+}
+
+func TestAlertEvaluator_TLSExpiry(t *testing.T) {
+	recorder := &notificationRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	alerts := newTestAlertEvaluator(t, t.TempDir(), `[{"name": "tls_expiry", "metric": "tls_expiry_days", "operator": "<", "threshold": 14}]`,
+		`[{"name": "ops", "type": "webhook", "url": "`+server.URL+`"}]`)
+
+	alerts.tlsExpiryChecker = func(_ context.Context, address string) (time.Time, error) {
+		if address == "www.google.com:80" {
+			return time.Now().Add(10 * 24 * time.Hour), nil
+		}
+
+		return time.Time{}, errors.New("no TLS")
+	}
+
+	alerts.evaluate(context.Background(), getTestPingsStats())
+
+	bodies := recorder.getBodies()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "www.google.com:80", bodies[0]["address"])
+	assert.InDelta(t, 10, bodies[0]["value"], 0.01)
+}
+
+func TestGetTLSExpiry(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	notAfter, err := getTLSExpiry(context.Background(), server.Listener.Addr().String())
+	require.NoError(t, err)
+	assert.Equal(t, server.Certificate().NotAfter, notAfter)
+}
+
+func TestAlertNotifiers_Payloads(t *testing.T) {
+	recorder := &notificationRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	notifiers, err := getAlertNotifiers(`[{"name": "chat", "type": "slack", "url": "` + server.URL + `"}, {"name": "pager", "type": "pagerduty", "url": "` + server.URL + `", "routing_key": "key"}]`)
+	require.NoError(t, err)
+
+	notification := &alertNotification{
+		Status:    alertStatusFiring,
+		Rule:      "high_loss",
+		Address:   "www.google.com:80",
+		Metric:    alertMetricLossRatio,
+		Operator:  ">",
+		Threshold: 0.2,
+		Value:     1.0 / 3,
+		Severity:  "error",
+	}
+
+	require.NoError(t, notifiers["chat"].notify(context.Background(), notification))
+	require.NoError(t, notifiers["pager"].notify(context.Background(), notification))
+
+	notification.Status = alertStatusResolved
+	require.NoError(t, notifiers["pager"].notify(context.Background(), notification))
+
+	bodies := recorder.getBodies()
+	require.Len(t, bodies, 3)
+
+	assert.Equal(t, map[string]interface{}{"text": "[FIRING] high_loss on www.google.com:80: loss_ratio is 0.333 (threshold > 0.2)"}, bodies[0])
+
+	assert.Equal(t, "key", bodies[1]["routing_key"])
+	assert.Equal(t, "trigger", bodies[1]["event_action"])
+	assert.Equal(t, "high_loss/www.google.com:80", bodies[1]["dedup_key"])
+	payload := bodies[1]["payload"].(map[string]interface{})
+	assert.Equal(t, "error", payload["severity"])
+	assert.Equal(t, "www.google.com:80", payload["source"])
+
+	assert.Equal(t, "resolve", bodies[2]["event_action"])
+	assert.Equal(t, "high_loss/www.google.com:80", bodies[2]["dedup_key"])
+	assert.Nil(t, bodies[2]["payload"])
+}
+
+func TestPostAlertJSON_NoURLInError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	secretURL := server.URL + "/services/T000/B000/secret-token"
+	server.Close()
+
+	err := postAlertJSON(context.Background(), &http.Client{}, secretURL, map[string]string{})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+
+	err = postAlertJSON(context.Background(), &http.Client{}, "http://[::1]:namedport/secret-token", map[string]string{})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+}
+
+func TestGetRttPercentile(t *testing.T) {
+	rtts := []float64{50, 10, 40, 20, 30, 60, 70, 80, 90, 100}
+
+	assert.Equal(t, float64(50), getRttPercentile(rtts, 50))
+	assert.Equal(t, float64(90), getRttPercentile(rtts, 90))
+	assert.Equal(t, float64(100), getRttPercentile(rtts, 99))
+	assert.Equal(t, float64(7), getRttPercentile([]float64{7}, 90))
+}
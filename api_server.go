@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiListenAddressEnvName    = "API_LISTEN_ADDRESS"
+	apiTokenEnvName            = "API_TOKEN"
+	apiProbesPath              = "/probes"
+	apiTargetsPath             = "/targets"
+	apiResultsPath             = "/results"
+	apiHealthPath              = "/healthz"
+	apiMaxProbeCount           = 100
+	apiMaxProbeInterval        = time.Minute
+	apiMaxProbeTimeout         = time.Minute
+	apiMaxProbeDuration        = 5 * time.Minute
+	apiMaxRequestBodyBytes     = 1 << 20
+	apiServerReadHeaderTimeout = 10 * time.Second
+	apiServerShutdownTimeout   = 5 * time.Second
+	apiHealthStatusOK          = "ok"
+	apiHealthStatusDegraded    = "degraded"
+	apiHealthStatusStalled     = "stalled"
+)
+
+// apiServer serves ad-hoc probes and the latest results of the daemon's targets
+type apiServer struct {
+	lps       *logzioPingStatistics
+	schedules []*targetSchedule
+	token     string
+	server    *http.Server
+	listener  net.Listener
+	startedAt time.Time
+	lock      sync.RWMutex
+	results   map[string]*targetResult
+}
+
+// targetResult is the latest cycle of a target, as served by GET /results
+type targetResult struct {
+	*pingSummary
+	RunID       string    `json:"run_id"`
+	ProbedAt    time.Time `json:"probed_at"`
+	Truncated   bool      `json:"truncated"`
+	Exported    bool      `json:"exported"`
+	ExportError string    `json:"export_error,omitempty"`
+}
+
+type targetInfo struct {
+	Address         string            `json:"address"`
+	IntervalSeconds float64           `json:"interval_seconds"`
+	JitterSeconds   float64           `json:"jitter_seconds"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+// probeRequest is the body of POST /probes. Left out settings use the daemon's configuration.
+type probeRequest struct {
+	Address  string   `json:"address"`
+	Count    *int     `json:"count"`
+	Interval *float64 `json:"interval"`
+	Timeout  *float64 `json:"timeout"`
+}
+
+type healthReport struct {
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// newAPIServer starts the API server if API_LISTEN_ADDRESS is set, and returns nil if it is not
+func newAPIServer(lps *logzioPingStatistics, schedules []*targetSchedule) (*apiServer, error) {
+	listenAddress := os.Getenv(apiListenAddressEnvName)
+	if listenAddress == "" {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %v", listenAddress, err)
+	}
+
+	as := &apiServer{
+		lps:       lps,
+		schedules: schedules,
+		token:     os.Getenv(apiTokenEnvName),
+		listener:  listener,
+		startedAt: time.Now(),
+		results:   make(map[string]*targetResult),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiProbesPath, as.requireToken(as.handleProbes))
+	mux.HandleFunc(apiTargetsPath, as.authorize(as.handleTargets))
+	mux.HandleFunc(apiResultsPath, as.authorize(as.handleResults))
+	mux.HandleFunc(apiHealthPath, as.handleHealth)
+
+	as.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: apiServerReadHeaderTimeout,
+	}
+
+	go func() {
+		if err := as.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errorLogger.Println("Error serving the API:", err)
+		}
+	}()
+
+	infoLogger.Println("Serving the API on", listener.Addr().String())
+	if as.token == "" {
+		infoLogger.Printf("%s is not set, so anyone who can reach %s can read the targets and results, "+
+			"and POST %s is disabled", apiTokenEnvName, listener.Addr().String(), apiProbesPath)
+	}
+
+	return as, nil
+}
+
+func (as *apiServer) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), apiServerShutdownTimeout)
+	defer cancel()
+
+	return as.server.Shutdown(ctx)
+}
+
+// recordCycle keeps the results of a daemon cycle as the latest of its target
+func (as *apiServer) recordCycle(pingStats *pingStatistics, elapsed time.Duration, exportErr error) {
+	result := &targetResult{
+		pingSummary: getPingSummary(pingStats, elapsed),
+		RunID:       pingStats.runID,
+		ProbedAt:    time.Now().UTC(),
+		Truncated:   pingStats.truncated,
+		Exported:    exportErr == nil,
+	}
+
+	if exportErr != nil {
+		result.ExportError = exportErr.Error()
+	}
+
+	as.lock.Lock()
+	defer as.lock.Unlock()
+
+	as.results[pingStats.address] = result
+}
+
+// authorize requires the API_TOKEN bearer token, if one is set
+func (as *apiServer) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if as.token != "" {
+			token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(as.token)) != 1 {
+				writeAPIResponse(writer, http.StatusUnauthorized, &apiError{Error: "missing or invalid bearer token"})
+				return
+			}
+		}
+
+		handler(writer, request)
+	}
+}
+
+// requireToken serves the handler only if API_TOKEN is set, and the request has it. Without a token, anyone
+// who can reach the API could make the host connect to any address.
+func (as *apiServer) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	authorizedHandler := as.authorize(handler)
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if as.token == "" {
+			writeAPIResponse(writer, http.StatusForbidden, &apiError{Error: apiTokenEnvName + " must be set to use this endpoint"})
+			return
+		}
+
+		authorizedHandler(writer, request)
+	}
+}
+
+// handleProbes probes the address of the request with the daemon's network vantage point.
+// The results are returned only, they are not exported.
+func (as *apiServer) handleProbes(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeAPIResponse(writer, http.StatusMethodNotAllowed, &apiError{Error: "only POST is allowed"})
+		return
+	}
+
+	probeRequest := &probeRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, apiMaxRequestBodyBytes)).Decode(probeRequest); err != nil {
+		writeAPIResponse(writer, http.StatusBadRequest, &apiError{Error: fmt.Sprintf("request body must be a JSON object: %v", err)})
+		return
+	}
+
+	adHocPingStats, err := as.getAdHocPingStatistics(request.Context(), probeRequest)
+	if err != nil {
+		writeAPIResponse(writer, http.StatusBadRequest, &apiError{Error: err.Error()})
+		return
+	}
+
+	start := time.Now()
+
+	pingStats, err := adHocPingStats.getAddressPingStatistics(adHocPingStats.addresses[0])
+	if err != nil {
+		writeAPIResponse(writer, http.StatusInternalServerError, &apiError{Error: err.Error()})
+		return
+	}
+
+	pingStats.runID = adHocPingStats.runID
+	writeAPIResponse(writer, http.StatusOK, getPingSummary(pingStats, time.Since(start)))
+}
+
+// getAdHocPingStatistics returns the configuration of an ad-hoc probe, with the daemon's settings as the defaults
+func (as *apiServer) getAdHocPingStatistics(ctx context.Context, probeRequest *probeRequest) (*logzioPingStatistics, error) {
+	if probeRequest.Address == "" {
+		return nil, fmt.Errorf("address must not be empty")
+	}
+
+	adHocPingStats := &logzioPingStatistics{
+		ctx:          ctx,
+		addresses:    getAddresses(probeRequest.Address),
+		pingCount:    as.lps.pingCount,
+		pingInterval: as.lps.pingInterval,
+		pingTimeout:  as.lps.pingTimeout,
+		runID:        newRunID(),
+	}
+
+	if probeRequest.Count != nil {
+		if *probeRequest.Count < 1 || *probeRequest.Count > apiMaxProbeCount {
+			return nil, fmt.Errorf("count must be between 1 and %d", apiMaxProbeCount)
+		}
+
+		adHocPingStats.pingCount = *probeRequest.Count
+	}
+
+	if probeRequest.Interval != nil {
+		if *probeRequest.Interval < 0 || *probeRequest.Interval > apiMaxProbeInterval.Seconds() {
+			return nil, fmt.Errorf("interval must be between 0 and %g seconds", apiMaxProbeInterval.Seconds())
+		}
+
+		adHocPingStats.pingInterval = time.Duration(*probeRequest.Interval * float64(time.Second))
+	}
+
+	if probeRequest.Timeout != nil {
+		if *probeRequest.Timeout <= 0 || *probeRequest.Timeout > apiMaxProbeTimeout.Seconds() {
+			return nil, fmt.Errorf("timeout must be a positive number of up to %g seconds", apiMaxProbeTimeout.Seconds())
+		}
+
+		adHocPingStats.pingTimeout = time.Duration(*probeRequest.Timeout * float64(time.Second))
+	}
+
+	// The request waits for the probes, so their worst case must stay short
+	worstCase := time.Duration(adHocPingStats.pingCount) * (adHocPingStats.pingInterval + adHocPingStats.pingTimeout)
+	if worstCase > apiMaxProbeDuration {
+		return nil, fmt.Errorf("probing may take up to %s, more than the %s limit: lower the count, interval or timeout",
+			worstCase, apiMaxProbeDuration)
+	}
+
+	return adHocPingStats, nil
+}
+
+func (as *apiServer) handleTargets(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeAPIResponse(writer, http.StatusMethodNotAllowed, &apiError{Error: "only GET is allowed"})
+		return
+	}
+
+	targets := make([]*targetInfo, 0, len(as.schedules))
+	for _, schedule := range as.schedules {
+		targets = append(targets, &targetInfo{
+			Address:         schedule.address,
+			IntervalSeconds: schedule.interval.Seconds(),
+			JitterSeconds:   schedule.jitter.Seconds(),
+			Labels:          as.lps.targetLabels[schedule.address],
+		})
+	}
+
+	writeAPIResponse(writer, http.StatusOK, targets)
+}
+
+// handleResults returns the latest results of every target that completed a cycle, or of the address query parameter
+func (as *apiServer) handleResults(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeAPIResponse(writer, http.StatusMethodNotAllowed, &apiError{Error: "only GET is allowed"})
+		return
+	}
+
+	address := request.URL.Query().Get("address")
+	if address != "" {
+		address = getAddresses(address)[0]
+	}
+
+	as.lock.RLock()
+	defer as.lock.RUnlock()
+
+	results := make([]*targetResult, 0, len(as.schedules))
+	for _, schedule := range as.schedules {
+		if address != "" && schedule.address != address {
+			continue
+		}
+
+		if result, ok := as.results[schedule.address]; ok {
+			results = append(results, result)
+		}
+	}
+
+	if address != "" && len(results) == 0 {
+		writeAPIResponse(writer, http.StatusNotFound, &apiError{Error: "no results for address: " + address})
+		return
+	}
+
+	writeAPIResponse(writer, http.StatusOK, results)
+}
+
+// handleHealth reports the collector as stalled, with 503, if a target did not complete a cycle in twice its interval
+// plus the time its probes may take. A failed export only degrades it, since the batch is retried and spooled.
+func (as *apiServer) handleHealth(writer http.ResponseWriter, _ *http.Request) {
+	report := &healthReport{Status: apiHealthStatusOK}
+	probesTime := time.Duration(as.lps.pingCount) * (as.lps.pingInterval + as.lps.pingTimeout)
+
+	as.lock.RLock()
+
+	for _, schedule := range as.schedules {
+		lastCycleAt := as.startedAt.Add(schedule.jitter)
+		result, ok := as.results[schedule.address]
+		if ok {
+			lastCycleAt = result.ProbedAt
+		}
+
+		if time.Since(lastCycleAt) > 2*schedule.interval+probesTime {
+			report.Status = apiHealthStatusStalled
+			report.Reasons = append(report.Reasons, "no completed cycle of "+schedule.address+" since "+lastCycleAt.UTC().Format(time.RFC3339))
+			continue
+		}
+
+		if ok && !result.Exported {
+			if report.Status == apiHealthStatusOK {
+				report.Status = apiHealthStatusDegraded
+			}
+
+			report.Reasons = append(report.Reasons, "last export of "+schedule.address+" failed: "+result.ExportError)
+		}
+	}
+
+	as.lock.RUnlock()
+
+	if report.Status == apiHealthStatusStalled {
+		writeAPIResponse(writer, http.StatusServiceUnavailable, report)
+		return
+	}
+
+	writeAPIResponse(writer, http.StatusOK, report)
+}
+
+func writeAPIResponse(writer http.ResponseWriter, statusCode int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		errorLogger.Println("Error writing API response:", err)
+	}
+}
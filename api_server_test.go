@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestAPIServer() *apiServer {
+	return &apiServer{
+		lps: &logzioPingStatistics{
+			pingCount:    1,
+			pingInterval: 0,
+			pingTimeout:  time.Second,
+			targetLabels: map[string]map[string]string{"www.google.com:80": {"team": "search"}},
+		},
+		schedules: []*targetSchedule{
+			{address: "www.google.com:80", interval: time.Minute, jitter: 5 * time.Second},
+			{address: "listener.logz.io:8053", interval: time.Minute},
+		},
+		startedAt: time.Now(),
+		results:   make(map[string]*targetResult),
+	}
+}
+
+func sendAPIRequest(handler http.HandlerFunc, method string, target string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(method, target, bytes.NewBufferString(body)))
+
+	return recorder
+}
+
+func TestNewAPIServer_Disabled(t *testing.T) {
+	as, err := newAPIServer(&logzioPingStatistics{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, as)
+}
+
+func TestNewAPIServer_Serves(t *testing.T) {
+	err := os.Setenv(apiListenAddressEnvName, "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer os.Clearenv()
+
+	as, err := newAPIServer(getTestAPIServer().lps, nil)
+	require.NoError(t, err)
+	require.NotNil(t, as)
+
+	response, err := http.Get("http://" + as.listener.Addr().String() + apiHealthPath)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	require.NoError(t, as.shutdown())
+}
+
+func TestAPIServer_Probes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	as := getTestAPIServer()
+	recorder := sendAPIRequest(as.handleProbes, http.MethodPost, apiProbesPath,
+		`{"address": "tcp://`+listener.Addr().String()+`", "count": 2, "interval": 0.01, "timeout": 1}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	summary := &pingSummary{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), summary))
+
+	assert.Equal(t, listener.Addr().String(), summary.Address)
+	assert.Equal(t, 2, summary.PacketsTransmitted)
+	assert.Equal(t, 2, summary.PacketsReceived)
+	assert.Len(t, summary.Probes, 2)
+	assert.NotNil(t, summary.Rtt)
+}
+
+func TestAPIServer_ProbesInvalid(t *testing.T) {
+	as := getTestAPIServer()
+
+	invalidBodies := []string{
+		`not json`,
+		`{}`,
+		`{"address": "www.google.com", "count": 0}`,
+		`{"address": "www.google.com", "count": 1000}`,
+		`{"address": "www.google.com", "interval": -1}`,
+		`{"address": "www.google.com", "timeout": 0}`,
+		`{"address": "www.google.com", "interval": 3600}`,
+		`{"address": "www.google.com", "timeout": 1e300}`,
+		`{"address": "www.google.com", "count": 100, "interval": 30, "timeout": 30}`,
+	}
+
+	for _, body := range invalidBodies {
+		recorder := sendAPIRequest(as.handleProbes, http.MethodPost, apiProbesPath, body)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, body)
+	}
+
+	recorder := sendAPIRequest(as.handleProbes, http.MethodGet, apiProbesPath, "")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestAPIServer_Targets(t *testing.T) {
+	as := getTestAPIServer()
+
+	recorder := sendAPIRequest(as.handleTargets, http.MethodGet, apiTargetsPath, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	targets := make([]*targetInfo, 0)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &targets))
+
+	assert.Equal(t, []*targetInfo{
+		{Address: "www.google.com:80", IntervalSeconds: 60, JitterSeconds: 5, Labels: map[string]string{"team": "search"}},
+		{Address: "listener.logz.io:8053", IntervalSeconds: 60},
+	}, targets)
+}
+
+func TestAPIServer_Results(t *testing.T) {
+	as := getTestAPIServer()
+
+	recorder := sendAPIRequest(as.handleResults, http.MethodGet, apiResultsPath, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `[]`, recorder.Body.String())
+
+	pingsStats := getTestPingsStats()
+	pingsStats[0].runID = "run-id"
+
+	as.recordCycle(pingsStats[0], time.Second, nil)
+	as.recordCycle(pingsStats[1], time.Second, errors.New("500 Internal Server Error"))
+
+	recorder = sendAPIRequest(as.handleResults, http.MethodGet, apiResultsPath, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	results := make([]map[string]interface{}, 0)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &results))
+	require.Len(t, results, 2)
+
+	assert.Equal(t, "www.google.com:80", results[0]["address"])
+	assert.Equal(t, "run-id", results[0]["run_id"])
+	assert.Equal(t, float64(2), results[0]["packets_received"])
+	assert.Equal(t, true, results[0]["exported"])
+	assert.Equal(t, "500 Internal Server Error", results[1]["export_error"])
+
+	recorder = sendAPIRequest(as.handleResults, http.MethodGet, apiResultsPath+"?address=https://listener.logz.io:8053", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &results))
+	require.Len(t, results, 1)
+	assert.Equal(t, "listener.logz.io:8053", results[0]["address"])
+
+	recorder = sendAPIRequest(as.handleResults, http.MethodGet, apiResultsPath+"?address=www.example.com", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestAPIServer_Health(t *testing.T) {
+	as := getTestAPIServer()
+	report := &healthReport{}
+
+	recorder := sendAPIRequest(as.handleHealth, http.MethodGet, apiHealthPath, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), report))
+	assert.Equal(t, apiHealthStatusOK, report.Status)
+
+	pingsStats := getTestPingsStats()
+	as.recordCycle(pingsStats[1], time.Second, errors.New("500 Internal Server Error"))
+
+	recorder = sendAPIRequest(as.handleHealth, http.MethodGet, apiHealthPath, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), report))
+	assert.Equal(t, apiHealthStatusDegraded, report.Status)
+	assert.Equal(t, []string{"last export of listener.logz.io:8053 failed: 500 Internal Server Error"}, report.Reasons)
+
+	// www.google.com:80 never completed a cycle since the start
+	as.startedAt = time.Now().Add(-time.Hour)
+
+	recorder = sendAPIRequest(as.handleHealth, http.MethodGet, apiHealthPath, "")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), report))
+	assert.Equal(t, apiHealthStatusStalled, report.Status)
+	assert.Len(t, report.Reasons, 2)
+}
+
+func TestAPIServer_Token(t *testing.T) {
+	as := getTestAPIServer()
+	as.token = "secret"
+
+	handler := as.authorize(as.handleTargets)
+
+	recorder := sendAPIRequest(handler, http.MethodGet, apiTargetsPath, "")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request := httptest.NewRequest(http.MethodGet, apiTargetsPath, nil)
+	request.Header.Set("Authorization", "Bearer secret")
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestAPIServer_ProbesRequireToken(t *testing.T) {
+	as := getTestAPIServer()
+	handler := as.requireToken(as.handleProbes)
+
+	// Without API_TOKEN, nobody can make the host probe an address
+	recorder := sendAPIRequest(handler, http.MethodPost, apiProbesPath, `{"address": "127.0.0.1:1"}`)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	as.token = "secret"
+	recorder = sendAPIRequest(handler, http.MethodPost, apiProbesPath, `{"address": "127.0.0.1:1"}`)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	request := httptest.NewRequest(http.MethodPost, apiProbesPath, bytes.NewBufferString(`{"address": "127.0.0.1:1"}`))
+	request.Header.Set("Authorization", "Bearer secret")
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	exportTimeReserveEnvName = "EXPORT_TIME_RESERVE"
+	defaultExportTimeReserve = 10 * time.Second
+	minProbeTimeout          = 100 * time.Millisecond
+	truncatedLabelName       = "truncated"
+)
+
+func getExportTimeReserve() (time.Duration, error) {
+	exportTimeReserveString := os.Getenv(exportTimeReserveEnvName)
+	if exportTimeReserveString == "" {
+		return defaultExportTimeReserve, nil
+	}
+
+	exportTimeReserve, err := getNumberEnvValue(exportTimeReserveString, exportTimeReserveEnvName)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(*exportTimeReserve) * time.Second, nil
+}
+
+// getProbeDeadline returns the time probing must stop by, so the export still has its reserved time
+// before the context deadline (the Lambda invocation deadline). It returns the zero time if there is no deadline.
+func (lps *logzioPingStatistics) getProbeDeadline() time.Time {
+	if lps.ctx == nil {
+		return time.Time{}
+	}
+
+	deadline, ok := lps.ctx.Deadline()
+	if !ok {
+		return time.Time{}
+	}
+
+	return deadline.Add(-lps.exportTimeReserve)
+}
+
+// getAddressProbeDeadline shares the time left for probing evenly between the remaining addresses, so a slow address
+// doesn't use up the time of the ones after it. The time an address leaves unused goes to the ones after it.
+func getAddressProbeDeadline(probeDeadline time.Time, remainingAddresses int) time.Time {
+	if probeDeadline.IsZero() || remainingAddresses <= 1 {
+		return probeDeadline
+	}
+
+	return time.Now().Add(time.Until(probeDeadline) / time.Duration(remainingAddresses))
+}
+
+// getProbeTimeout returns the timeout of the next probe, cut to the time left for probing after its interval.
+// It returns false if there is no time left for another probe.
+func (lps *logzioPingStatistics) getProbeTimeout(probeDeadline time.Time) (time.Duration, bool) {
+	if probeDeadline.IsZero() {
+		return lps.pingTimeout, true
+	}
+
+	timeLeft := time.Until(probeDeadline) - lps.pingInterval
+	if timeLeft < minProbeTimeout {
+		return 0, false
+	}
+
+	if timeLeft < lps.pingTimeout {
+		return timeLeft, true
+	}
+
+	return lps.pingTimeout, true
+}
+
+// warnIfOverBudget logs when probing all the addresses may take longer than the time left for probing
+func (lps *logzioPingStatistics) warnIfOverBudget() {
+	probeDeadline := lps.getProbeDeadline()
+	if probeDeadline.IsZero() {
+		return
+	}
+
+	worstCase := time.Duration(len(lps.addresses)*lps.pingCount) * (lps.pingInterval + lps.pingTimeout)
+	if timeLeft := time.Until(probeDeadline); worstCase > timeLeft {
+		infoLogger.Printf("Probing may take up to %s but only %s is left before the export, so each address gets a share of it, "+
+			"probes past its share will be skipped and the results flagged as %s", worstCase, timeLeft.Round(time.Millisecond), truncatedLabelName)
+	}
+}
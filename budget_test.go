@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProbeTimeout(t *testing.T) {
+	logzioPingStats := &logzioPingStatistics{
+		pingInterval: time.Second,
+		pingTimeout:  10 * time.Second,
+	}
+
+	probeTimeout, ok := logzioPingStats.getProbeTimeout(time.Time{})
+	require.True(t, ok)
+	assert.Equal(t, 10*time.Second, probeTimeout)
+
+	probeTimeout, ok = logzioPingStats.getProbeTimeout(time.Now().Add(time.Minute))
+	require.True(t, ok)
+	assert.Equal(t, 10*time.Second, probeTimeout)
+
+	probeTimeout, ok = logzioPingStats.getProbeTimeout(time.Now().Add(6 * time.Second))
+	require.True(t, ok)
+	assert.InDelta(t, float64(5*time.Second), float64(probeTimeout), float64(100*time.Millisecond))
+
+	_, ok = logzioPingStats.getProbeTimeout(time.Now().Add(time.Second))
+	assert.False(t, ok)
+}
+
+func TestGetProbeDeadline(t *testing.T) {
+	logzioPingStats := &logzioPingStatistics{exportTimeReserve: 10 * time.Second}
+	assert.True(t, logzioPingStats.getProbeDeadline().IsZero())
+
+	logzioPingStats.ctx = context.Background()
+	assert.True(t, logzioPingStats.getProbeDeadline().IsZero())
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	logzioPingStats.ctx = ctx
+	assert.Equal(t, deadline.Add(-10*time.Second), logzioPingStats.getProbeDeadline())
+}
+
+func TestGetAddressPingStatistics_Truncated(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second+500*time.Millisecond)
+	defer cancel()
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:               ctx,
+		pingCount:         100,
+		pingInterval:      100 * time.Millisecond,
+		pingTimeout:       time.Second,
+		exportTimeReserve: time.Second,
+	}
+
+	pingStats, err := logzioPingStats.getAddressPingStatistics(listener.Addr().String())
+	require.NoError(t, err)
+
+	// Probing stops before the reserve, leaving the export its time before the deadline
+	deadline, _ := ctx.Deadline()
+	assert.True(t, time.Until(deadline) >= 900*time.Millisecond)
+
+	assert.True(t, pingStats.truncated)
+	assert.Greater(t, pingStats.probesSent, 0)
+	assert.Less(t, pingStats.probesSent, 100)
+	assert.Equal(t, pingStats.probesSent, len(pingStats.probes))
+	assert.Equal(t, pingStats.probesSent, pingStats.successfulProbes)
+	assert.Equal(t, "true", pingStats.getLabels()[truncatedLabelName])
+
+	for _, point := range getMetricPoints([]*pingStatistics{pingStats}) {
+		assert.Equal(t, "true", point.labels[truncatedLabelName])
+	}
+}
+
+func TestExportWithRetry_StopsBeforeDeadline(t *testing.T) {
+	testExp := &testExporter{errs: []error{&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"}, &httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"}}}
+	delivery := &deliveryConfig{maxRetries: 3, initialBackoff: 10 * time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := delivery.exportWithRetry(ctx, testExp, getTestPingsStats())
+	require.Error(t, err)
+
+	assert.Len(t, testExp.exported, 1)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestGetExportTimeReserve(t *testing.T) {
+	exportTimeReserve, err := getExportTimeReserve()
+	require.NoError(t, err)
+	assert.Equal(t, defaultExportTimeReserve, exportTimeReserve)
+
+	err = os.Setenv(exportTimeReserveEnvName, "20")
+	require.NoError(t, err)
+
+	exportTimeReserve, err = getExportTimeReserve()
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, exportTimeReserve)
+
+	os.Clearenv()
+}
+
+func TestGetAllAddressesPingStatistics_SharesBudget(t *testing.T) {
+	addresses := make([]string, 0, 2)
+
+	for index := 0; index < 2; index++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		defer func(listener net.Listener) {
+			_ = listener.Close()
+		}(listener)
+
+		addresses = append(addresses, listener.Addr().String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          ctx,
+		addresses:    addresses,
+		pingCount:    100,
+		pingInterval: 100 * time.Millisecond,
+		pingTimeout:  time.Second,
+	}
+
+	require.NoError(t, logzioPingStats.getAllAddressesPingStatistics())
+	require.Len(t, logzioPingStats.pingsStats, 2)
+
+	// The first address gets its share of the time, and leaves the rest to the second one
+	for _, pingStats := range logzioPingStats.pingsStats {
+		assert.True(t, pingStats.truncated)
+		assert.Greater(t, pingStats.probesSent, 3)
+		assert.Less(t, pingStats.probesSent, 15)
+	}
+}
+
+func TestExportPingsStats_SkipsUnprobedAddresses(t *testing.T) {
+	testExp := &testExporter{}
+	logzioPingStats := &logzioPingStatistics{ctx: context.Background(), exporters: []exporter{testExp}}
+
+	pingsStats := getTestPingsStats()
+	pingsStats[1] = &pingStatistics{address: "listener.logz.io:8053", truncated: true}
+
+	statuses, err := logzioPingStats.exportPingsStats(pingsStats)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	require.Len(t, testExp.exported, 1)
+	assert.Equal(t, pingsStats[:1], testExp.exported[0])
+
+	// Nothing is exported when no address got to be probed
+	statuses, err = logzioPingStats.exportPingsStats(pingsStats[1:])
+	require.NoError(t, err)
+	assert.Empty(t, statuses)
+	assert.Len(t, testExp.exported, 1)
+}
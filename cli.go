@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	pingCommandName        = "ping"
+	pingCountFlagName      = "c"
+	pingIntervalFlagName   = "i"
+	pingTimeoutFlagName    = "W"
+	pingJSONFlagName       = "json"
+	pingHistoryFlagName    = "history"
+	defaultCLIPingCount    = 3
+	defaultCLIPingInterval = 1
+	defaultCLIPingTimeout  = 10
+	cliRttPrecision        = 3
+	cliExitSuccess         = 0
+	cliExitNoReply         = 1
+	cliExitUsage           = 2
+)
+
+// pingSummary is the JSON output of the ping command for an address
+type pingSummary struct {
+	Address            string          `json:"address"`
+	PacketsTransmitted int             `json:"packets_transmitted"`
+	PacketsReceived    int             `json:"packets_received"`
+	PacketLossPercent  float64         `json:"packet_loss_percent"`
+	TimeMs             int64           `json:"time_ms"`
+	Rtt                *pingSummaryRtt `json:"rtt,omitempty"`
+	Probes             []*probeRecord  `json:"probes"`
+}
+
+type pingSummaryRtt struct {
+	Min  float64 `json:"min_ms"`
+	Avg  float64 `json:"avg_ms"`
+	Max  float64 `json:"max_ms"`
+	Mdev float64 `json:"mdev_ms"`
+}
+
+// runPingCommand probes the addresses given as arguments and prints the results like iputils ping does,
+// without exporting them. It returns the exit code: 0 if every address replied, 1 if one didn't and 2 on bad usage.
+func runPingCommand(args []string, output io.Writer) int {
+	flags := flag.NewFlagSet(pingCommandName, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(output, "Usage: %s %s [-c count] [-i interval] [-W timeout] [-json] [-history] address...\n", filepath.Base(os.Args[0]), pingCommandName)
+		flags.PrintDefaults()
+	}
+
+	pingCount := flags.Int(pingCountFlagName, defaultCLIPingCount, "The number of probes for each address")
+	pingInterval := flags.Float64(pingIntervalFlagName, defaultCLIPingInterval, "The time to wait (seconds) before each probe")
+	pingTimeout := flags.Float64(pingTimeoutFlagName, defaultCLIPingTimeout, "The timeout (seconds) for each probe")
+	jsonOutput := flags.Bool(pingJSONFlagName, false, "Print a JSON summary instead of the ping-style lines")
+	recordHistory := flags.Bool(pingHistoryFlagName, false, "Record the probes in the history store of HISTORY_PATH")
+
+	if err := flags.Parse(args); err != nil {
+		return cliExitUsage
+	}
+
+	if flags.NArg() == 0 || *pingCount < 1 || *pingInterval < 0 || *pingTimeout <= 0 {
+		flags.Usage()
+		return cliExitUsage
+	}
+
+	var history *historyStore
+	if *recordHistory {
+		var err error
+		if history, err = newHistoryStore(); err != nil {
+			_, _ = fmt.Fprintln(output, "Error opening history:", err)
+			return cliExitNoReply
+		}
+	}
+
+	// The probe results are printed by the command, so the logs would only repeat them
+	restoreLoggers := discardLoggers()
+	defer restoreLoggers()
+
+	// Like ping, an interrupt stops probing and still prints the summary of the probes sent so far
+	interruptCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          interruptCtx,
+		addresses:    getAddresses(strings.Join(flags.Args(), ",")),
+		pingCount:    *pingCount,
+		pingInterval: time.Duration(*pingInterval * float64(time.Second)),
+		pingTimeout:  time.Duration(*pingTimeout * float64(time.Second)),
+		runID:        newRunID(),
+	}
+
+	if !*jsonOutput {
+		logzioPingStats.probeHandler = func(sequence int, probe *probeResult) {
+			_, _ = fmt.Fprintln(output, formatProbeLine(sequence, probe))
+		}
+	}
+
+	exitCode := cliExitSuccess
+	summaries := make([]*pingSummary, 0, len(logzioPingStats.addresses))
+
+	for index, address := range logzioPingStats.addresses {
+		if interruptCtx.Err() != nil {
+			break
+		}
+
+		if !*jsonOutput {
+			if index > 0 {
+				_, _ = fmt.Fprintln(output)
+			}
+
+			_, _ = fmt.Fprintf(output, "PING %s: %d TCP connects, timeout %s\n", address, logzioPingStats.pingCount, logzioPingStats.pingTimeout)
+		}
+
+		start := time.Now()
+
+		pingStats, err := logzioPingStats.getAddressPingStatistics(address)
+		if err != nil {
+			_, _ = fmt.Fprintf(output, "Error getting ping statistics for address %s: %v\n", address, err)
+			exitCode = cliExitNoReply
+			continue
+		}
+
+		pingStats.runID = logzioPingStats.runID
+		summary := getPingSummary(pingStats, time.Since(start))
+
+		if history != nil {
+			if err = history.add([]*pingStatistics{pingStats}); err != nil {
+				_, _ = fmt.Fprintln(output, "Error recording history:", err)
+				exitCode = cliExitNoReply
+			}
+		}
+
+		summaries = append(summaries, summary)
+
+		if summary.PacketsReceived == 0 {
+			exitCode = cliExitNoReply
+		}
+
+		if !*jsonOutput {
+			_, _ = fmt.Fprint(output, formatPingSummary(summary))
+		}
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(summaries); err != nil {
+			_, _ = fmt.Fprintln(output, "Error writing JSON summary:", err)
+			return cliExitNoReply
+		}
+	}
+
+	return exitCode
+}
+
+func discardLoggers() func() {
+	debugWriter := debugLogger.Writer()
+	infoWriter := infoLogger.Writer()
+	errorWriter := errorLogger.Writer()
+
+	debugLogger.SetOutput(io.Discard)
+	infoLogger.SetOutput(io.Discard)
+	errorLogger.SetOutput(io.Discard)
+
+	return func() {
+		debugLogger.SetOutput(debugWriter)
+		infoLogger.SetOutput(infoWriter)
+		errorLogger.SetOutput(errorWriter)
+	}
+}
+
+func getPingSummary(pingStats *pingStatistics, elapsed time.Duration) *pingSummary {
+	summary := &pingSummary{
+		Address:            pingStats.address,
+		PacketsTransmitted: pingStats.probesSent,
+		PacketsReceived:    pingStats.successfulProbes,
+		TimeMs:             elapsed.Milliseconds(),
+		Probes:             make([]*probeRecord, 0, len(pingStats.probes)),
+	}
+
+	// An interrupt before the first probe leaves nothing to compute the loss of
+	if pingStats.probesSent > 0 {
+		summary.PacketLossPercent = float64(pingStats.probesFailed) * 100 / float64(pingStats.probesSent)
+	}
+
+	if rttStats := getRttStatistics(pingStats.rtts); rttStats != nil {
+		summary.Rtt = &pingSummaryRtt{Min: rttStats.min, Avg: rttStats.avg, Max: rttStats.max, Mdev: rttStats.mdev}
+	}
+
+	for _, probe := range pingStats.probes {
+		summary.Probes = append(summary.Probes, getProbeRecord(pingStats, probe))
+	}
+
+	return summary
+}
+
+func formatProbeLine(sequence int, probe *probeResult) string {
+	target := probe.address
+	if probe.resolvedIP != "" {
+		target += " (" + probe.resolvedIP + ")"
+	}
+
+	if probe.err != nil {
+		return fmt.Sprintf("No connection to %s: seq=%d %s: %v", target, sequence, probe.errorReason, probe.err)
+	}
+
+	return fmt.Sprintf("Connected to %s: seq=%d time=%s ms", target, sequence, formatCLIRtt(probe.rtt))
+}
+
+// formatPingSummary returns the statistics of an address the way iputils ping prints them
+func formatPingSummary(summary *pingSummary) string {
+	builder := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(builder, "\n--- %s ping statistics ---\n", summary.Address)
+	_, _ = fmt.Fprintf(builder, "%d packets transmitted, %d received, %s%% packet loss, time %dms\n",
+		summary.PacketsTransmitted, summary.PacketsReceived, strconv.FormatFloat(summary.PacketLossPercent, 'g', 6, 64), summary.TimeMs)
+
+	if summary.Rtt != nil {
+		_, _ = fmt.Fprintf(builder, "rtt min/avg/max/mdev = %s/%s/%s/%s ms\n",
+			formatCLIRtt(summary.Rtt.Min), formatCLIRtt(summary.Rtt.Avg), formatCLIRtt(summary.Rtt.Max), formatCLIRtt(summary.Rtt.Mdev))
+	}
+
+	return builder.String()
+}
+
+func formatCLIRtt(rtt float64) string {
+	return strconv.FormatFloat(rtt, 'f', cliRttPrecision, 64)
+}
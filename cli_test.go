@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPingCommand_Success(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	output := &bytes.Buffer{}
+	exitCode := runPingCommand([]string{"-c", "2", "-i", "0", "-W", "1", "tcp://" + listener.Addr().String()}, output)
+	assert.Equal(t, cliExitSuccess, exitCode)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 7)
+
+	assert.Equal(t, "PING "+listener.Addr().String()+": 2 TCP connects, timeout 1s", lines[0])
+	assert.Regexp(t, `^Connected to 127\.0\.0\.1:[0-9]+ \(127\.0\.0\.1\): seq=1 time=[0-9]+\.[0-9]{3} ms$`, lines[1])
+	assert.Regexp(t, `seq=2 time=`, lines[2])
+	assert.Equal(t, "--- "+listener.Addr().String()+" ping statistics ---", lines[4])
+	assert.Regexp(t, `^2 packets transmitted, 2 received, 0% packet loss, time [0-9]+ms$`, lines[5])
+	assert.Regexp(t, `^rtt min/avg/max/mdev = [0-9.]+/[0-9.]+/[0-9.]+/[0-9.]+ ms$`, lines[6])
+}
+
+func TestRunPingCommand_JSON(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	address := listener.Addr().String()
+	err = listener.Close()
+	require.NoError(t, err)
+
+	output := &bytes.Buffer{}
+	exitCode := runPingCommand([]string{"-json", "-c", "1", "-i", "0", "-W", "1", address}, output)
+	assert.Equal(t, cliExitNoReply, exitCode)
+
+	summaries := make([]*pingSummary, 0)
+	err = json.Unmarshal(output.Bytes(), &summaries)
+	require.NoError(t, err)
+
+	require.Len(t, summaries, 1)
+	assert.Equal(t, address, summaries[0].Address)
+	assert.Equal(t, 1, summaries[0].PacketsTransmitted)
+	assert.Equal(t, 0, summaries[0].PacketsReceived)
+	assert.Equal(t, float64(100), summaries[0].PacketLossPercent)
+	assert.Nil(t, summaries[0].Rtt)
+	require.Len(t, summaries[0].Probes, 1)
+	assert.Equal(t, probeErrorReasonConnectionRefused, summaries[0].Probes[0].ErrorReason)
+}
+
+func TestRunPingCommand_Usage(t *testing.T) {
+	assert.Equal(t, cliExitUsage, runPingCommand([]string{}, &bytes.Buffer{}))
+	assert.Equal(t, cliExitUsage, runPingCommand([]string{"-c", "0", "www.google.com"}, &bytes.Buffer{}))
+	assert.Equal(t, cliExitUsage, runPingCommand([]string{"-unknown", "www.google.com"}, &bytes.Buffer{}))
+}
+
+func TestFormatPingSummary(t *testing.T) {
+	pingStats := getTestPingsStats()[0]
+	summary := getPingSummary(pingStats, 2012*time.Millisecond)
+
+	assert.Equal(t, "\n--- www.google.com:80 ping statistics ---\n"+
+		"3 packets transmitted, 2 received, 33.3333% packet loss, time 2012ms\n"+
+		"rtt min/avg/max/mdev = 10.500/11.375/12.250/0.875 ms\n", formatPingSummary(summary))
+}
+
+func TestFormatProbeLine(t *testing.T) {
+	probes := getTestPingsStats()[0].probes
+
+	assert.Equal(t, "Connected to www.google.com:80 (1.1.1.1): seq=1 time=10.500 ms", formatProbeLine(1, probes[0]))
+	assert.Equal(t, "No connection to www.google.com:80: seq=2 connection_refused: "+syscall.ECONNREFUSED.Error(), formatProbeLine(2, probes[1]))
+}
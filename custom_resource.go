@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/cfn"
+)
+
+const (
+	customResourcePhysicalResourceID = "MyPingResourceID"
+	smokeProbeCount                  = 1
+)
+
+// customResourceRun handles the CloudFormation custom resource events. Create and Update validate the configuration
+// and send a smoke probe to each address, without exporting anything. Delete always succeeds, so a broken configuration
+// never blocks the stack from being deleted or rolled back.
+func customResourceRun(ctx context.Context, event cfn.Event) (physicalResourceID string, data map[string]interface{}, err error) {
+	physicalResourceID = event.PhysicalResourceID
+	if physicalResourceID == "" {
+		physicalResourceID = customResourcePhysicalResourceID
+	}
+
+	infoLogger.Println("Handling custom resource", event.RequestType, "request of", event.LogicalResourceID)
+
+	switch event.RequestType {
+	case cfn.RequestCreate, cfn.RequestUpdate:
+		data, err = validateAndSmokeProbe(ctx)
+		if err != nil {
+			errorLogger.Println("Error validating the configuration:", err)
+		}
+
+		return physicalResourceID, data, err
+	case cfn.RequestDelete:
+		return physicalResourceID, nil, nil
+	default:
+		return physicalResourceID, nil, fmt.Errorf("unknown custom resource request type: %s", event.RequestType)
+	}
+}
+
+// validateAndSmokeProbe checks the configuration and probes each address once. An unreachable address is reported
+// in the data rather than failing the stack, since it can be down for reasons the stack has nothing to do with.
+// The exporters are not created, so the stack update doesn't bind their ports, dial their backends or open their files.
+func validateAndSmokeProbe(ctx context.Context) (map[string]interface{}, error) {
+	logzioPingStats, err := newUnexportedLogzioPingStatistics(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	if err = validateExporterNames(logzioPingStats.exporterNames); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	logzioPingStats.pingCount = smokeProbeCount
+	logzioPingStats.pingInterval = 0
+
+	reachable := make([]string, 0, len(logzioPingStats.addresses))
+	unreachable := make([]string, 0)
+
+	for _, address := range logzioPingStats.addresses {
+		pingStats, err := logzioPingStats.getAddressPingStatistics(address)
+		if err != nil || pingStats.successfulProbes == 0 {
+			unreachable = append(unreachable, address)
+			continue
+		}
+
+		reachable = append(reachable, address)
+	}
+
+	probeSummary := fmt.Sprintf("%d/%d targets reachable", len(reachable), len(logzioPingStats.addresses))
+	infoLogger.Println("Smoke probe:", probeSummary)
+
+	// Custom resource attributes are read with Fn::GetAtt, so the values are strings
+	return map[string]interface{}{
+		"Targets":            strings.Join(logzioPingStats.addresses, ","),
+		"TargetCount":        strconv.Itoa(len(logzioPingStats.addresses)),
+		"ReachableTargets":   strings.Join(reachable, ","),
+		"UnreachableTargets": strings.Join(unreachable, ","),
+		"ProbeSummary":       probeSummary,
+	}, nil
+}
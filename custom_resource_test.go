@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/cfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendCustomResourceEvent handles the event and returns the response that was sent to CloudFormation
+func sendCustomResourceEvent(t *testing.T, requestType cfn.RequestType) *cfn.Response {
+	responses := make(chan *cfn.Response, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		response := &cfn.Response{}
+		require.NoError(t, json.NewDecoder(request.Body).Decode(response))
+
+		responses <- response
+	}))
+
+	defer server.Close()
+
+	payload, err := json.Marshal(cfn.Event{
+		RequestType:       requestType,
+		RequestID:         "request-id",
+		ResponseURL:       server.URL,
+		StackID:           "stack-id",
+		LogicalResourceID: "PrimerInvoke",
+	})
+	require.NoError(t, err)
+
+	summary, err := HandleRequest(context.Background(), payload)
+	require.NoError(t, err)
+	assert.Nil(t, summary)
+
+	select {
+	case response := <-responses:
+		return response
+	default:
+		t.Fatal("no response was sent to CloudFormation")
+		return nil
+	}
+}
+
+func setCustomResourceTestEnvs(t *testing.T, addresses string) {
+	envs := map[string]string{
+		addressesEnvName:             addresses,
+		pingCountEnvName:             "3",
+		pingIntervalEnvName:          "1",
+		pingTimeoutEnvName:           "1",
+		logzioMetricsListenerEnvName: "https://listener.logz.io:8053",
+		logzioMetricsTokenEnvName:    "123456789a",
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+}
+
+func TestCustomResourceRun_Create(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	setCustomResourceTestEnvs(t, listener.Addr().String()+",127.0.0.1:1")
+	defer os.Clearenv()
+
+	start := time.Now()
+	response := sendCustomResourceEvent(t, cfn.RequestCreate)
+
+	// A single smoke probe is sent to each address, without waiting for the ping interval
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, cfn.StatusSuccess, response.Status)
+	assert.Equal(t, customResourcePhysicalResourceID, response.PhysicalResourceID)
+	assert.Equal(t, map[string]interface{}{
+		"Targets":            listener.Addr().String() + ",127.0.0.1:1",
+		"TargetCount":        "2",
+		"ReachableTargets":   listener.Addr().String(),
+		"UnreachableTargets": "127.0.0.1:1",
+		"ProbeSummary":       "1/2 targets reachable",
+	}, response.Data)
+}
+
+func TestCustomResourceRun_InvalidConfiguration(t *testing.T) {
+	setCustomResourceTestEnvs(t, "")
+	defer os.Clearenv()
+
+	for _, requestType := range []cfn.RequestType{cfn.RequestCreate, cfn.RequestUpdate} {
+		response := sendCustomResourceEvent(t, requestType)
+
+		assert.Equal(t, cfn.StatusFailed, response.Status)
+		assert.Contains(t, response.Reason, "invalid configuration")
+	}
+}
+
+func TestCustomResourceRun_DoesNotCreateExporters(t *testing.T) {
+	// The Prometheus exporter of the running function already has its port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	setCustomResourceTestEnvs(t, listener.Addr().String())
+	defer os.Clearenv()
+
+	require.NoError(t, os.Setenv(exportersEnvName, prometheusExporterName))
+	require.NoError(t, os.Setenv(prometheusListenAddressEnvName, listener.Addr().String()))
+
+	response := sendCustomResourceEvent(t, cfn.RequestCreate)
+	assert.Equal(t, cfn.StatusSuccess, response.Status, response.Reason)
+
+	require.NoError(t, os.Setenv(exportersEnvName, "prometheus,carrier-pigeon"))
+
+	response = sendCustomResourceEvent(t, cfn.RequestUpdate)
+	assert.Equal(t, cfn.StatusFailed, response.Status)
+	assert.Contains(t, response.Reason, "carrier-pigeon")
+}
+
+func TestCustomResourceRun_DeleteAlwaysSucceeds(t *testing.T) {
+	setCustomResourceTestEnvs(t, "")
+	defer os.Clearenv()
+
+	response := sendCustomResourceEvent(t, cfn.RequestDelete)
+
+	assert.Equal(t, cfn.StatusSuccess, response.Status)
+	assert.Nil(t, response.Data)
+}
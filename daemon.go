@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	runModeEnvName          = "RUN_MODE"
+	runModeLambda           = "lambda"
+	runModeDaemon           = "daemon"
+	daemonFlagName          = "daemon"
+	scheduleIntervalEnvName = "SCHEDULE_INTERVAL"
+	defaultScheduleInterval = 60 * time.Second
+)
+
+// runDaemon probes each address on its own schedule until it gets SIGTERM or SIGINT.
+// The exporters are created once, so their pipelines stay open for the process lifetime.
+func runDaemon(ctx context.Context) error {
+	scheduleInterval, err := getScheduleInterval()
+	if err != nil {
+		return err
+	}
+
+	scheduleJitter, err := getScheduleJitter()
+	if err != nil {
+		return err
+	}
+
+	logzioPingStats, err := newLogzioPingStatistics(ctx)
+	if err != nil {
+		return fmt.Errorf("error creating logzioPingStatistics instance: %v", err)
+	}
+
+	defer logzioPingStats.shutdownExporters()
+
+	schedules, err := getTargetSchedules(os.Getenv(targetSchedulesEnvName), logzioPingStats.addresses, scheduleInterval, scheduleJitter)
+	if err != nil {
+		return err
+	}
+
+	apiServer, err := newAPIServer(logzioPingStats, schedules)
+	if err != nil {
+		return err
+	}
+
+	if apiServer != nil {
+		defer func() {
+			if err := apiServer.shutdown(); err != nil {
+				errorLogger.Println("Error shutting down the API server:", err)
+			}
+		}()
+
+		logzioPingStats.cycleHandler = apiServer.recordCycle
+	}
+
+	// A signal cancels the running probes, and the results gathered so far are still exported with ctx
+	stopCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	logzioPingStats.ctx = stopCtx
+	logzioPingStats.exportCtx = ctx
+
+	infoLogger.Println("Starting daemon, probing", len(schedules), "addresses")
+
+	waitGroup := &sync.WaitGroup{}
+
+	for _, schedule := range schedules {
+		infoLogger.Println("Probing", schedule.address, "every", schedule.interval, "with start jitter up to", schedule.jitter)
+
+		waitGroup.Add(1)
+		go func(schedule *targetSchedule) {
+			defer waitGroup.Done()
+			logzioPingStats.runTargetSchedule(stopCtx, schedule)
+		}(schedule)
+	}
+
+	<-stopCtx.Done()
+	infoLogger.Println("Shutting down daemon, exporting the results of the running probe cycles...")
+
+	waitGroup.Wait()
+	return nil
+}
+
+func getScheduleInterval() (time.Duration, error) {
+	scheduleIntervalString := os.Getenv(scheduleIntervalEnvName)
+	if scheduleIntervalString == "" {
+		return defaultScheduleInterval, nil
+	}
+
+	scheduleInterval, err := getNumberEnvValue(scheduleIntervalString, scheduleIntervalEnvName)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(*scheduleInterval) * time.Second, nil
+}
+
+// getRunMode returns the run mode set by the daemon flag or by RUN_MODE, which defaults to lambda
+func getRunMode(daemonFlag bool) (string, error) {
+	if daemonFlag {
+		return runModeDaemon, nil
+	}
+
+	runMode := os.Getenv(runModeEnvName)
+	if runMode == "" {
+		return runModeLambda, nil
+	}
+
+	if runMode != runModeLambda && runMode != runModeDaemon {
+		return "", fmt.Errorf("%s must be %s or %s", runModeEnvName, runModeLambda, runModeDaemon)
+	}
+
+	return runMode, nil
+}
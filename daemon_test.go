@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRunMode(t *testing.T) {
+	runMode, err := getRunMode(false)
+	require.NoError(t, err)
+	assert.Equal(t, runModeLambda, runMode)
+
+	runMode, err = getRunMode(true)
+	require.NoError(t, err)
+	assert.Equal(t, runModeDaemon, runMode)
+
+	err = os.Setenv(runModeEnvName, runModeDaemon)
+	require.NoError(t, err)
+
+	runMode, err = getRunMode(false)
+	require.NoError(t, err)
+	assert.Equal(t, runModeDaemon, runMode)
+
+	err = os.Setenv(runModeEnvName, "server")
+	require.NoError(t, err)
+
+	_, err = getRunMode(false)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestGetScheduleInterval(t *testing.T) {
+	scheduleInterval, err := getScheduleInterval()
+	require.NoError(t, err)
+	assert.Equal(t, defaultScheduleInterval, scheduleInterval)
+
+	err = os.Setenv(scheduleIntervalEnvName, "5")
+	require.NoError(t, err)
+
+	scheduleInterval, err = getScheduleInterval()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, scheduleInterval)
+
+	err = os.Setenv(scheduleIntervalEnvName, "0")
+	require.NoError(t, err)
+
+	_, err = getScheduleInterval()
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestRunDaemon_ShutsDownOnSignal(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	probesPath := filepath.Join(t.TempDir(), "probes.jsonl")
+
+	envs := map[string]string{
+		addressesEnvName:        listener.Addr().String(),
+		pingCountEnvName:        "1",
+		pingIntervalEnvName:     "1",
+		pingTimeoutEnvName:      "1",
+		exportersEnvName:        probesExporterName,
+		probesOutputEnvName:     probesPath,
+		scheduleIntervalEnvName: "1",
+		disableSpoolEnvName:     "true",
+	}
+
+	for envName, envValue := range envs {
+		err = os.Setenv(envName, envValue)
+		require.NoError(t, err)
+	}
+
+	defer os.Clearenv()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(context.Background())
+	}()
+
+	time.Sleep(3500 * time.Millisecond)
+
+	err = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	require.NoError(t, err)
+
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("daemon did not shut down")
+	}
+
+	probes, err := os.ReadFile(probesPath)
+	require.NoError(t, err)
+
+	// Each cycle writes a record of its own, and the probes file is closed on shutdown
+	assert.GreaterOrEqual(t, len(strings.Split(strings.TrimSpace(string(probes)), "\n")), 2)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportMaxRetriesEnvName     = "EXPORT_MAX_RETRIES"
+	exportInitialBackoffEnvName = "EXPORT_INITIAL_BACKOFF"
+	spoolDirEnvName             = "SPOOL_DIR"
+	disableSpoolEnvName         = "DISABLE_SPOOL"
+	defaultExportMaxRetries     = 3
+	defaultExportInitialBackoff = 1 * time.Second
+	exportMaxBackoff            = 30 * time.Second
+	exportDeadlineMargin        = 1 * time.Second
+	defaultSpoolDirName         = "logzio-ping-statistics-spool"
+	spoolFileSuffix             = ".json"
+	spoolFilePermissions        = 0600
+	spoolDirPermissions         = 0700
+	spoolMaxAge                 = 24 * time.Hour
+	spoolMaxBatches             = 100
+)
+
+// httpStatusError is returned by exporters when a backend responds with an unexpected status
+type httpStatusError struct {
+	backend    string
+	statusCode int
+	status     string
+	body       string
+}
+
+func (hse *httpStatusError) Error() string {
+	if hse.body == "" {
+		return hse.backend + " responded with " + hse.status
+	}
+
+	return hse.backend + " responded with " + hse.status + ": " + hse.body
+}
+
+type deliveryConfig struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	spool          *spool
+}
+
+// spool keeps the batches that could not be delivered on disk, so they can be sent on a later run
+type spool struct {
+	dir string
+}
+
+type spooledBatch struct {
+	path       string
+	pingsStats []*pingStatistics
+}
+
+type spooledPingStatistics struct {
+	RunID            string                `json:"run_id"`
+	Address          string                `json:"address"`
+	Labels           map[string]string     `json:"labels,omitempty"`
+	ProbesSent       int                   `json:"probes_sent"`
+	SuccessfulProbes int                   `json:"successful_probes"`
+	ProbesFailed     int                   `json:"probes_failed"`
+	Rtts             []float64             `json:"rtts"`
+	Probes           []*spooledProbeResult `json:"probes"`
+	Truncated        bool                  `json:"truncated,omitempty"`
+	State            string                `json:"state,omitempty"`
+	StateTransition  *stateTransition      `json:"state_transition,omitempty"`
+	Maintenance      bool                  `json:"maintenance,omitempty"`
+}
+
+type spooledProbeResult struct {
+	Timestamp   time.Time `json:"timestamp"`
+	ResolvedIP  string    `json:"resolved_ip,omitempty"`
+	RTT         float64   `json:"rtt,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ErrorReason string    `json:"error_reason,omitempty"`
+}
+
+func newDeliveryConfig() (*deliveryConfig, error) {
+	config := &deliveryConfig{
+		maxRetries:     defaultExportMaxRetries,
+		initialBackoff: defaultExportInitialBackoff,
+	}
+
+	if maxRetriesString := os.Getenv(exportMaxRetriesEnvName); maxRetriesString != "" {
+		maxRetries, err := strconv.Atoi(maxRetriesString)
+		if err != nil || maxRetries < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", exportMaxRetriesEnvName)
+		}
+
+		config.maxRetries = maxRetries
+	}
+
+	if initialBackoffString := os.Getenv(exportInitialBackoffEnvName); initialBackoffString != "" {
+		initialBackoff, err := getNumberEnvValue(initialBackoffString, exportInitialBackoffEnvName)
+		if err != nil {
+			return nil, err
+		}
+
+		config.initialBackoff = time.Duration(*initialBackoff) * time.Second
+	}
+
+	disableSpool, err := getBoolEnvValue(os.Getenv(disableSpoolEnvName), disableSpoolEnvName)
+	if err != nil {
+		return nil, err
+	}
+
+	if disableSpool {
+		return config, nil
+	}
+
+	// In Lambda the temp dir is /tmp, the only writable path, which survives between warm invocations
+	spoolDir := os.Getenv(spoolDirEnvName)
+	if spoolDir == "" {
+		spoolDir = filepath.Join(os.TempDir(), defaultSpoolDirName)
+	}
+
+	if config.spool, err = newSpool(spoolDir); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// exportWithRetry exports the batch, retrying retryable errors with exponential backoff
+func (dc *deliveryConfig) exportWithRetry(ctx context.Context, exporter exporter, pingsStats []*pingStatistics) error {
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if err = exportBeforeDeadline(ctx, exporter, pingsStats); err == nil {
+			return nil
+		}
+
+		if attempt >= dc.maxRetries || !isRetryableError(err) || ctx.Err() != nil {
+			return err
+		}
+
+		backoff := getBackoff(dc.initialBackoff, attempt)
+
+		// A retry that would only start after the deadline would not get to finish anyway
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline.Add(-exportDeadlineMargin)) {
+			return err
+		}
+
+		errorLogger.Printf("Error exporting with %s exporter (attempt %d), retrying in %s: %v", exporter.name(), attempt+1, backoff, err)
+
+		if !sleepContext(ctx, backoff) {
+			return err
+		}
+	}
+}
+
+// exportBeforeDeadline exports the batch, and cuts the export short a moment before the context deadline
+// (the Lambda invocation deadline), so a slow backend leaves time to spool the batch. The exporter timeouts
+// can be longer than the time reserved for the export.
+func exportBeforeDeadline(ctx context.Context, exporter exporter, pingsStats []*pingStatistics) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return exporter.export(ctx, pingsStats)
+	}
+
+	exportCtx, cancel := context.WithDeadline(ctx, deadline.Add(-exportDeadlineMargin))
+	defer cancel()
+
+	return exporter.export(exportCtx, pingsStats)
+}
+
+// deliver exports the batch, spooling it for a later run if it still fails with a retryable error
+func (dc *deliveryConfig) deliver(ctx context.Context, exporter exporter, pingsStats []*pingStatistics) error {
+	err := dc.exportWithRetry(ctx, exporter, pingsStats)
+	if err == nil || dc.spool == nil || !isRetryableError(err) {
+		return err
+	}
+
+	if spoolErr := dc.spool.save(exporter.name(), pingsStats); spoolErr != nil {
+		return fmt.Errorf("%v (error spooling the batch: %v)", err, spoolErr)
+	}
+
+	return fmt.Errorf("%v (the batch was spooled for the next run)", err)
+}
+
+// sendSpooledBatches sends the batches an exporter failed to deliver on previous runs, oldest first
+func (dc *deliveryConfig) sendSpooledBatches(ctx context.Context, exporter exporter) {
+	if dc.spool == nil {
+		return
+	}
+
+	batches, err := dc.spool.load(exporter.name())
+	if err != nil {
+		errorLogger.Println("Error loading spooled batches of", exporter.name(), "exporter:", err)
+		return
+	}
+
+	for _, batch := range batches {
+		if err = exportBeforeDeadline(ctx, exporter, batch.pingsStats); err != nil {
+			if isRetryableError(err) {
+				errorLogger.Println("Error sending spooled batch", batch.path, "- keeping it for the next run:", err)
+				return
+			}
+
+			errorLogger.Println("Error sending spooled batch", batch.path, "- dropping it:", err)
+		} else {
+			infoLogger.Println("Sent spooled batch", batch.path)
+		}
+
+		if err = os.Remove(batch.path); err != nil {
+			errorLogger.Println("Error removing spooled batch", batch.path, ":", err)
+		}
+	}
+}
+
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode == http.StatusTooManyRequests || statusErr.statusCode >= http.StatusInternalServerError
+	}
+
+	// Certificate verification fails the same way on every attempt, although it's reported as a net.Error
+	if isCertificateError(err) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isCertificateError returns whether the error is a failure to verify the server's certificate
+func isCertificateError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var systemRootsErr x509.SystemRootsError
+
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &certificateInvalidErr) || errors.As(err, &systemRootsErr)
+}
+
+// getBackoff returns the exponential backoff of an attempt, with jitter so concurrent exporters don't retry together
+func getBackoff(initialBackoff time.Duration, attempt int) time.Duration {
+	backoff := initialBackoff << uint(attempt)
+	if backoff > exportMaxBackoff || backoff <= 0 {
+		backoff = exportMaxBackoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func newSpool(dir string) (*spool, error) {
+	if err := os.MkdirAll(dir, spoolDirPermissions); err != nil {
+		return nil, fmt.Errorf("error creating spool directory %s: %v", dir, err)
+	}
+
+	return &spool{dir: dir}, nil
+}
+
+func (s *spool) save(exporterName string, pingsStats []*pingStatistics) error {
+	spooledPingsStats := make([]*spooledPingStatistics, 0, len(pingsStats))
+	for _, pingStats := range pingsStats {
+		spooledPingsStats = append(spooledPingsStats, newSpooledPingStatistics(pingStats))
+	}
+
+	data, err := json.Marshal(spooledPingsStats)
+	if err != nil {
+		return fmt.Errorf("error marshaling batch: %v", err)
+	}
+
+	fileName := exporterName + "-" + strconv.FormatInt(time.Now().UnixNano(), 10) + spoolFileSuffix
+	tempPath := filepath.Join(s.dir, "."+fileName)
+
+	// The batch is renamed into place so a concurrent load never reads a partial file
+	if err = os.WriteFile(tempPath, data, spoolFilePermissions); err != nil {
+		return fmt.Errorf("error writing batch: %v", err)
+	}
+
+	return os.Rename(tempPath, filepath.Join(s.dir, fileName))
+}
+
+// load returns the spooled batches of an exporter, oldest first, dropping the expired and the excess ones
+func (s *spool) load(exporterName string) ([]*spooledBatch, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, exporterName+"-*"+spoolFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	if len(paths) > spoolMaxBatches {
+		for _, path := range paths[:len(paths)-spoolMaxBatches] {
+			errorLogger.Println("Dropping spooled batch over the limit:", path)
+			_ = os.Remove(path)
+		}
+
+		paths = paths[len(paths)-spoolMaxBatches:]
+	}
+
+	batches := make([]*spooledBatch, 0, len(paths))
+
+	for _, path := range paths {
+		batch, err := s.read(path)
+		if err != nil {
+			errorLogger.Println("Dropping unreadable spooled batch", path, ":", err)
+			_ = os.Remove(path)
+			continue
+		}
+
+		if batch == nil {
+			errorLogger.Println("Dropping expired spooled batch:", path)
+			_ = os.Remove(path)
+			continue
+		}
+
+		batches = append(batches, batch)
+	}
+
+	return batches, nil
+}
+
+// read returns the batch in the path, or nil if it is older than the spool max age
+func (s *spool) read(path string) (*spooledBatch, error) {
+	nameParts := strings.Split(strings.TrimSuffix(filepath.Base(path), spoolFileSuffix), "-")
+
+	spooledAt, err := strconv.ParseInt(nameParts[len(nameParts)-1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spool file name")
+	}
+
+	if time.Since(time.Unix(0, spooledAt)) > spoolMaxAge {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spooledPingsStats := make([]*spooledPingStatistics, 0)
+	if err = json.Unmarshal(data, &spooledPingsStats); err != nil {
+		return nil, err
+	}
+
+	batch := &spooledBatch{path: path, pingsStats: make([]*pingStatistics, 0, len(spooledPingsStats))}
+	for _, spooledPingStats := range spooledPingsStats {
+		batch.pingsStats = append(batch.pingsStats, spooledPingStats.toPingStatistics())
+	}
+
+	return batch, nil
+}
+
+func newSpooledPingStatistics(pingStats *pingStatistics) *spooledPingStatistics {
+	spooledPingStats := &spooledPingStatistics{
+		RunID:            pingStats.runID,
+		Address:          pingStats.address,
+		Labels:           pingStats.labels,
+		ProbesSent:       pingStats.probesSent,
+		SuccessfulProbes: pingStats.successfulProbes,
+		ProbesFailed:     pingStats.probesFailed,
+		Rtts:             pingStats.rtts,
+		Probes:           make([]*spooledProbeResult, 0, len(pingStats.probes)),
+		Truncated:        pingStats.truncated,
+		State:            pingStats.state,
+		StateTransition:  pingStats.stateTransition,
+		Maintenance:      pingStats.maintenance,
+	}
+
+	for _, probe := range pingStats.probes {
+		spooledProbe := &spooledProbeResult{
+			Timestamp:  probe.timestamp,
+			ResolvedIP: probe.resolvedIP,
+			RTT:        probe.rtt,
+		}
+
+		if probe.err != nil {
+			spooledProbe.Error = probe.err.Error()
+			spooledProbe.ErrorReason = probe.errorReason
+		}
+
+		spooledPingStats.Probes = append(spooledPingStats.Probes, spooledProbe)
+	}
+
+	return spooledPingStats
+}
+
+func (sps *spooledPingStatistics) toPingStatistics() *pingStatistics {
+	pingStats := &pingStatistics{
+		runID:            sps.RunID,
+		probesSent:       sps.ProbesSent,
+		successfulProbes: sps.SuccessfulProbes,
+		probesFailed:     sps.ProbesFailed,
+		address:          sps.Address,
+		labels:           sps.Labels,
+		rtts:             sps.Rtts,
+		probes:           make([]*probeResult, 0, len(sps.Probes)),
+		truncated:        sps.Truncated,
+		state:            sps.State,
+		stateTransition:  sps.StateTransition,
+		maintenance:      sps.Maintenance,
+	}
+
+	for _, spooledProbe := range sps.Probes {
+		probe := &probeResult{
+			timestamp:  spooledProbe.Timestamp,
+			address:    sps.Address,
+			resolvedIP: spooledProbe.ResolvedIP,
+			rtt:        spooledProbe.RTT,
+		}
+
+		if spooledProbe.Error != "" {
+			probe.err = errors.New(spooledProbe.Error)
+			probe.errorReason = spooledProbe.ErrorReason
+		}
+
+		pingStats.probes = append(pingStats.probes, probe)
+	}
+
+	return pingStats
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testExporter struct {
+	errs     []error
+	exported [][]*pingStatistics
+}
+
+func (te *testExporter) name() string {
+	return "test"
+}
+
+func (te *testExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	te.exported = append(te.exported, pingsStats)
+
+	if len(te.errs) == 0 {
+		return nil
+	}
+
+	err := te.errs[0]
+	te.errs = te.errs[1:]
+
+	return err
+}
+
+func (te *testExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, isRetryableError(&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"}))
+	assert.True(t, isRetryableError(&httpStatusError{statusCode: http.StatusTooManyRequests, status: "429 Too Many Requests"}))
+	assert.True(t, isRetryableError(fmt.Errorf("error sending bulk request: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})))
+	assert.False(t, isRetryableError(&httpStatusError{statusCode: http.StatusUnauthorized, status: "401 Unauthorized"}))
+	assert.False(t, isRetryableError(errors.New("502 probes were dropped")))
+	assert.False(t, isRetryableError(errors.New("error marshaling probe event")))
+	assert.False(t, isRetryableError(context.Canceled))
+	assert.False(t, isRetryableError(nil))
+}
+
+func TestIsRetryableError_CertificateErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The client doesn't trust the test server's certificate
+	_, err := http.Get(server.URL)
+	require.Error(t, err)
+	assert.False(t, isRetryableError(fmt.Errorf("error sending write request: %w", err)))
+
+	certificateErrs := []error{
+		x509.HostnameError{Certificate: server.Certificate(), Host: "www.example.com"},
+		x509.CertificateInvalidError{Cert: server.Certificate(), Reason: x509.Expired},
+	}
+
+	for _, certificateErr := range certificateErrs {
+		err = &url.Error{Op: "Post", URL: server.URL, Err: certificateErr}
+		assert.False(t, isRetryableError(err), err.Error())
+	}
+}
+
+func TestGetBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		backoff := getBackoff(time.Second, attempt)
+		maxBackoff := time.Second << uint(attempt)
+		if maxBackoff > exportMaxBackoff {
+			maxBackoff = exportMaxBackoff
+		}
+
+		assert.GreaterOrEqual(t, backoff, maxBackoff/2)
+		assert.LessOrEqual(t, backoff, maxBackoff)
+	}
+}
+
+func TestExportWithRetry_Success(t *testing.T) {
+	testExp := &testExporter{errs: []error{&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"}, &httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"}}}
+	delivery := &deliveryConfig{maxRetries: 3, initialBackoff: time.Millisecond}
+
+	err := delivery.exportWithRetry(context.Background(), testExp, getTestPingsStats())
+	require.NoError(t, err)
+
+	assert.Len(t, testExp.exported, 3)
+}
+
+func TestExportWithRetry_NotRetryable(t *testing.T) {
+	testExp := &testExporter{errs: []error{&httpStatusError{statusCode: http.StatusUnauthorized, status: "401 Unauthorized"}}}
+	delivery := &deliveryConfig{maxRetries: 3, initialBackoff: time.Millisecond}
+
+	err := delivery.exportWithRetry(context.Background(), testExp, getTestPingsStats())
+	require.Error(t, err)
+
+	assert.Len(t, testExp.exported, 1)
+}
+
+func TestExportWithRetry_RetriesExhausted(t *testing.T) {
+	testExp := &testExporter{errs: []error{
+		&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"},
+		&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"},
+		&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"},
+	}}
+	delivery := &deliveryConfig{maxRetries: 2, initialBackoff: time.Millisecond}
+
+	err := delivery.exportWithRetry(context.Background(), testExp, getTestPingsStats())
+	require.Error(t, err)
+
+	assert.Len(t, testExp.exported, 3)
+}
+
+func TestDeliver_SpoolAndResend(t *testing.T) {
+	testSpool, err := newSpool(t.TempDir())
+	require.NoError(t, err)
+
+	testExp := &testExporter{errs: []error{&httpStatusError{statusCode: http.StatusServiceUnavailable, status: "503 Service Unavailable"}}}
+	delivery := &deliveryConfig{spool: testSpool}
+
+	pingsStats := getTestPingsStats()
+	pingsStats[0].runID = "abc"
+	pingsStats[0].labels = map[string]string{"env": "prod"}
+	pingsStats[1].maintenance = true
+	pingsStats[1].state = targetStateDown
+	pingsStats[1].stateTransition = &stateTransition{Address: "listener.logz.io:8053", From: targetStateDegraded, To: targetStateDown}
+
+	err = delivery.deliver(context.Background(), testExp, pingsStats)
+	require.Error(t, err)
+
+	paths, err := filepath.Glob(filepath.Join(testSpool.dir, "test-*"+spoolFileSuffix))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+
+	delivery.sendSpooledBatches(context.Background(), testExp)
+	require.Len(t, testExp.exported, 2)
+
+	resent := testExp.exported[1]
+	require.Len(t, resent, 2)
+	assert.Equal(t, "abc", resent[0].runID)
+	assert.Equal(t, "prod", resent[0].labels["env"])
+	assert.Equal(t, pingsStats[0].rtts, resent[0].rtts)
+	assert.Equal(t, pingsStats[1].probesFailed, resent[1].probesFailed)
+	assert.True(t, testProbesTimestamp.Equal(resent[1].probes[0].timestamp))
+	assert.Equal(t, "dial tcp 3.3.3.3:8053: i/o timeout", resent[1].probes[0].err.Error())
+	assert.Equal(t, probeErrorReasonTimeout, resent[1].probes[0].errorReason)
+	assert.Equal(t, "listener.logz.io:8053", resent[1].probes[0].address)
+
+	// The replayed series keep their maintenance tag and state
+	assert.False(t, resent[0].maintenance)
+	assert.True(t, resent[1].maintenance)
+	assert.Equal(t, "true", resent[1].getLabels()[maintenanceLabelName])
+	assert.Equal(t, targetStateDown, resent[1].state)
+	assert.Equal(t, pingsStats[1].stateTransition, resent[1].stateTransition)
+
+	paths, err = filepath.Glob(filepath.Join(testSpool.dir, "test-*"+spoolFileSuffix))
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+// slowExporter takes until its context is done, like a backend that doesn't respond
+type slowExporter struct{}
+
+func (se *slowExporter) name() string {
+	return "slow"
+}
+
+func (se *slowExporter) export(ctx context.Context, _ []*pingStatistics) error {
+	<-ctx.Done()
+	return fmt.Errorf("error sending write request: %w", ctx.Err())
+}
+
+func (se *slowExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+func TestDeliver_SpoolsBeforeDeadline(t *testing.T) {
+	testSpool, err := newSpool(t.TempDir())
+	require.NoError(t, err)
+
+	delivery := &deliveryConfig{maxRetries: 3, initialBackoff: time.Millisecond, spool: testSpool}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportDeadlineMargin+200*time.Millisecond)
+	defer cancel()
+
+	// The export is cut short before the deadline, with time left to spool the batch
+	err = delivery.deliver(ctx, &slowExporter{}, getTestPingsStats())
+	require.Error(t, err)
+	assert.NoError(t, ctx.Err())
+
+	paths, err := filepath.Glob(filepath.Join(testSpool.dir, "slow-*"+spoolFileSuffix))
+	require.NoError(t, err)
+	assert.Len(t, paths, 1)
+}
+
+func TestDeliver_NotRetryableNotSpooled(t *testing.T) {
+	testSpool, err := newSpool(t.TempDir())
+	require.NoError(t, err)
+
+	testExp := &testExporter{errs: []error{&httpStatusError{statusCode: http.StatusUnauthorized, status: "401 Unauthorized"}}}
+	delivery := &deliveryConfig{spool: testSpool}
+
+	err = delivery.deliver(context.Background(), testExp, getTestPingsStats())
+	require.Error(t, err)
+
+	batches, err := testSpool.load(testExp.name())
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+}
+
+func TestSpoolLoad_DropsExpired(t *testing.T) {
+	testSpool, err := newSpool(t.TempDir())
+	require.NoError(t, err)
+
+	expiredAt := time.Now().Add(-spoolMaxAge - time.Hour).UnixNano()
+	expiredPath := filepath.Join(testSpool.dir, "test-"+strconv.FormatInt(expiredAt, 10)+spoolFileSuffix)
+	err = os.WriteFile(expiredPath, []byte("[]"), spoolFilePermissions)
+	require.NoError(t, err)
+
+	err = testSpool.save("test", getTestPingsStats())
+	require.NoError(t, err)
+
+	batches, err := testSpool.load("test")
+	require.NoError(t, err)
+	assert.Len(t, batches, 1)
+
+	_, err = os.Stat(expiredPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCollectMetrics_ContinuesAfterFailure(t *testing.T) {
+	failingExp := &testExporter{errs: []error{errors.New("error marshaling probe event")}}
+	succeedingExp := &testExporter{}
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:        context.Background(),
+		exporters:  []exporter{failingExp, succeedingExp},
+		pingsStats: getTestPingsStats(),
+	}
+
+	err := logzioPingStats.collectMetrics()
+	require.Error(t, err)
+
+	assert.Len(t, failingExp.exported, 1)
+	assert.Len(t, succeedingExp.exported, 1)
+}
+
+func TestNewDeliveryConfig_InvalidMaxRetries(t *testing.T) {
+	err := os.Setenv(exportMaxRetriesEnvName, "-1")
+	require.NoError(t, err)
+
+	_, err = newDeliveryConfig()
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestNewDeliveryConfig_Success(t *testing.T) {
+	spoolDir := filepath.Join(t.TempDir(), "spool")
+
+	err := os.Setenv(exportMaxRetriesEnvName, "0")
+	require.NoError(t, err)
+
+	err = os.Setenv(exportInitialBackoffEnvName, "2")
+	require.NoError(t, err)
+
+	err = os.Setenv(spoolDirEnvName, spoolDir)
+	require.NoError(t, err)
+
+	delivery, err := newDeliveryConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, delivery.maxRetries)
+	assert.Equal(t, 2*time.Second, delivery.initialBackoff)
+	require.NotNil(t, delivery.spool)
+	assert.DirExists(t, spoolDir)
+
+	os.Clearenv()
+}
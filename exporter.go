@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	logzioExporterName = "logzio"
+	stdoutExporterName = "stdout"
+)
+
+// exporter sends the ping statistics of a run to a metrics backend.
+type exporter interface {
+	name() string
+	export(ctx context.Context, pingsStats []*pingStatistics) error
+	shutdown(ctx context.Context) error
+}
+
+type exporterFactory func(lps *logzioPingStatistics) (exporter, error)
+
+var exporterFactories = map[string]exporterFactory{
+	stdoutExporterName:     newStdoutExporter,
+	otlpExporterName:       newOtlpExporter,
+	prometheusExporterName: newPrometheusExporter,
+	logzioLogsExporterName: newLogzioLogsExporter,
+	statsdExporterName:     newStatsdExporter,
+	probesExporterName:     newProbesExporter,
+	statusPageExporterName: newStatusPageExporter,
+	historyExporterName:    newHistoryExporter,
+}
+
+type metricPoint struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+var metricDescriptions = map[string]string{
+	rttMetricName:              "Ping RTT",
+	probesSentMetricName:       "Ping probes sent",
+	successfulProbesMetricName: "Ping successful probes",
+	probesFailedMetricName:     "Ping probes failed",
+	stateMetricName:            "Ping target state (0 down, 1 up, 2 degraded, 3 flapping)",
+}
+
+func (lps *logzioPingStatistics) createExporters() ([]exporter, error) {
+	exporterNames := lps.exporterNames
+	if len(exporterNames) == 0 {
+		exporterNames = []string{logzioExporterName}
+	}
+
+	exporters := make([]exporter, 0, len(exporterNames))
+
+	for _, exporterName := range exporterNames {
+		// The logzio exporter has an exporter per destination, so it has no single factory
+		if exporterName == logzioExporterName {
+			logzioExporters, err := lps.createLogzioExporters()
+			if err != nil {
+				return nil, fmt.Errorf("error creating %s exporter: %v", exporterName, err)
+			}
+
+			exporters = append(exporters, logzioExporters...)
+			continue
+		}
+
+		// The influxdb exporter has an exporter per output, so each is retried on its own
+		if exporterName == influxdbExporterName {
+			influxdbExporters, err := newInfluxdbExporters(lps)
+			if err != nil {
+				return nil, fmt.Errorf("error creating %s exporter: %v", exporterName, err)
+			}
+
+			exporters = append(exporters, influxdbExporters...)
+			continue
+		}
+
+		factory, ok := exporterFactories[exporterName]
+		if !ok {
+			return nil, fmt.Errorf("%s contains an unknown exporter: %s", exportersEnvName, exporterName)
+		}
+
+		exporter, err := factory(lps)
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s exporter: %v", exporterName, err)
+		}
+
+		exporters = append(exporters, exporter)
+	}
+
+	return exporters, nil
+}
+
+// validateExporterNames returns an error if an exporter name is unknown, without creating the exporters
+func validateExporterNames(exporterNames []string) error {
+	for _, exporterName := range exporterNames {
+		if exporterName == logzioExporterName || exporterName == influxdbExporterName {
+			continue
+		}
+
+		if _, ok := exporterFactories[exporterName]; !ok {
+			return fmt.Errorf("%s contains an unknown exporter: %s", exportersEnvName, exporterName)
+		}
+	}
+
+	return nil
+}
+
+func (lps *logzioPingStatistics) shutdownExporters() {
+	for _, exporter := range lps.exporters {
+		if err := exporter.shutdown(lps.getExportContext()); err != nil {
+			errorLogger.Println("Error shutting down", exporter.name(), "exporter:", err)
+		}
+	}
+
+	lps.exporters = nil
+}
+
+func getExporterNames(exportersString string) []string {
+	exporterNames := make([]string, 0)
+
+	for _, exporterName := range strings.Split(exportersString, ",") {
+		exporterName = strings.ToLower(strings.TrimSpace(exporterName))
+		if exporterName == "" {
+			continue
+		}
+
+		exporterNames = append(exporterNames, exporterName)
+	}
+
+	return exporterNames
+}
+
+// getResourceLabels returns the labels that identify the prober, which every exporter adds to its data
+func getResourceLabels() map[string]string {
+	resourceLabels := map[string]string{
+		awsRegionLabelName:         os.Getenv(awsRegionEnvName),
+		awsLambdaFunctionLabelName: os.Getenv(awsLambdaFunctionNameEnvName),
+	}
+
+	for labelName, labelValue := range getLocationLabels() {
+		resourceLabels[labelName] = labelValue
+	}
+
+	return resourceLabels
+}
+
+func getMetricPoints(pingsStats []*pingStatistics) []*metricPoint {
+	metricPoints := make([]*metricPoint, 0)
+
+	for _, pingStats := range pingsStats {
+		for index, rtt := range pingStats.rtts {
+			metricPoints = append(metricPoints, &metricPoint{
+				name: rttMetricName,
+				labels: mergeLabels(pingStats.getLabels(), map[string]string{
+					rttMetricRttIndexLabelName:  strconv.Itoa(index + 1),
+					rttMetricTotalRttsLabelName: strconv.Itoa(len(pingStats.rtts)),
+					unitLabelName:               rttMetricUnitLabelValue,
+				}),
+				value: rtt,
+			})
+		}
+
+		metricPoints = append(metricPoints,
+			&metricPoint{
+				name:   probesSentMetricName,
+				labels: pingStats.getLabels(),
+				value:  float64(pingStats.probesSent),
+			},
+			&metricPoint{
+				name:   successfulProbesMetricName,
+				labels: pingStats.getLabels(),
+				value:  float64(pingStats.successfulProbes),
+			},
+			&metricPoint{
+				name:   probesFailedMetricName,
+				labels: pingStats.getLabels(),
+				value:  float64(pingStats.probesFailed),
+			},
+		)
+
+		if statePoint := pingStats.getStateMetricPoint(); statePoint != nil {
+			metricPoints = append(metricPoints, statePoint)
+		}
+	}
+
+	return metricPoints
+}
+
+// getLabels returns the custom labels of the address together with the address label
+func (ps *pingStatistics) getLabels() map[string]string {
+	labels := mergeLabels(ps.labels, map[string]string{addressLabelName: ps.address})
+
+	// Results cut short by the invocation deadline are flagged, so they are not mistaken for a full run
+	if ps.truncated {
+		labels[truncatedLabelName] = strconv.FormatBool(true)
+	}
+
+	// Results of a maintenance window are tagged, so availability and SLO queries can leave them out
+	if ps.maintenance {
+		labels[maintenanceLabelName] = strconv.FormatBool(true)
+	}
+
+	return labels
+}
+
+func getMetricNames(metricPoints []*metricPoint) []string {
+	metricNames := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, point := range metricPoints {
+		if seen[point.name] {
+			continue
+		}
+
+		seen[point.name] = true
+		metricNames = append(metricNames, point.name)
+	}
+
+	return metricNames
+}
+
+func getSortedLabelNames(labels map[string]string) []string {
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+
+	sort.Strings(labelNames)
+	return labelNames
+}
+
+func mergeLabels(labelsMaps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+
+	for _, labels := range labelsMaps {
+		for labelName, labelValue := range labels {
+			merged[labelName] = labelValue
+		}
+	}
+
+	return merged
+}
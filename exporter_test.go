@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testProbesTimestamp = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func getTestPingsStats() []*pingStatistics {
+	timeoutErr := errors.New("dial tcp 3.3.3.3:8053: i/o timeout")
+
+	return []*pingStatistics{
+		{
+			probesSent:       3,
+			successfulProbes: 2,
+			probesFailed:     1,
+			address:          "www.google.com:80",
+			rtts:             []float64{10.5, 12.25},
+			probes: []*probeResult{
+				{timestamp: testProbesTimestamp, address: "www.google.com:80", resolvedIP: "1.1.1.1", rtt: 10.5},
+				{timestamp: testProbesTimestamp.Add(time.Second), address: "www.google.com:80", err: syscall.ECONNREFUSED, errorReason: probeErrorReasonConnectionRefused},
+				{timestamp: testProbesTimestamp.Add(2 * time.Second), address: "www.google.com:80", resolvedIP: "1.1.1.1", rtt: 12.25},
+			},
+		},
+		{
+			probesSent:       3,
+			successfulProbes: 0,
+			probesFailed:     3,
+			address:          "listener.logz.io:8053",
+			rtts:             []float64{},
+			probes: []*probeResult{
+				{timestamp: testProbesTimestamp, address: "listener.logz.io:8053", resolvedIP: "3.3.3.3", err: timeoutErr, errorReason: probeErrorReasonTimeout},
+				{timestamp: testProbesTimestamp.Add(time.Second), address: "listener.logz.io:8053", resolvedIP: "3.3.3.3", err: timeoutErr, errorReason: probeErrorReasonTimeout},
+				{timestamp: testProbesTimestamp.Add(2 * time.Second), address: "listener.logz.io:8053", resolvedIP: "3.3.3.3", err: timeoutErr, errorReason: probeErrorReasonTimeout},
+			},
+		},
+	}
+}
+
+func TestNewLogzioPingStatistics_Exporters(t *testing.T) {
+	err := os.Setenv(addressesEnvName, "www.google.com")
+	require.NoError(t, err)
+
+	err = os.Setenv(pingCountEnvName, "1")
+	require.NoError(t, err)
+
+	err = os.Setenv(pingIntervalEnvName, "1")
+	require.NoError(t, err)
+
+	err = os.Setenv(pingTimeoutEnvName, "1")
+	require.NoError(t, err)
+
+	err = os.Setenv(exportersEnvName, " Stdout ,")
+	require.NoError(t, err)
+
+	logzioPingStats, err := newLogzioPingStatistics(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{stdoutExporterName}, logzioPingStats.exporterNames)
+	require.Len(t, logzioPingStats.exporters, 1)
+	assert.Equal(t, stdoutExporterName, logzioPingStats.exporters[0].name())
+
+	os.Clearenv()
+}
+
+func TestNewLogzioPingStatistics_UnknownExporter(t *testing.T) {
+	err := os.Setenv(addressesEnvName, "www.google.com")
+	require.NoError(t, err)
+
+	err = os.Setenv(pingCountEnvName, "1")
+	require.NoError(t, err)
+
+	err = os.Setenv(pingIntervalEnvName, "1")
+	require.NoError(t, err)
+
+	err = os.Setenv(pingTimeoutEnvName, "1")
+	require.NoError(t, err)
+
+	err = os.Setenv(exportersEnvName, "stdout,unknown")
+	require.NoError(t, err)
+
+	_, err = newLogzioPingStatistics(context.Background())
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestGetMetricPoints_Success(t *testing.T) {
+	metricPoints := getMetricPoints(getTestPingsStats())
+
+	assert.Len(t, metricPoints, 8)
+	assert.Equal(t, []string{rttMetricName, probesSentMetricName, successfulProbesMetricName, probesFailedMetricName}, getMetricNames(metricPoints))
+
+	assert.Equal(t, 12.25, metricPoints[1].value)
+	assert.Equal(t, "2", metricPoints[1].labels[rttMetricRttIndexLabelName])
+	assert.Equal(t, "2", metricPoints[1].labels[rttMetricTotalRttsLabelName])
+	assert.Equal(t, float64(3), metricPoints[7].value)
+	assert.Equal(t, "listener.logz.io:8053", metricPoints[7].labels[addressLabelName])
+}
+
+func TestStdoutExporter_Export(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	stdoutExp := &stdoutExporter{
+		writer:         buffer,
+		resourceLabels: map[string]string{awsRegionLabelName: "us-east-1"},
+	}
+
+	err := stdoutExp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 8)
+
+	assert.Equal(t, `ping_stats_rtt{address="www.google.com:80",aws_region="us-east-1",rtt_index="1",total_rtts="2",unit="milliseconds"} 10.5`, lines[0])
+	assert.Equal(t, `ping_stats_probes_failed{address="listener.logz.io:8053",aws_region="us-east-1"} 3`, lines[7])
+}
+
+func TestLogzioExporter_Export(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://listener.logz.io:8053",
+		func(request *http.Request) (*http.Response, error) {
+			assert.Equal(t, "Bearer 123456789a", request.Header.Get("Authorization"))
+
+			metrics, err := getMetrics(request)
+			require.NoError(t, err)
+
+			assert.Len(t, metrics, 8)
+			return httpmock.NewStringResponse(http.StatusOK, ""), nil
+		})
+
+	logzioExp := &logzioExporter{
+		logzioMetricsListener: "https://listener.logz.io:8053",
+		logzioMetricsToken:    "123456789a",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := logzioExp.export(ctx, getTestPingsStats())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestLogzioExporter_ErrorResponse(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://listener.logz.io:8053",
+		httpmock.NewStringResponder(http.StatusUnauthorized, "invalid token"))
+
+	logzioExp := &logzioExporter{
+		logzioMetricsListener: "https://listener.logz.io:8053",
+		logzioMetricsToken:    "123456789a",
+	}
+
+	err := logzioExp.export(context.Background(), getTestPingsStats())
+	require.Error(t, err)
+
+	assert.Equal(t, "metrics listener responded with 401: invalid token", err.Error())
+	assert.False(t, isRetryableError(err))
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyCommandName        = "history"
+	historyDBFlagName         = "db"
+	historyFromFlagName       = "from"
+	historyToFlagName         = "to"
+	historyJSONFlagName       = "json"
+	defaultHistoryQueryPeriod = "24h"
+	historyTimeLayout         = time.RFC3339
+)
+
+// historySummary is the JSON output of the history command for an address
+type historySummary struct {
+	Address     string          `json:"address"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Probes      int             `json:"probes"`
+	Successful  int             `json:"successful"`
+	Failed      int             `json:"failed"`
+	LossPercent float64         `json:"loss_percent"`
+	Maintenance int             `json:"maintenance_probes"`
+	Rtt         *historyRtt     `json:"rtt,omitempty"`
+	Outages     []*outagePeriod `json:"outages"`
+}
+
+type historyRtt struct {
+	Min float64 `json:"min_ms"`
+	Avg float64 `json:"avg_ms"`
+	Max float64 `json:"max_ms"`
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+// outagePeriod is a run of consecutive failed probes. It ends at the next successful probe,
+// or at the last failed probe while it is ongoing.
+type outagePeriod struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	FailedProbes int       `json:"failed_probes"`
+	Ongoing      bool      `json:"ongoing"`
+}
+
+// runHistoryCommand prints the loss, RTT percentiles and outages of the addresses given as arguments, or of all the
+// addresses in the history, from the history store. It returns the exit code: 0 on success, 1 on error and 2 on bad usage.
+func runHistoryCommand(args []string, output io.Writer, now time.Time) int {
+	flags := flag.NewFlagSet(historyCommandName, flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(output, "Usage: %s %s [-db path] [-from time] [-to time] [-json] [address...]\n", filepath.Base(os.Args[0]), historyCommandName)
+		flags.PrintDefaults()
+	}
+
+	dbPath := flags.String(historyDBFlagName, getHistoryPath(), "The path of the history database")
+	fromString := flags.String(historyFromFlagName, defaultHistoryQueryPeriod, "The start of the period, as an RFC 3339 time or a duration before now, like 90m")
+	toString := flags.String(historyToFlagName, "", "The end of the period, as an RFC 3339 time or a duration before now (default now)")
+	jsonOutput := flags.Bool(historyJSONFlagName, false, "Print a JSON summary instead of text")
+
+	if err := flags.Parse(args); err != nil {
+		return cliExitUsage
+	}
+
+	from, err := parseHistoryTime(*fromString, now)
+	if err != nil {
+		_, _ = fmt.Fprintln(output, "Invalid -from:", err)
+		return cliExitUsage
+	}
+
+	to := now
+	if *toString != "" {
+		if to, err = parseHistoryTime(*toString, now); err != nil {
+			_, _ = fmt.Fprintln(output, "Invalid -to:", err)
+			return cliExitUsage
+		}
+	}
+
+	if !from.Before(to) {
+		_, _ = fmt.Fprintln(output, "-from must be before -to")
+		return cliExitUsage
+	}
+
+	addresses := make([]string, 0)
+	if flags.NArg() > 0 {
+		addresses = getAddresses(strings.Join(flags.Args(), ","))
+	}
+
+	records, err := queryHistory(*dbPath, addresses, from, to)
+	if err != nil {
+		_, _ = fmt.Fprintln(output, err)
+		return cliExitNoReply
+	}
+
+	if len(addresses) == 0 {
+		addresses = getSortedRecordAddresses(records)
+	}
+
+	summaries := make([]*historySummary, 0, len(addresses))
+	for _, address := range addresses {
+		summaries = append(summaries, getHistorySummary(address, from, to, records[address]))
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+
+		if err = encoder.Encode(summaries); err != nil {
+			_, _ = fmt.Fprintln(output, "Error writing JSON summary:", err)
+			return cliExitNoReply
+		}
+
+		return cliExitSuccess
+	}
+
+	if len(summaries) == 0 {
+		_, _ = fmt.Fprintln(output, "No probes in the history")
+	}
+
+	for index, summary := range summaries {
+		if index > 0 {
+			_, _ = fmt.Fprintln(output)
+		}
+
+		_, _ = fmt.Fprint(output, formatHistorySummary(summary))
+	}
+
+	return cliExitSuccess
+}
+
+// parseHistoryTime parses an RFC 3339 time, or a duration before now
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+
+	return time.Parse(historyTimeLayout, value)
+}
+
+func getSortedRecordAddresses(records map[string][]*probeRecord) []string {
+	addresses := make([]string, 0, len(records))
+	for address := range records {
+		addresses = append(addresses, address)
+	}
+
+	sort.Strings(addresses)
+	return addresses
+}
+
+func getHistorySummary(address string, from time.Time, to time.Time, records []*probeRecord) *historySummary {
+	summary := &historySummary{
+		Address: address,
+		From:    from.UTC(),
+		To:      to.UTC(),
+		Outages: make([]*outagePeriod, 0),
+	}
+
+	rtts := make([]float64, 0, len(records))
+	var outage *outagePeriod
+
+	for _, record := range records {
+		// Probes of a maintenance window count neither towards the loss nor the outages
+		if record.Maintenance {
+			summary.Maintenance++
+			continue
+		}
+
+		summary.Probes++
+		timestamp, _ := time.Parse(probeRecordTimeLayout, record.Timestamp)
+
+		if record.Success {
+			summary.Successful++
+
+			if record.RTT != nil {
+				rtts = append(rtts, *record.RTT)
+			}
+
+			if outage != nil {
+				outage.End = timestamp
+				outage.Ongoing = false
+				outage = nil
+			}
+
+			continue
+		}
+
+		summary.Failed++
+
+		if outage == nil {
+			outage = &outagePeriod{Start: timestamp, Ongoing: true}
+			summary.Outages = append(summary.Outages, outage)
+		}
+
+		outage.End = timestamp
+		outage.FailedProbes++
+	}
+
+	if summary.Probes > 0 {
+		summary.LossPercent = float64(summary.Failed) * 100 / float64(summary.Probes)
+	}
+
+	if rttStats := getRttStatistics(rtts); rttStats != nil {
+		summary.Rtt = &historyRtt{
+			Min: rttStats.min,
+			Avg: rttStats.avg,
+			Max: rttStats.max,
+			P50: getRttPercentile(rtts, 50),
+			P90: getRttPercentile(rtts, 90),
+			P99: getRttPercentile(rtts, 99),
+		}
+	}
+
+	return summary
+}
+
+func formatHistorySummary(summary *historySummary) string {
+	builder := &strings.Builder{}
+
+	_, _ = fmt.Fprintf(builder, "--- %s history from %s to %s ---\n", summary.Address,
+		summary.From.Format(historyTimeLayout), summary.To.Format(historyTimeLayout))
+	_, _ = fmt.Fprintf(builder, "%d probes, %d successful, %s%% loss",
+		summary.Probes, summary.Successful, strconv.FormatFloat(summary.LossPercent, 'g', 6, 64))
+
+	if summary.Maintenance > 0 {
+		_, _ = fmt.Fprintf(builder, " (%d probes in maintenance excluded)", summary.Maintenance)
+	}
+
+	builder.WriteString("\n")
+
+	if summary.Rtt != nil {
+		_, _ = fmt.Fprintf(builder, "rtt min/avg/max = %s/%s/%s ms, p50/p90/p99 = %s/%s/%s ms\n",
+			formatCLIRtt(summary.Rtt.Min), formatCLIRtt(summary.Rtt.Avg), formatCLIRtt(summary.Rtt.Max),
+			formatCLIRtt(summary.Rtt.P50), formatCLIRtt(summary.Rtt.P90), formatCLIRtt(summary.Rtt.P99))
+	}
+
+	if len(summary.Outages) == 0 {
+		builder.WriteString("no outages\n")
+		return builder.String()
+	}
+
+	_, _ = fmt.Fprintf(builder, "%d outages:\n", len(summary.Outages))
+
+	for _, outage := range summary.Outages {
+		end := outage.End.Format(historyTimeLayout)
+		if outage.Ongoing {
+			end = "ongoing, last failed " + end
+		}
+
+		_, _ = fmt.Fprintf(builder, "  %s - %s (%s, %d failed probes)\n", outage.Start.Format(historyTimeLayout), end,
+			outage.End.Sub(outage.Start), outage.FailedProbes)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHistoryCommand(t *testing.T) {
+	store := newTestHistoryStore(t)
+	require.NoError(t, store.add(getTestPingsStats()))
+
+	now := testProbesTimestamp.Add(time.Hour)
+
+	output := &bytes.Buffer{}
+	exitCode := runHistoryCommand([]string{"-db", store.path, "-from", "2h", "www.google.com"}, output, now)
+	assert.Equal(t, cliExitSuccess, exitCode)
+
+	assert.Equal(t, strings.Join([]string{
+		"--- www.google.com:80 history from 2022-03-01T11:00:00Z to 2022-03-01T13:00:00Z ---",
+		"3 probes, 2 successful, 33.3333% loss",
+		"rtt min/avg/max = 10.500/11.375/12.250 ms, p50/p90/p99 = 10.500/12.250/12.250 ms",
+		"1 outages:",
+		"  2022-03-01T12:00:01Z - 2022-03-01T12:00:02Z (1s, 1 failed probes)",
+		"",
+	}, "\n"), output.String())
+
+	output.Reset()
+	exitCode = runHistoryCommand([]string{"-db", store.path, "-from", "2022-03-01T12:00:00Z", "-to", "30m", "-json"}, output, now)
+	assert.Equal(t, cliExitSuccess, exitCode)
+
+	summaries := make([]*historySummary, 0)
+	require.NoError(t, json.Unmarshal(output.Bytes(), &summaries))
+	require.Len(t, summaries, 2)
+
+	listener := summaries[0]
+	assert.Equal(t, "listener.logz.io:8053", listener.Address)
+	assert.Equal(t, float64(100), listener.LossPercent)
+	assert.Nil(t, listener.Rtt)
+	require.Len(t, listener.Outages, 1)
+	assert.True(t, listener.Outages[0].Ongoing)
+	assert.Equal(t, 3, listener.Outages[0].FailedProbes)
+	assert.Equal(t, testProbesTimestamp.Add(2*time.Second), listener.Outages[0].End)
+	assert.Equal(t, "www.google.com:80", summaries[1].Address)
+}
+
+func TestRunHistoryCommand_Usage(t *testing.T) {
+	output := &bytes.Buffer{}
+
+	assert.Equal(t, cliExitUsage, runHistoryCommand([]string{"-from", "yesterday"}, output, time.Now()))
+	assert.Equal(t, cliExitUsage, runHistoryCommand([]string{"-from", "1h", "-to", "2h"}, output, time.Now()))
+	assert.Equal(t, cliExitNoReply, runHistoryCommand([]string{"-db", t.TempDir() + "/missing.db"}, output, time.Now()))
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	historyExporterName                = "history"
+	historyPathEnvName                 = "HISTORY_PATH"
+	historyRetentionDaysEnvName        = "HISTORY_RETENTION_DAYS"
+	historyCompactIntervalHoursEnvName = "HISTORY_COMPACT_INTERVAL_HOURS"
+	defaultHistoryFileName             = "history.db"
+	defaultHistoryRetentionDays        = 30
+	defaultHistoryCompactIntervalHours = 24
+	historyPruneInterval               = time.Minute
+	historyLockTimeout                 = 5 * time.Second
+	historyCompactTxMaxSize            = 1 << 16
+	historyFilePermissions             = 0600
+)
+
+// historyProbesBucket has a bucket per address, with the probe records keyed by their timestamps
+var historyProbesBucket = []byte("probes")
+
+// historyStore keeps every probe result in a bbolt database, for querying incidents offline with the history command.
+// The database is opened for each write only, so the command can read it while the daemon is running.
+type historyStore struct {
+	path            string
+	retention       time.Duration
+	compactInterval time.Duration
+	prunedAt        time.Time
+	compactedAt     time.Time
+	lock            sync.Mutex
+}
+
+// historyExporter records the results of each run in the history store
+type historyExporter struct {
+	store *historyStore
+}
+
+func newHistoryExporter(_ *logzioPingStatistics) (exporter, error) {
+	store, err := newHistoryStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return &historyExporter{store: store}, nil
+}
+
+func (he *historyExporter) name() string {
+	return historyExporterName
+}
+
+func (he *historyExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	return he.store.add(pingsStats)
+}
+
+func (he *historyExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+// newHistoryStore returns the store of HISTORY_PATH, and compacts the database if it already exists
+func newHistoryStore() (*historyStore, error) {
+	hs := &historyStore{
+		path:            getHistoryPath(),
+		retention:       defaultHistoryRetentionDays * 24 * time.Hour,
+		compactInterval: defaultHistoryCompactIntervalHours * time.Hour,
+	}
+
+	if retentionDaysString := os.Getenv(historyRetentionDaysEnvName); retentionDaysString != "" {
+		retentionDays, err := getNumberEnvValue(retentionDaysString, historyRetentionDaysEnvName)
+		if err != nil {
+			return nil, err
+		}
+
+		hs.retention = time.Duration(*retentionDays) * 24 * time.Hour
+	}
+
+	if compactIntervalString := os.Getenv(historyCompactIntervalHoursEnvName); compactIntervalString != "" {
+		compactIntervalHours, err := getNumberEnvValue(compactIntervalString, historyCompactIntervalHoursEnvName)
+		if err != nil {
+			return nil, err
+		}
+
+		hs.compactInterval = time.Duration(*compactIntervalHours) * time.Hour
+	}
+
+	if err := os.MkdirAll(filepath.Dir(hs.path), stateDirPermissions); err != nil {
+		return nil, fmt.Errorf("error creating history dir: %v", err)
+	}
+
+	if _, err := os.Stat(hs.path); err == nil {
+		if err = hs.prune(time.Now()); err != nil {
+			return nil, err
+		}
+
+		if err = hs.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	hs.prunedAt = time.Now()
+	hs.compactedAt = time.Now()
+
+	return hs, nil
+}
+
+// getHistoryPath returns HISTORY_PATH, or history.db in STATE_DIR, or in the temp dir if the state is in a bucket
+func getHistoryPath() string {
+	if historyPath := os.Getenv(historyPathEnvName); historyPath != "" {
+		return historyPath
+	}
+
+	stateDir := getStateDir()
+	if strings.HasPrefix(stateDir, s3OutputPrefix) {
+		stateDir = filepath.Join(os.TempDir(), defaultStateDirName)
+	}
+
+	return filepath.Join(stateDir, defaultHistoryFileName)
+}
+
+func openHistoryDB(path string, readOnly bool) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, historyFilePermissions, &bbolt.Options{Timeout: historyLockTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("error opening history %s: %v", path, err)
+	}
+
+	return db, nil
+}
+
+// add records the probes of the results, then removes the probes older than the retention and compacts the database when they are due
+func (hs *historyStore) add(pingsStats []*pingStatistics) error {
+	// The daemon exports each target as its probes are done, and bbolt allows a single writer
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	db, err := openHistoryDB(hs.path, false)
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		probesBucket, err := tx.CreateBucketIfNotExists(historyProbesBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, pingStats := range pingsStats {
+			if len(pingStats.probes) == 0 {
+				continue
+			}
+
+			addressBucket, err := probesBucket.CreateBucketIfNotExists([]byte(pingStats.address))
+			if err != nil {
+				return err
+			}
+
+			for _, probe := range pingStats.probes {
+				record, err := json.Marshal(getProbeRecord(pingStats, probe))
+				if err != nil {
+					return err
+				}
+
+				// Probes of the same address never share a timestamp, unless the clock goes back
+				timestamp := probe.timestamp.UnixNano()
+				for addressBucket.Get(getHistoryKey(timestamp)) != nil {
+					timestamp++
+				}
+
+				if err = addressBucket.Put(getHistoryKey(timestamp), record); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("error adding to history: %v", err)
+	}
+
+	if time.Since(hs.prunedAt) >= historyPruneInterval {
+		if err = hs.prune(time.Now()); err != nil {
+			return err
+		}
+
+		hs.prunedAt = time.Now()
+	}
+
+	if time.Since(hs.compactedAt) >= hs.compactInterval {
+		if err = hs.compact(); err != nil {
+			return err
+		}
+
+		hs.compactedAt = time.Now()
+	}
+
+	return nil
+}
+
+// prune removes the probes older than the retention, and the addresses left without probes
+func (hs *historyStore) prune(now time.Time) error {
+	db, err := openHistoryDB(hs.path, false)
+	if err != nil {
+		return err
+	}
+
+	cutoffKey := getHistoryKey(now.Add(-hs.retention).UnixNano())
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		probesBucket := tx.Bucket(historyProbesBucket)
+		if probesBucket == nil {
+			return nil
+		}
+
+		emptyAddresses := make([][]byte, 0)
+
+		err := probesBucket.ForEach(func(address []byte, _ []byte) error {
+			addressBucket := probesBucket.Bucket(address)
+			cursor := addressBucket.Cursor()
+
+			for key, _ := cursor.First(); key != nil && bytes.Compare(key, cutoffKey) < 0; key, _ = cursor.First() {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+
+			if key, _ := cursor.First(); key == nil {
+				emptyAddresses = append(emptyAddresses, append([]byte{}, address...))
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, address := range emptyAddresses {
+			if err = probesBucket.DeleteBucket(address); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("error pruning history: %v", err)
+	}
+
+	return nil
+}
+
+// compact rewrites the database into a new file, since bbolt reuses the pages of removed probes but never shrinks its file
+func (hs *historyStore) compact() error {
+	compactPath := hs.path + ".compact"
+
+	err := func() error {
+		src, err := openHistoryDB(hs.path, false)
+		if err != nil {
+			return err
+		}
+
+		defer func(src *bbolt.DB) {
+			_ = src.Close()
+		}(src)
+
+		dst, err := openHistoryDB(compactPath, false)
+		if err != nil {
+			return err
+		}
+
+		if err = bbolt.Compact(dst, src, historyCompactTxMaxSize); err != nil {
+			_ = dst.Close()
+			return err
+		}
+
+		if err = dst.Close(); err != nil {
+			return err
+		}
+
+		// The source is still locked, so a reader never opens a half-compacted file
+		return os.Rename(compactPath, hs.path)
+	}()
+
+	if err != nil {
+		_ = os.Remove(compactPath)
+		return fmt.Errorf("error compacting history: %v", err)
+	}
+
+	return nil
+}
+
+// queryHistory returns the probe records of the addresses, or of all of them if there are none,
+// from from (inclusive) to to (exclusive), by address
+func queryHistory(path string, addresses []string, from time.Time, to time.Time) (map[string][]*probeRecord, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error opening history %s: %v", path, err)
+	}
+
+	db, err := openHistoryDB(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(db *bbolt.DB) {
+		_ = db.Close()
+	}(db)
+
+	records := make(map[string][]*probeRecord)
+
+	err = db.View(func(tx *bbolt.Tx) error {
+		probesBucket := tx.Bucket(historyProbesBucket)
+		if probesBucket == nil {
+			return nil
+		}
+
+		if len(addresses) == 0 {
+			if err := probesBucket.ForEach(func(address []byte, _ []byte) error {
+				addresses = append(addresses, string(address))
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			sort.Strings(addresses)
+		}
+
+		// Times before 1970 have no key
+		if from.Before(time.Unix(0, 0)) {
+			from = time.Unix(0, 0)
+		}
+
+		fromKey := getHistoryKey(from.UnixNano())
+		toKey := getHistoryKey(to.UnixNano())
+
+		for _, address := range addresses {
+			addressRecords := make([]*probeRecord, 0)
+
+			if addressBucket := probesBucket.Bucket([]byte(address)); addressBucket != nil {
+				cursor := addressBucket.Cursor()
+
+				for key, value := cursor.Seek(fromKey); key != nil && bytes.Compare(key, toKey) < 0; key, value = cursor.Next() {
+					record := &probeRecord{}
+					if err := json.Unmarshal(value, record); err != nil {
+						return fmt.Errorf("error parsing probe record of %s: %v", address, err)
+					}
+
+					addressRecords = append(addressRecords, record)
+				}
+			}
+
+			records[address] = addressRecords
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %v", err)
+	}
+
+	return records, nil
+}
+
+// getHistoryKey returns the key of a timestamp, which sorts the probes by time
+func getHistoryKey(unixNano int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(unixNano))
+
+	return key
+}
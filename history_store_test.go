@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHistoryStore(t *testing.T) *historyStore {
+	err := os.Setenv(historyPathEnvName, filepath.Join(t.TempDir(), "history", "history.db"))
+	require.NoError(t, err)
+
+	defer os.Clearenv()
+
+	store, err := newHistoryStore()
+	require.NoError(t, err)
+
+	return store
+}
+
+func TestNewHistoryStore_Invalid(t *testing.T) {
+	defer os.Clearenv()
+
+	require.NoError(t, os.Setenv(historyPathEnvName, filepath.Join(t.TempDir(), "history.db")))
+	require.NoError(t, os.Setenv(historyRetentionDaysEnvName, "0"))
+
+	_, err := newHistoryStore()
+	assert.Error(t, err)
+}
+
+func TestHistoryStore_AddAndQuery(t *testing.T) {
+	store := newTestHistoryStore(t)
+
+	require.NoError(t, store.add(getTestPingsStats()))
+	// The same probes again get timestamps of their own
+	require.NoError(t, store.add(getTestPingsStats()[:1]))
+
+	records, err := queryHistory(store.path, nil, testProbesTimestamp, testProbesTimestamp.Add(2*time.Second))
+	require.NoError(t, err)
+
+	require.Len(t, records, 2)
+	require.Len(t, records["www.google.com:80"], 4)
+	assert.Len(t, records["listener.logz.io:8053"], 2)
+
+	google := records["www.google.com:80"]
+	assert.True(t, google[0].Success)
+	assert.Equal(t, 10.5, *google[0].RTT)
+	assert.False(t, google[2].Success)
+	assert.Equal(t, probeErrorReasonConnectionRefused, google[2].ErrorReason)
+
+	records, err = queryHistory(store.path, []string{"listener.logz.io:8053", "www.example.com:80"}, testProbesTimestamp, testProbesTimestamp.Add(time.Hour))
+	require.NoError(t, err)
+
+	assert.Len(t, records["listener.logz.io:8053"], 3)
+	assert.Empty(t, records["www.example.com:80"])
+
+	_, err = queryHistory(filepath.Join(t.TempDir(), "missing.db"), nil, testProbesTimestamp, testProbesTimestamp.Add(time.Hour))
+	assert.Error(t, err)
+}
+
+func TestHistoryStore_PruneAndCompact(t *testing.T) {
+	store := newTestHistoryStore(t)
+	store.retention = 24 * time.Hour
+
+	pingsStats := getTestPingsStats()
+	for _, probe := range pingsStats[1].probes {
+		probe.timestamp = time.Now().Add(-time.Hour)
+	}
+
+	require.NoError(t, store.add(pingsStats))
+	require.NoError(t, store.prune(time.Now()))
+
+	records, err := queryHistory(store.path, nil, time.Time{}, time.Now())
+	require.NoError(t, err)
+
+	// The probes of 2022 are past the retention, and their address is gone with them
+	assert.Equal(t, []string{"listener.logz.io:8053"}, getSortedRecordAddresses(records))
+	assert.Len(t, records["listener.logz.io:8053"], 3)
+
+	require.NoError(t, store.compact())
+
+	records, err = queryHistory(store.path, nil, time.Time{}, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, records["listener.logz.io:8053"], 3)
+
+	_, err = os.Stat(store.path + ".compact")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	influxdbExporterName       = "influxdb"
+	influxdbFileExporterName   = influxdbExporterName + ".file"
+	influxdbURLEnvName         = "INFLUXDB_URL"
+	influxdbOrgEnvName         = "INFLUXDB_ORG"
+	influxdbBucketEnvName      = "INFLUXDB_BUCKET"
+	influxdbTokenEnvName       = "INFLUXDB_TOKEN"
+	influxdbFileEnvName        = "INFLUXDB_FILE"
+	influxdbWritePath          = "/api/v2/write"
+	influxdbTimeout            = 30 * time.Second
+	influxdbSummaryMeasurement = meterName
+	influxdbProbeMeasurement   = meterName + "_probe"
+	resolvedIPTagName          = "resolved_ip"
+	errorReasonTagName         = "error_reason"
+	rttMinFieldName            = "rtt_min"
+	rttAvgFieldName            = "rtt_avg"
+	rttMaxFieldName            = "rtt_max"
+	rttMdevFieldName           = "rtt_mdev"
+	rttFieldName               = "rtt"
+	successFieldName           = "success"
+	probesSentFieldName        = "probes_sent"
+	successfulProbesFieldName  = "successful_probes"
+	probesFailedFieldName      = "probes_failed"
+	stateFieldName             = "state"
+	influxdbFilePermissions    = 0644
+	influxdbMeasurementEscapes = `, \`
+	influxdbTagEscapes         = `,= \`
+	influxdbStringEscapes      = `"\`
+)
+
+type influxdbExporter struct {
+	writeURL       string
+	token          string
+	filePath       string
+	client         *http.Client
+	resourceLabels map[string]string
+}
+
+// influxdbField is a line protocol field whose value is already formatted with its type suffix
+type influxdbField struct {
+	key   string
+	value string
+}
+
+// newInfluxdbExporters returns an exporter for INFLUXDB_URL and one for INFLUXDB_FILE, whichever are set,
+// so a failed HTTP write is retried and spooled without appending the points to the file again
+func newInfluxdbExporters(_ *logzioPingStatistics) ([]exporter, error) {
+	influxdbURL := os.Getenv(influxdbURLEnvName)
+	filePath := os.Getenv(influxdbFileEnvName)
+
+	if influxdbURL == "" && filePath == "" {
+		return nil, fmt.Errorf("%s or %s must not be empty", influxdbURLEnvName, influxdbFileEnvName)
+	}
+
+	exporters := make([]exporter, 0, 2)
+
+	if influxdbURL != "" {
+		bucket := os.Getenv(influxdbBucketEnvName)
+		if bucket == "" {
+			return nil, fmt.Errorf("%s must not be empty", influxdbBucketEnvName)
+		}
+
+		writeURL, err := url.Parse(strings.TrimSuffix(influxdbURL, "/") + influxdbWritePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a valid URL: %v", influxdbURLEnvName, err)
+		}
+
+		query := writeURL.Query()
+		query.Set("org", os.Getenv(influxdbOrgEnvName))
+		query.Set("bucket", bucket)
+		query.Set("precision", "ns")
+		writeURL.RawQuery = query.Encode()
+
+		exporters = append(exporters, &influxdbExporter{
+			writeURL:       writeURL.String(),
+			token:          os.Getenv(influxdbTokenEnvName),
+			client:         &http.Client{Timeout: influxdbTimeout},
+			resourceLabels: getResourceLabels(),
+		})
+	}
+
+	if filePath != "" {
+		exporters = append(exporters, &influxdbExporter{
+			filePath:       filePath,
+			resourceLabels: getResourceLabels(),
+		})
+	}
+
+	return exporters, nil
+}
+
+func (ie *influxdbExporter) name() string {
+	if ie.writeURL == "" {
+		return influxdbFileExporterName
+	}
+
+	return influxdbExporterName
+}
+
+func (ie *influxdbExporter) export(ctx context.Context, pingsStats []*pingStatistics) error {
+	lines := ie.getLines(pingsStats)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	body := []byte(strings.Join(lines, "\n") + "\n")
+
+	if ie.filePath != "" {
+		if err := ie.writeFile(body); err != nil {
+			return err
+		}
+	}
+
+	if ie.writeURL != "" {
+		return ie.write(ctx, body)
+	}
+
+	return nil
+}
+
+func (ie *influxdbExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+func (ie *influxdbExporter) writeFile(body []byte) error {
+	file, err := os.OpenFile(ie.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, influxdbFilePermissions)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %v", ie.filePath, err)
+	}
+
+	if _, err = file.Write(body); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error writing to %s: %v", ie.filePath, err)
+	}
+
+	return file.Close()
+}
+
+func (ie *influxdbExporter) write(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, ie.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating write request: %v", err)
+	}
+
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if ie.token != "" {
+		request.Header.Set("Authorization", "Token "+ie.token)
+	}
+
+	response, err := ie.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error sending write request: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		if err = body.Close(); err != nil {
+			errorLogger.Println("Error closing write response body:", err)
+		}
+	}(response.Body)
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(response.Body)
+		return &httpStatusError{
+			backend:    "InfluxDB",
+			statusCode: response.StatusCode,
+			status:     response.Status,
+			body:       strings.TrimSpace(string(responseBody)),
+		}
+	}
+
+	return nil
+}
+
+// getLines returns a summary line per address, timestamped at its last probe, and a line per probe
+func (ie *influxdbExporter) getLines(pingsStats []*pingStatistics) []string {
+	lines := make([]string, 0)
+
+	for _, pingStats := range pingsStats {
+		if len(pingStats.probes) == 0 {
+			continue
+		}
+
+		tags := mergeLabels(ie.resourceLabels, pingStats.getLabels())
+
+		fields := []influxdbField{
+			{key: probesSentFieldName, value: strconv.Itoa(pingStats.probesSent) + "i"},
+			{key: successfulProbesFieldName, value: strconv.Itoa(pingStats.successfulProbes) + "i"},
+			{key: probesFailedFieldName, value: strconv.Itoa(pingStats.probesFailed) + "i"},
+		}
+
+		if pingStats.state != "" {
+			fields = append(fields, influxdbField{key: stateFieldName, value: formatInfluxdbString(pingStats.state)})
+		}
+
+		if rttStats := getRttStatistics(pingStats.rtts); rttStats != nil {
+			fields = append(fields,
+				influxdbField{key: rttMinFieldName, value: formatInfluxdbFloat(rttStats.min)},
+				influxdbField{key: rttAvgFieldName, value: formatInfluxdbFloat(rttStats.avg)},
+				influxdbField{key: rttMaxFieldName, value: formatInfluxdbFloat(rttStats.max)},
+				influxdbField{key: rttMdevFieldName, value: formatInfluxdbFloat(rttStats.mdev)},
+			)
+		}
+
+		lastProbe := pingStats.probes[len(pingStats.probes)-1]
+		lines = append(lines, formatInfluxdbLine(influxdbSummaryMeasurement, tags, fields, lastProbe.timestamp))
+
+		for _, probe := range pingStats.probes {
+			probeTags := mergeLabels(tags, map[string]string{resolvedIPTagName: probe.resolvedIP})
+			probeFields := []influxdbField{{key: successFieldName, value: strconv.FormatBool(probe.err == nil)}}
+
+			if probe.err == nil {
+				probeFields = append(probeFields, influxdbField{key: rttFieldName, value: formatInfluxdbFloat(probe.rtt)})
+			} else {
+				probeTags[errorReasonTagName] = probe.errorReason
+			}
+
+			lines = append(lines, formatInfluxdbLine(influxdbProbeMeasurement, probeTags, probeFields, probe.timestamp))
+		}
+	}
+
+	return lines
+}
+
+func formatInfluxdbLine(measurement string, tags map[string]string, fields []influxdbField, timestamp time.Time) string {
+	builder := &strings.Builder{}
+	builder.WriteString(escapeInfluxdb(measurement, influxdbMeasurementEscapes))
+
+	// Empty tag values are not allowed by the line protocol
+	for _, tagName := range getSortedLabelNames(tags) {
+		if tags[tagName] == "" {
+			continue
+		}
+
+		builder.WriteString("," + escapeInfluxdb(tagName, influxdbTagEscapes) + "=" + escapeInfluxdb(tags[tagName], influxdbTagEscapes))
+	}
+
+	for index, field := range fields {
+		if index == 0 {
+			builder.WriteString(" ")
+		} else {
+			builder.WriteString(",")
+		}
+
+		builder.WriteString(escapeInfluxdb(field.key, influxdbTagEscapes) + "=" + field.value)
+	}
+
+	builder.WriteString(" " + strconv.FormatInt(timestamp.UnixNano(), 10))
+	return builder.String()
+}
+
+func formatInfluxdbFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatInfluxdbString quotes a string field value. Line protocol escapes only double quotes and backslashes in it,
+// unlike Go quoting, whose escapes would be stored as is.
+func formatInfluxdbString(value string) string {
+	return `"` + escapeInfluxdb(value, influxdbStringEscapes) + `"`
+}
+
+func escapeInfluxdb(value string, escapedChars string) string {
+	builder := &strings.Builder{}
+
+	for _, char := range value {
+		if strings.ContainsRune(escapedChars, char) {
+			builder.WriteRune('\\')
+		}
+
+		builder.WriteRune(char)
+	}
+
+	return builder.String()
+}
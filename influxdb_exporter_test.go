@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInfluxdbExporter_NoDestination(t *testing.T) {
+	_, err := newInfluxdbExporters(nil)
+	require.Error(t, err)
+}
+
+func TestNewInfluxdbExporter_NoBucket(t *testing.T) {
+	err := os.Setenv(influxdbURLEnvName, "http://localhost:8086")
+	require.NoError(t, err)
+
+	_, err = newInfluxdbExporters(nil)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestInfluxdbExporter_GetLines(t *testing.T) {
+	pingsStats := getTestPingsStats()
+	pingsStats[0].labels = map[string]string{"team": "core network"}
+
+	influxdbExp := &influxdbExporter{resourceLabels: map[string]string{awsRegionLabelName: "us-east-1", awsLambdaFunctionLabelName: ""}}
+	lines := influxdbExp.getLines(pingsStats)
+
+	require.Len(t, lines, 8)
+	assert.Equal(t, "ping_stats,address=www.google.com:80,aws_region=us-east-1,team=core\\ network probes_sent=3i,successful_probes=2i,probes_failed=1i,rtt_min=10.5,rtt_avg=11.375,rtt_max=12.25,rtt_mdev=0.875 1646136002000000000", lines[0])
+	assert.Equal(t, "ping_stats_probe,address=www.google.com:80,aws_region=us-east-1,resolved_ip=1.1.1.1,team=core\\ network success=true,rtt=10.5 1646136000000000000", lines[1])
+	assert.Equal(t, "ping_stats_probe,address=www.google.com:80,aws_region=us-east-1,error_reason=connection_refused,team=core\\ network success=false 1646136001000000000", lines[2])
+	assert.Equal(t, "ping_stats,address=listener.logz.io:8053,aws_region=us-east-1 probes_sent=3i,successful_probes=0i,probes_failed=3i 1646136002000000000", lines[4])
+}
+
+func TestFormatInfluxdbLine_Escaping(t *testing.T) {
+	line := formatInfluxdbLine(influxdbSummaryMeasurement,
+		map[string]string{`path\dir`: `C:\probes,eu=1 a`},
+		[]influxdbField{{key: stateFieldName, value: formatInfluxdbString(`schéma \"up\"`)}}, testProbesTimestamp)
+
+	// String fields are not Go-quoted, so é is written as is, and only quotes and backslashes are escaped
+	assert.Equal(t, `ping_stats,path\\dir=C:\\probes\,eu\=1\ a state="schéma \\\"up\\\"" 1646136000000000000`, line)
+}
+
+func TestInfluxdbExporter_ExportHTTP(t *testing.T) {
+	err := os.Setenv(influxdbURLEnvName, "http://localhost:8086/")
+	require.NoError(t, err)
+
+	err = os.Setenv(influxdbOrgEnvName, "network")
+	require.NoError(t, err)
+
+	err = os.Setenv(influxdbBucketEnvName, "probes")
+	require.NoError(t, err)
+
+	err = os.Setenv(influxdbTokenEnvName, "123456789a")
+	require.NoError(t, err)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost:8086/api/v2/write",
+		func(request *http.Request) (*http.Response, error) {
+			assert.Equal(t, "Token 123456789a", request.Header.Get("Authorization"))
+			assert.Equal(t, "network", request.URL.Query().Get("org"))
+			assert.Equal(t, "probes", request.URL.Query().Get("bucket"))
+			assert.Equal(t, "ns", request.URL.Query().Get("precision"))
+
+			body, err := io.ReadAll(request.Body)
+			require.NoError(t, err)
+
+			assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), 8)
+			return httpmock.NewStringResponse(http.StatusNoContent, ""), nil
+		})
+
+	exps, err := newInfluxdbExporters(nil)
+	require.NoError(t, err)
+	require.Len(t, exps, 1)
+
+	exp := exps[0]
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+
+	os.Clearenv()
+}
+
+func TestInfluxdbExporter_ExportHTTPFailure(t *testing.T) {
+	err := os.Setenv(influxdbURLEnvName, "http://localhost:8086")
+	require.NoError(t, err)
+
+	err = os.Setenv(influxdbBucketEnvName, "probes")
+	require.NoError(t, err)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost:8086/api/v2/write",
+		httpmock.NewStringResponder(http.StatusBadRequest, `{"code":"invalid"}`))
+
+	exps, err := newInfluxdbExporters(nil)
+	require.NoError(t, err)
+	require.Len(t, exps, 1)
+
+	exp := exps[0]
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid")
+
+	os.Clearenv()
+}
+
+func TestInfluxdbExporter_ExportFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ping_stats.lp")
+
+	err := os.Setenv(influxdbFileEnvName, filePath)
+	require.NoError(t, err)
+
+	exps, err := newInfluxdbExporters(nil)
+	require.NoError(t, err)
+	require.Len(t, exps, 1)
+
+	exp := exps[0]
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	assert.Len(t, strings.Split(strings.TrimSpace(string(content)), "\n"), 16)
+	assert.Equal(t, influxdbFileExporterName, exp.name())
+
+	os.Clearenv()
+}
+
+func TestInfluxdbExporter_RetryDoesNotRewriteFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ping_stats.lp")
+	envs := map[string]string{
+		influxdbURLEnvName:    "http://localhost:8086",
+		influxdbBucketEnvName: "probes",
+		influxdbFileEnvName:   filePath,
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+
+	defer os.Clearenv()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost:8086/api/v2/write",
+		httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:           context.Background(),
+		exporterNames: []string{influxdbExporterName},
+		delivery:      &deliveryConfig{maxRetries: 2, initialBackoff: time.Millisecond},
+	}
+
+	exporters, err := logzioPingStats.createExporters()
+	require.NoError(t, err)
+	require.Len(t, exporters, 2)
+	assert.Equal(t, influxdbExporterName, exporters[0].name())
+	assert.Equal(t, influxdbFileExporterName, exporters[1].name())
+
+	logzioPingStats.exporters = exporters
+	_, err = logzioPingStats.exportPingsStats(getTestPingsStats())
+	require.Error(t, err)
+	assert.Equal(t, 3, httpmock.GetTotalCallCount())
+
+	// The file is written once, although the HTTP write was retried
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(content)), "\n"), 8)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	probeSiteEnvName                = "PROBE_SITE"
+	probeVPCEnvName                 = "PROBE_VPC"
+	probeAZEnvName                  = "PROBE_AZ"
+	probeProviderEnvName            = "PROBE_PROVIDER"
+	probeIDEnvName                  = "PROBE_ID"
+	disableLocationDetectionEnvName = "DISABLE_LOCATION_DETECTION"
+	probeSiteLabelName              = "site"
+	probeVPCLabelName               = "vpc"
+	probeAZLabelName                = "az"
+	probeProviderLabelName          = "provider"
+	probeIDLabelName                = "probe_id"
+	providerAWS                     = "aws"
+	ecsContainerMetadataURIEnvName  = "ECS_CONTAINER_METADATA_URI_V4"
+	ec2MetadataBaseURL              = "http://169.254.169.254/latest"
+	ec2MetadataTokenTTLSeconds      = "60"
+	ec2SystemVendorPath             = "/sys/devices/virtual/dmi/id/sys_vendor"
+	ec2SystemVendor                 = "Amazon EC2"
+	locationDetectionTimeout        = 2 * time.Second
+	locationDetectorResponseMaxSize = 1 << 16
+)
+
+// locationEnvNames are the environment variables of the location labels, which take precedence over the detected values
+var locationEnvNames = map[string]string{
+	probeSiteLabelName:     probeSiteEnvName,
+	probeVPCLabelName:      probeVPCEnvName,
+	probeAZLabelName:       probeAZEnvName,
+	probeProviderLabelName: probeProviderEnvName,
+	probeIDLabelName:       probeIDEnvName,
+}
+
+var (
+	locationDetectionOnce  sync.Once
+	detectedLocationLabels map[string]string
+)
+
+// locationDetector detects the location labels of the prober from a metadata endpoint
+type locationDetector interface {
+	name() string
+	available() bool
+	detect(ctx context.Context) (map[string]string, error)
+}
+
+// getLocationLabels returns the location labels of the prober. The PROBE_* environment variables take precedence
+// over the values detected from the Lambda environment and the ECS or EC2 metadata endpoints.
+func getLocationLabels() map[string]string {
+	locationLabels := make(map[string]string)
+
+	// Lambda has no metadata endpoint, its environment is all there is
+	if os.Getenv(awsLambdaFunctionNameEnvName) != "" {
+		locationLabels[probeProviderLabelName] = providerAWS
+	}
+
+	disableLocationDetection, err := getBoolEnvValue(os.Getenv(disableLocationDetectionEnvName), disableLocationDetectionEnvName)
+	if err != nil {
+		errorLogger.Println("Error getting the location detection setting, detecting the location:", err)
+	}
+
+	if !disableLocationDetection {
+		for labelName, labelValue := range getDetectedLocationLabels() {
+			if labelValue != "" {
+				locationLabels[labelName] = labelValue
+			}
+		}
+	}
+
+	for labelName, envName := range locationEnvNames {
+		if labelValue := os.Getenv(envName); labelValue != "" {
+			locationLabels[labelName] = labelValue
+		}
+	}
+
+	return locationLabels
+}
+
+// getDetectedLocationLabels detects the location once per process, since it does not change and the exporters
+// of a run would otherwise each query the metadata endpoints
+func getDetectedLocationLabels() map[string]string {
+	locationDetectionOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), locationDetectionTimeout)
+		defer cancel()
+
+		detectedLocationLabels = detectLocation(ctx, []locationDetector{
+			newECSLocationDetector(),
+			newEC2LocationDetector(),
+		})
+	})
+
+	return detectedLocationLabels
+}
+
+// detectLocation returns the labels of the first available detector that succeeds
+func detectLocation(ctx context.Context, detectors []locationDetector) map[string]string {
+	for _, detector := range detectors {
+		if !detector.available() {
+			continue
+		}
+
+		locationLabels, err := detector.detect(ctx)
+		if err != nil {
+			errorLogger.Println("Error detecting the location from", detector.name(), "metadata:", err)
+			continue
+		}
+
+		infoLogger.Println("Detected the location from", detector.name(), "metadata:", locationLabels)
+		return locationLabels
+	}
+
+	return map[string]string{}
+}
+
+// ecsLocationDetector reads the task metadata endpoint of ECS, on both Fargate and EC2
+type ecsLocationDetector struct {
+	client      *http.Client
+	metadataURI string
+}
+
+type ecsTaskMetadata struct {
+	TaskARN          string `json:"TaskARN"`
+	AvailabilityZone string `json:"AvailabilityZone"`
+}
+
+func newECSLocationDetector() *ecsLocationDetector {
+	return &ecsLocationDetector{
+		client:      &http.Client{},
+		metadataURI: os.Getenv(ecsContainerMetadataURIEnvName),
+	}
+}
+
+func (eld *ecsLocationDetector) name() string {
+	return "ECS"
+}
+
+func (eld *ecsLocationDetector) available() bool {
+	return eld.metadataURI != ""
+}
+
+func (eld *ecsLocationDetector) detect(ctx context.Context) (map[string]string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, eld.metadataURI+"/task", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating task metadata request: %v", err)
+	}
+
+	body, err := getMetadataResponse(eld.client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	taskMetadata := &ecsTaskMetadata{}
+	if err = json.Unmarshal(body, taskMetadata); err != nil {
+		return nil, fmt.Errorf("error parsing task metadata: %v", err)
+	}
+
+	return map[string]string{
+		probeProviderLabelName: providerAWS,
+		probeAZLabelName:       taskMetadata.AvailabilityZone,
+		probeIDLabelName:       taskMetadata.TaskARN,
+	}, nil
+}
+
+// ec2LocationDetector reads the instance metadata service of EC2, with an IMDSv2 session token
+type ec2LocationDetector struct {
+	client           *http.Client
+	baseURL          string
+	systemVendorPath string
+}
+
+func newEC2LocationDetector() *ec2LocationDetector {
+	return &ec2LocationDetector{
+		client:           &http.Client{},
+		baseURL:          ec2MetadataBaseURL,
+		systemVendorPath: ec2SystemVendorPath,
+	}
+}
+
+func (eld *ec2LocationDetector) name() string {
+	return "EC2"
+}
+
+// available checks the system vendor first, so hosts outside EC2 never wait on the metadata address
+func (eld *ec2LocationDetector) available() bool {
+	systemVendor, err := os.ReadFile(eld.systemVendorPath)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(systemVendor)) == ec2SystemVendor
+}
+
+func (eld *ec2LocationDetector) detect(ctx context.Context) (map[string]string, error) {
+	tokenRequest, err := http.NewRequestWithContext(ctx, http.MethodPut, eld.baseURL+"/api/token", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating metadata token request: %v", err)
+	}
+
+	tokenRequest.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", ec2MetadataTokenTTLSeconds)
+
+	token, err := getMetadataResponse(eld.client, tokenRequest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting metadata token: %v", err)
+	}
+
+	getMetadata := func(path string) (string, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, eld.baseURL+"/meta-data/"+path, nil)
+		if err != nil {
+			return "", fmt.Errorf("error creating %s metadata request: %v", path, err)
+		}
+
+		request.Header.Set("X-aws-ec2-metadata-token", string(token))
+
+		value, err := getMetadataResponse(eld.client, request)
+		if err != nil {
+			return "", fmt.Errorf("error getting %s metadata: %v", path, err)
+		}
+
+		return strings.TrimSpace(string(value)), nil
+	}
+
+	instanceID, err := getMetadata("instance-id")
+	if err != nil {
+		return nil, err
+	}
+
+	availabilityZone, err := getMetadata("placement/availability-zone")
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := getMetadata("mac")
+	if err != nil {
+		return nil, err
+	}
+
+	vpcID, err := getMetadata("network/interfaces/macs/" + mac + "/vpc-id")
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		probeProviderLabelName: providerAWS,
+		probeAZLabelName:       availabilityZone,
+		probeVPCLabelName:      vpcID,
+		probeIDLabelName:       instanceID,
+	}, nil
+}
+
+func getMetadataResponse(client *http.Client, request *http.Request) ([]byte, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata endpoint returned %s", response.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, locationDetectorResponseMaxSize))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLocationDetector struct {
+	detectorName   string
+	isAvailable    bool
+	locationLabels map[string]string
+	err            error
+	detected       bool
+}
+
+func (fld *fakeLocationDetector) name() string {
+	return fld.detectorName
+}
+
+func (fld *fakeLocationDetector) available() bool {
+	return fld.isAvailable
+}
+
+func (fld *fakeLocationDetector) detect(_ context.Context) (map[string]string, error) {
+	fld.detected = true
+	return fld.locationLabels, fld.err
+}
+
+func TestDetectLocation_FirstAvailable(t *testing.T) {
+	unavailable := &fakeLocationDetector{detectorName: "unavailable", locationLabels: map[string]string{probeIDLabelName: "unavailable"}}
+	failing := &fakeLocationDetector{detectorName: "failing", isAvailable: true, err: errors.New("timeout")}
+	working := &fakeLocationDetector{detectorName: "working", isAvailable: true, locationLabels: map[string]string{probeIDLabelName: "working"}}
+	notReached := &fakeLocationDetector{detectorName: "not reached", isAvailable: true, locationLabels: map[string]string{probeIDLabelName: "not reached"}}
+
+	locationLabels := detectLocation(context.Background(), []locationDetector{unavailable, failing, working, notReached})
+
+	assert.Equal(t, map[string]string{probeIDLabelName: "working"}, locationLabels)
+	assert.False(t, unavailable.detected)
+	assert.True(t, failing.detected)
+	assert.False(t, notReached.detected)
+}
+
+func TestDetectLocation_None(t *testing.T) {
+	locationLabels := detectLocation(context.Background(), []locationDetector{&fakeLocationDetector{}})
+	assert.Empty(t, locationLabels)
+}
+
+func TestECSLocationDetector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/v4/task", request.URL.Path)
+		_, _ = writer.Write([]byte(`{"Cluster": "default", "TaskARN": "arn:aws:ecs:us-east-1:123456789012:task/default/abc", "AvailabilityZone": "us-east-1a"}`))
+	}))
+
+	defer server.Close()
+
+	detector := &ecsLocationDetector{client: server.Client(), metadataURI: server.URL + "/v4"}
+	require.True(t, detector.available())
+
+	locationLabels, err := detector.detect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		probeProviderLabelName: providerAWS,
+		probeAZLabelName:       "us-east-1a",
+		probeIDLabelName:       "arn:aws:ecs:us-east-1:123456789012:task/default/abc",
+	}, locationLabels)
+
+	assert.False(t, (&ecsLocationDetector{}).available())
+}
+
+func TestEC2LocationDetector(t *testing.T) {
+	metadata := map[string]string{
+		"/meta-data/instance-id":                                      "i-0123456789abcdef0",
+		"/meta-data/placement/availability-zone":                      "eu-west-1b",
+		"/meta-data/mac":                                              "0e:49:61:0f:c3:11",
+		"/meta-data/network/interfaces/macs/0e:49:61:0f:c3:11/vpc-id": "vpc-0a1b2c3d",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/api/token" {
+			assert.Equal(t, http.MethodPut, request.Method)
+			assert.Equal(t, ec2MetadataTokenTTLSeconds, request.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			_, _ = writer.Write([]byte("token"))
+			return
+		}
+
+		if request.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		value, ok := metadata[request.URL.Path]
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = writer.Write([]byte(value + "\n"))
+	}))
+
+	defer server.Close()
+
+	systemVendorPath := filepath.Join(t.TempDir(), "sys_vendor")
+	detector := &ec2LocationDetector{client: server.Client(), baseURL: server.URL, systemVendorPath: systemVendorPath}
+	assert.False(t, detector.available())
+
+	err := os.WriteFile(systemVendorPath, []byte(ec2SystemVendor+"\n"), 0600)
+	require.NoError(t, err)
+	require.True(t, detector.available())
+
+	locationLabels, err := detector.detect(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		probeProviderLabelName: providerAWS,
+		probeAZLabelName:       "eu-west-1b",
+		probeVPCLabelName:      "vpc-0a1b2c3d",
+		probeIDLabelName:       "i-0123456789abcdef0",
+	}, locationLabels)
+}
+
+func TestGetResourceLabels_Location(t *testing.T) {
+	envs := map[string]string{
+		awsRegionEnvName:                "us-east-1",
+		awsLambdaFunctionNameEnvName:    "ping-statistics",
+		probeSiteEnvName:                "office",
+		probeIDEnvName:                  "prober-1",
+		disableLocationDetectionEnvName: "true",
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+
+	defer os.Clearenv()
+
+	assert.Equal(t, map[string]string{
+		awsRegionLabelName:         "us-east-1",
+		awsLambdaFunctionLabelName: "ping-statistics",
+		probeProviderLabelName:     providerAWS,
+		probeSiteLabelName:         "office",
+		probeIDLabelName:           "prober-1",
+	}, getResourceLabels())
+
+	require.NoError(t, os.Setenv(probeProviderEnvName, "on-prem"))
+	assert.Equal(t, "on-prem", getResourceLabels()[probeProviderLabelName])
+}
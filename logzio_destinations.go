@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+const logzioDestinationsEnvName = "LOGZIO_DESTINATIONS"
+
+// The destination name is part of the exporter name, which also names its spool files
+var logzioDestinationNameRegexp = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+
+// logzioDestination is a Logz.io metrics listener and token pair, receiving the targets its filter selects
+type logzioDestination struct {
+	Name     string          `json:"name"`
+	Listener string          `json:"listener"`
+	Token    string          `json:"token"`
+	Filter   *targetSelector `json:"filter,omitempty"`
+}
+
+// filteredExporter exports only the targets its selector selects
+type filteredExporter struct {
+	exporter exporter
+	selector *targetSelector
+}
+
+func getLogzioDestinations(envValue string, addresses []string) ([]*logzioDestination, error) {
+	destinations := make([]*logzioDestination, 0)
+	if envValue == "" {
+		return destinations, nil
+	}
+
+	if err := json.Unmarshal([]byte(envValue), &destinations); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON array of destinations: %v", logzioDestinationsEnvName, err)
+	}
+
+	names := make([]string, 0, len(destinations))
+
+	for _, destination := range destinations {
+		if !logzioDestinationNameRegexp.MatchString(destination.Name) {
+			return nil, fmt.Errorf("%s destination name must contain only letters, digits and underscores: %q", logzioDestinationsEnvName, destination.Name)
+		}
+
+		if containsString(names, destination.Name) {
+			return nil, fmt.Errorf("%s contains the destination %s more than once", logzioDestinationsEnvName, destination.Name)
+		}
+
+		names = append(names, destination.Name)
+
+		if destination.Listener == "" || destination.Token == "" {
+			return nil, fmt.Errorf("%s destination %s must have a listener and a token", logzioDestinationsEnvName, destination.Name)
+		}
+
+		if destination.Filter == nil {
+			continue
+		}
+
+		if err := destination.Filter.normalize(addresses); err != nil {
+			return nil, fmt.Errorf("%s destination %s filter is invalid: %v", logzioDestinationsEnvName, destination.Name, err)
+		}
+	}
+
+	return destinations, nil
+}
+
+// createLogzioExporters returns an exporter for the LOGZIO_METRICS_LISTENER and LOGZIO_METRICS_TOKEN pair, if set,
+// and one for each destination, so each destination is retried and spooled on its own
+func (lps *logzioPingStatistics) createLogzioExporters() ([]exporter, error) {
+	exporters := make([]exporter, 0, len(lps.logzioDestinations)+1)
+
+	if len(lps.logzioDestinations) == 0 || lps.logzioMetricsListener != "" || lps.logzioMetricsToken != "" {
+		exporter, err := newLogzioExporter(lps)
+		if err != nil {
+			return nil, err
+		}
+
+		exporters = append(exporters, exporter)
+	}
+
+	for _, destination := range lps.logzioDestinations {
+		exporters = append(exporters, &filteredExporter{
+			exporter: &logzioExporter{
+				logzioMetricsListener: destination.Listener,
+				logzioMetricsToken:    destination.Token,
+				destinationName:       destination.Name,
+			},
+			selector: destination.Filter,
+		})
+	}
+
+	return exporters, nil
+}
+
+func (fe *filteredExporter) name() string {
+	return fe.exporter.name()
+}
+
+func (fe *filteredExporter) export(ctx context.Context, pingsStats []*pingStatistics) error {
+	filteredPingsStats := fe.selector.filter(pingsStats)
+	if len(filteredPingsStats) == 0 {
+		return nil
+	}
+
+	return fe.exporter.export(ctx, filteredPingsStats)
+}
+
+func (fe *filteredExporter) shutdown(ctx context.Context) error {
+	return fe.exporter.shutdown(ctx)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDestinationsAddresses = []string{"www.google.com:80", "listener.logz.io:8053"}
+
+func TestGetLogzioDestinations_Success(t *testing.T) {
+	destinations, err := getLogzioDestinations(`[
+		{"name": "prod", "listener": "https://listener.logz.io:8053", "token": "123456789a"},
+		{"name": "sandbox", "listener": "https://listener-eu.logz.io:8053", "token": "123456789b", "filter": {"addresses": ["https://www.google.com"], "labels": {"env": "prod"}}}
+	]`, testDestinationsAddresses)
+	require.NoError(t, err)
+
+	require.Len(t, destinations, 2)
+	assert.Nil(t, destinations[0].Filter)
+	assert.Equal(t, "https://listener-eu.logz.io:8053", destinations[1].Listener)
+	assert.Equal(t, []string{"www.google.com:80"}, destinations[1].Filter.Addresses)
+	assert.Equal(t, map[string]string{"env": "prod"}, destinations[1].Filter.Labels)
+}
+
+func TestGetLogzioDestinations_Empty(t *testing.T) {
+	destinations, err := getLogzioDestinations("", testDestinationsAddresses)
+	require.NoError(t, err)
+
+	assert.Empty(t, destinations)
+}
+
+func TestGetLogzioDestinations_Invalid(t *testing.T) {
+	invalidValues := []string{
+		`{"name": "prod"}`,
+		`[{"name": "prod-eu", "listener": "https://listener.logz.io:8053", "token": "123456789a"}]`,
+		`[{"name": "prod", "listener": "https://listener.logz.io:8053"}]`,
+		`[{"name": "prod", "listener": "https://listener.logz.io:8053", "token": "123456789a"}, {"name": "prod", "listener": "https://listener.logz.io:8053", "token": "123456789a"}]`,
+		`[{"name": "prod", "listener": "https://listener.logz.io:8053", "token": "123456789a", "filter": {"addresses": ["www.example.com"]}}]`,
+	}
+
+	for _, invalidValue := range invalidValues {
+		_, err := getLogzioDestinations(invalidValue, testDestinationsAddresses)
+		assert.Error(t, err, invalidValue)
+	}
+}
+
+func TestTargetSelector_Filter(t *testing.T) {
+	pingsStats := getTestPingsStats()
+	pingsStats[0].labels = map[string]string{"env": "prod"}
+
+	var nilSelector *targetSelector
+	assert.Len(t, nilSelector.filter(pingsStats), 2)
+
+	addressSelector := &targetSelector{Addresses: []string{"listener.logz.io:8053"}}
+	filteredPingsStats := addressSelector.filter(pingsStats)
+	require.Len(t, filteredPingsStats, 1)
+	assert.Equal(t, "listener.logz.io:8053", filteredPingsStats[0].address)
+
+	labelsSelector := &targetSelector{Labels: map[string]string{"env": "prod"}}
+	filteredPingsStats = labelsSelector.filter(pingsStats)
+	require.Len(t, filteredPingsStats, 1)
+	assert.Equal(t, "www.google.com:80", filteredPingsStats[0].address)
+
+	bothSelector := &targetSelector{Addresses: []string{"listener.logz.io:8053"}, Labels: map[string]string{"env": "prod"}}
+	assert.Empty(t, bothSelector.filter(pingsStats))
+}
+
+func TestCreateLogzioExporters_Destinations(t *testing.T) {
+	logzioPingStats := &logzioPingStatistics{
+		logzioMetricsListener: "https://listener.logz.io:8053",
+		logzioMetricsToken:    "123456789a",
+		logzioDestinations: []*logzioDestination{
+			{Name: "sandbox", Listener: "https://listener-eu.logz.io:8053", Token: "123456789b"},
+		},
+	}
+
+	exporters, err := logzioPingStats.createExporters()
+	require.NoError(t, err)
+
+	require.Len(t, exporters, 2)
+	assert.Equal(t, logzioExporterName, exporters[0].name())
+	assert.Equal(t, "logzio.sandbox", exporters[1].name())
+
+	// Without the LOGZIO_METRICS_LISTENER and LOGZIO_METRICS_TOKEN pair only the destinations are created
+	logzioPingStats.logzioMetricsListener = ""
+	logzioPingStats.logzioMetricsToken = ""
+
+	exporters, err = logzioPingStats.createExporters()
+	require.NoError(t, err)
+
+	require.Len(t, exporters, 1)
+	assert.Equal(t, "logzio.sandbox", exporters[0].name())
+}
+
+func TestCollectMetrics_DestinationFailuresAreIndependent(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://listener.logz.io:8053",
+		func(request *http.Request) (*http.Response, error) {
+			metrics, err := getMetrics(request)
+			require.NoError(t, err)
+
+			// Only the filtered address is sent to the production destination
+			for _, metric := range metrics {
+				assert.Equal(t, "www.google.com:80", metric["address"])
+			}
+
+			return httpmock.NewStringResponse(http.StatusOK, ""), nil
+		})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://listener-eu.logz.io:8053",
+		httpmock.NewStringResponder(http.StatusUnauthorized, ""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx: ctx,
+		logzioDestinations: []*logzioDestination{
+			{Name: "prod", Listener: "https://listener.logz.io:8053", Token: "123456789a", Filter: &targetSelector{Addresses: []string{"www.google.com:80"}}},
+			{Name: "sandbox", Listener: "https://listener-eu.logz.io:8053", Token: "123456789b"},
+		},
+		pingsStats: getTestPingsStats(),
+	}
+
+	err := logzioPingStats.collectMetrics()
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "logzio.sandbox")
+	assert.NotContains(t, err.Error(), "logzio.prod")
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST https://listener.logz.io:8053"])
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	logzioMetricsTimeout       = 30 * time.Second
+	remoteWriteVersion         = "0.1.0"
+	remoteWriteMetricNameLabel = "__name__"
+)
+
+type logzioExporter struct {
+	logzioMetricsListener string
+	logzioMetricsToken    string
+	destinationName       string
+	client                *http.Client
+	resourceLabels        map[string]string
+}
+
+func newLogzioExporter(lps *logzioPingStatistics) (exporter, error) {
+	if lps.logzioMetricsListener == "" {
+		return nil, fmt.Errorf("%s must not be empty", logzioMetricsListenerEnvName)
+	}
+
+	if lps.logzioMetricsToken == "" {
+		return nil, fmt.Errorf("%s must not be empty", logzioMetricsTokenEnvName)
+	}
+
+	return &logzioExporter{
+		logzioMetricsListener: lps.logzioMetricsListener,
+		logzioMetricsToken:    lps.logzioMetricsToken,
+	}, nil
+}
+
+func (le *logzioExporter) name() string {
+	if le.destinationName != "" {
+		return logzioExporterName + "." + le.destinationName
+	}
+
+	return logzioExporterName
+}
+
+// export builds a single remote-write request of the run and pushes it, returning the listener's verdict
+func (le *logzioExporter) export(ctx context.Context, pingsStats []*pingStatistics) error {
+	if le.resourceLabels == nil {
+		le.resourceLabels = getResourceLabels()
+	}
+
+	timeSeries := getTimeSeries(pingsStats, le.resourceLabels)
+	if len(timeSeries) == 0 {
+		return nil
+	}
+
+	writeRequest := &prompb.WriteRequest{Timeseries: timeSeries}
+
+	message, err := writeRequest.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshaling write request: %v", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, le.logzioMetricsListener, bytes.NewReader(snappy.Encode(nil, message)))
+	if err != nil {
+		return fmt.Errorf("error creating write request: %v", err)
+	}
+
+	request.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("Authorization", "Bearer "+le.logzioMetricsToken)
+
+	if le.client == nil {
+		le.client = &http.Client{Timeout: logzioMetricsTimeout}
+	}
+
+	response, err := le.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error sending write request: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		if err = body.Close(); err != nil {
+			errorLogger.Println("Error closing write response body:", err)
+		}
+	}(response.Body)
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		responseBody, _ := io.ReadAll(response.Body)
+		return &httpStatusError{
+			backend:    "metrics listener",
+			statusCode: response.StatusCode,
+			status:     response.Status,
+			body:       strings.TrimSpace(string(responseBody)),
+		}
+	}
+
+	infoLogger.Printf("Sent %d time series with %s exporter, metrics listener responded with %s", len(timeSeries), le.name(), response.Status)
+	return nil
+}
+
+func (le *logzioExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+// getTimeSeries returns a time series per metric point, sampled at the last probe of its address
+func getTimeSeries(pingsStats []*pingStatistics, resourceLabels map[string]string) []prompb.TimeSeries {
+	timeSeries := make([]prompb.TimeSeries, 0)
+	now := time.Now()
+
+	for _, pingStats := range pingsStats {
+		timestamp := now
+		if len(pingStats.probes) > 0 {
+			timestamp = pingStats.probes[len(pingStats.probes)-1].timestamp
+		}
+
+		for _, point := range getMetricPoints([]*pingStatistics{pingStats}) {
+			labels := sanitizeLabels(mergeLabels(resourceLabels, point.labels))
+			promLabels := []prompb.Label{{Name: remoteWriteMetricNameLabel, Value: point.name}}
+
+			for labelName, labelValue := range labels {
+				promLabels = append(promLabels, prompb.Label{Name: labelName, Value: labelValue})
+			}
+
+			// Remote write expects the labels sorted by name
+			sort.Slice(promLabels, func(i, j int) bool {
+				return promLabels[i].Name < promLabels[j].Name
+			})
+
+			timeSeries = append(timeSeries, prompb.TimeSeries{
+				Labels:  promLabels,
+				Samples: []prompb.Sample{{Value: point.value, Timestamp: timestamp.UnixNano() / int64(time.Millisecond)}},
+			})
+		}
+	}
+
+	return timeSeries
+}
+
+// sanitizeLabels returns the labels with sanitized names. The values of labels whose names sanitize to the
+// same name are joined with semicolons in the order of their original names, and empty labels are dropped as
+// remote write receivers drop them anyway
+func sanitizeLabels(labels map[string]string) map[string]string {
+	labelNames := make([]string, 0, len(labels))
+	for labelName, labelValue := range labels {
+		if labelValue != "" {
+			labelNames = append(labelNames, labelName)
+		}
+	}
+
+	sort.Strings(labelNames)
+
+	sanitizedLabels := make(map[string]string, len(labelNames))
+	for _, labelName := range labelNames {
+		sanitizedName := sanitizeLabelName(labelName)
+
+		if value, ok := sanitizedLabels[sanitizedName]; ok {
+			sanitizedLabels[sanitizedName] = value + ";" + labels[labelName]
+		} else {
+			sanitizedLabels[sanitizedName] = labels[labelName]
+		}
+	}
+
+	return sanitizedLabels
+}
+
+// sanitizeLabelName replaces the characters Prometheus doesn't allow in label names, anything outside
+// [a-zA-Z0-9_], with underscores
+func sanitizeLabelName(labelName string) string {
+	if labelName == "" {
+		return labelName
+	}
+
+	labelName = strings.Map(func(char rune) rune {
+		if isLabelNameChar(char) {
+			return char
+		}
+
+		return '_'
+	}, labelName)
+
+	if isDigit(rune(labelName[0])) {
+		return "key_" + labelName
+	}
+
+	if labelName[0] == '_' {
+		return "key" + labelName
+	}
+
+	return labelName
+}
+
+// isLabelNameChar returns whether the character is allowed in Prometheus label names
+func isLabelNameChar(char rune) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || isDigit(char) || char == '_'
+}
+
+// isDigit returns whether the character is an ASCII digit
+func isDigit(char rune) bool {
+	return char >= '0' && char <= '9'
+}
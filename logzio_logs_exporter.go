@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	logzioLogsExporterName    = "logzio_logs"
+	logzioListenerEnvName     = "LOGZIO_LISTENER"
+	logzioLogsTokenEnvName    = "LOGZIO_LOGS_TOKEN"
+	logzioLogsTypeEnvName     = "LOGZIO_LOGS_TYPE"
+	logzioLogsDefaultType     = meterName
+	logzioLogsTimeout         = 30 * time.Second
+	logzioLogsMaxBulkSize     = 9 * 1024 * 1024
+	probeEventSuccessMessage  = "Probe succeeded"
+	probeEventFailureMessage  = "Probe failed"
+	stateEventMessageFormat   = "State changed from %s to %s"
+	probeEventTimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+type logzioLogsExporter struct {
+	bulkURL        string
+	client         *http.Client
+	resourceLabels map[string]string
+	location       map[string]string
+}
+
+// probeEvent is the log document shipped for each probe
+type probeEvent struct {
+	Timestamp         string            `json:"@timestamp"`
+	Message           string            `json:"message"`
+	RunID             string            `json:"run_id,omitempty"`
+	Address           string            `json:"address"`
+	ResolvedIP        string            `json:"resolved_ip,omitempty"`
+	Success           bool              `json:"success"`
+	RTT               float64           `json:"rtt_ms,omitempty"`
+	Error             string            `json:"error,omitempty"`
+	ErrorReason       string            `json:"error_reason,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	AwsRegion         string            `json:"aws_region,omitempty"`
+	AwsLambdaFunction string            `json:"aws_lambda_function,omitempty"`
+	Location          map[string]string `json:"location,omitempty"`
+	Maintenance       bool              `json:"maintenance,omitempty"`
+}
+
+// stateEvent is the log document shipped when the state of a target changes
+type stateEvent struct {
+	Timestamp         string            `json:"@timestamp"`
+	Message           string            `json:"message"`
+	RunID             string            `json:"run_id,omitempty"`
+	Address           string            `json:"address"`
+	State             string            `json:"state"`
+	PreviousState     string            `json:"previous_state"`
+	PreviousSince     string            `json:"previous_state_since"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	AwsRegion         string            `json:"aws_region,omitempty"`
+	AwsLambdaFunction string            `json:"aws_lambda_function,omitempty"`
+	Location          map[string]string `json:"location,omitempty"`
+}
+
+func newLogzioLogsExporter(_ *logzioPingStatistics) (exporter, error) {
+	logzioListener := os.Getenv(logzioListenerEnvName)
+	if logzioListener == "" {
+		return nil, fmt.Errorf("%s must not be empty", logzioListenerEnvName)
+	}
+
+	logzioLogsToken := os.Getenv(logzioLogsTokenEnvName)
+	if logzioLogsToken == "" {
+		return nil, fmt.Errorf("%s must not be empty", logzioLogsTokenEnvName)
+	}
+
+	logsType := os.Getenv(logzioLogsTypeEnvName)
+	if logsType == "" {
+		logsType = logzioLogsDefaultType
+	}
+
+	bulkURL, err := url.Parse(logzioListener)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a valid URL: %v", logzioListenerEnvName, err)
+	}
+
+	if bulkURL.Path == "" {
+		bulkURL.Path = "/"
+	}
+
+	query := bulkURL.Query()
+	query.Set("token", logzioLogsToken)
+	query.Set("type", logsType)
+	bulkURL.RawQuery = query.Encode()
+
+	return &logzioLogsExporter{
+		bulkURL:        bulkURL.String(),
+		client:         &http.Client{Timeout: logzioLogsTimeout},
+		resourceLabels: getResourceLabels(),
+		location:       getLocationLabels(),
+	}, nil
+}
+
+func (lle *logzioLogsExporter) name() string {
+	return logzioLogsExporterName
+}
+
+func (lle *logzioLogsExporter) export(ctx context.Context, pingsStats []*pingStatistics) error {
+	bulk := &bytes.Buffer{}
+
+	for _, pingStats := range pingsStats {
+		events := make([]interface{}, 0, len(pingStats.probes)+1)
+		for _, probe := range pingStats.probes {
+			events = append(events, lle.getProbeEvent(pingStats, probe))
+		}
+
+		if pingStats.stateTransition != nil {
+			events = append(events, lle.getStateEvent(pingStats.stateTransition))
+		}
+
+		for _, event := range events {
+			document, err := json.Marshal(event)
+			if err != nil {
+				return fmt.Errorf("error marshaling event: %v", err)
+			}
+
+			if bulk.Len() > 0 && bulk.Len()+len(document)+1 > logzioLogsMaxBulkSize {
+				if err = lle.sendBulk(ctx, bulk.Bytes()); err != nil {
+					return err
+				}
+
+				bulk.Reset()
+			}
+
+			bulk.Write(document)
+			bulk.WriteByte('\n')
+		}
+	}
+
+	if bulk.Len() == 0 {
+		return nil
+	}
+
+	return lle.sendBulk(ctx, bulk.Bytes())
+}
+
+func (lle *logzioLogsExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+func (lle *logzioLogsExporter) getProbeEvent(pingStats *pingStatistics, probe *probeResult) *probeEvent {
+	event := &probeEvent{
+		Timestamp:         probe.timestamp.UTC().Format(probeEventTimestampLayout),
+		Message:           probeEventSuccessMessage,
+		RunID:             pingStats.runID,
+		Address:           probe.address,
+		ResolvedIP:        probe.resolvedIP,
+		Success:           probe.err == nil,
+		RTT:               probe.rtt,
+		Labels:            pingStats.labels,
+		AwsRegion:         lle.resourceLabels[awsRegionLabelName],
+		AwsLambdaFunction: lle.resourceLabels[awsLambdaFunctionLabelName],
+		Location:          lle.location,
+		Maintenance:       pingStats.maintenance,
+	}
+
+	if probe.err != nil {
+		event.Message = probeEventFailureMessage
+		event.Error = probe.err.Error()
+		event.ErrorReason = probe.errorReason
+	}
+
+	return event
+}
+
+func (lle *logzioLogsExporter) getStateEvent(transition *stateTransition) *stateEvent {
+	return &stateEvent{
+		Timestamp:         transition.ChangedAt.UTC().Format(probeEventTimestampLayout),
+		Message:           fmt.Sprintf(stateEventMessageFormat, transition.From, transition.To),
+		RunID:             transition.RunID,
+		Address:           transition.Address,
+		State:             transition.To,
+		PreviousState:     transition.From,
+		PreviousSince:     transition.Since.UTC().Format(probeEventTimestampLayout),
+		Labels:            transition.Labels,
+		AwsRegion:         lle.resourceLabels[awsRegionLabelName],
+		AwsLambdaFunction: lle.resourceLabels[awsLambdaFunctionLabelName],
+		Location:          lle.location,
+	}
+}
+
+func (lle *logzioLogsExporter) sendBulk(ctx context.Context, bulk []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, lle.bulkURL, bytes.NewReader(bulk))
+	if err != nil {
+		return fmt.Errorf("error creating bulk request: %v", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := lle.client.Do(request)
+	if err != nil {
+		// The request URL holds the logs token, so it is left out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return fmt.Errorf("error sending bulk request: %w", err)
+	}
+
+	defer func(body io.ReadCloser) {
+		if err = body.Close(); err != nil {
+			errorLogger.Println("Error closing bulk response body:", err)
+		}
+	}(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return &httpStatusError{backend: "logs listener", statusCode: response.StatusCode, status: response.Status}
+	}
+
+	return nil
+}
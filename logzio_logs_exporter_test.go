@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogzioLogsExporter_NoLogzioLogsToken(t *testing.T) {
+	err := os.Setenv(logzioListenerEnvName, "https://listener.logz.io:8071")
+	require.NoError(t, err)
+
+	_, err = newLogzioLogsExporter(nil)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestLogzioLogsExporter_Export(t *testing.T) {
+	err := os.Setenv(logzioListenerEnvName, "https://listener.logz.io:8071")
+	require.NoError(t, err)
+
+	err = os.Setenv(logzioLogsTokenEnvName, "123456789a")
+	require.NoError(t, err)
+
+	err = os.Setenv(awsRegionEnvName, "us-east-1")
+	require.NoError(t, err)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	events := make([]map[string]interface{}, 0)
+
+	httpmock.RegisterResponder(http.MethodPost, "https://listener.logz.io:8071/",
+		func(request *http.Request) (*http.Response, error) {
+			assert.Equal(t, "123456789a", request.URL.Query().Get("token"))
+			assert.Equal(t, logzioLogsDefaultType, request.URL.Query().Get("type"))
+
+			body, err := io.ReadAll(request.Body)
+			require.NoError(t, err)
+
+			scanner := bufio.NewScanner(bytes.NewReader(body))
+			for scanner.Scan() {
+				event := make(map[string]interface{})
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+
+				events = append(events, event)
+			}
+
+			return httpmock.NewStringResponse(http.StatusOK, ""), nil
+		})
+
+	exp, err := newLogzioLogsExporter(nil)
+	require.NoError(t, err)
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+	require.Len(t, events, 6)
+
+	assert.Equal(t, "2022-03-01T12:00:00.000Z", events[0]["@timestamp"])
+	assert.Equal(t, "www.google.com:80", events[0]["address"])
+	assert.Equal(t, "1.1.1.1", events[0]["resolved_ip"])
+	assert.Equal(t, true, events[0]["success"])
+	assert.Equal(t, 10.5, events[0]["rtt_ms"])
+	assert.Equal(t, "us-east-1", events[0]["aws_region"])
+	assert.NotContains(t, events[0], "error")
+
+	assert.Equal(t, false, events[1]["success"])
+	assert.Equal(t, probeEventFailureMessage, events[1]["message"])
+	assert.Equal(t, probeErrorReasonConnectionRefused, events[1]["error_reason"])
+	assert.NotContains(t, events[1], "rtt_ms")
+
+	assert.Equal(t, "3.3.3.3", events[3]["resolved_ip"])
+	assert.Equal(t, probeErrorReasonTimeout, events[3]["error_reason"])
+	assert.Equal(t, "dial tcp 3.3.3.3:8053: i/o timeout", events[3]["error"])
+
+	os.Clearenv()
+}
+
+func TestLogzioLogsExporter_ExportFailure(t *testing.T) {
+	err := os.Setenv(logzioListenerEnvName, "https://listener.logz.io:8071")
+	require.NoError(t, err)
+
+	err = os.Setenv(logzioLogsTokenEnvName, "123456789a")
+	require.NoError(t, err)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://listener.logz.io:8071/",
+		httpmock.NewStringResponder(http.StatusUnauthorized, ""))
+
+	exp, err := newLogzioLogsExporter(nil)
+	require.NoError(t, err)
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "123456789a")
+
+	os.Clearenv()
+}
+
+func TestLogzioLogsExporter_StateEvent(t *testing.T) {
+	exp := &logzioLogsExporter{resourceLabels: map[string]string{awsRegionLabelName: "us-east-1"}}
+
+	event := exp.getStateEvent(&stateTransition{
+		Address:   "www.google.com:80",
+		From:      targetStateDegraded,
+		To:        targetStateDown,
+		Since:     time.Date(2022, 3, 1, 11, 0, 0, 0, time.UTC),
+		ChangedAt: time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+		RunID:     "run-1",
+	})
+
+	assert.Equal(t, &stateEvent{
+		Timestamp:     "2022-03-01T12:00:00.000Z",
+		Message:       "State changed from degraded to down",
+		RunID:         "run-1",
+		Address:       "www.google.com:80",
+		State:         targetStateDown,
+		PreviousState: targetStateDegraded,
+		PreviousSince: "2022-03-01T11:00:00.000Z",
+		AwsRegion:     "us-east-1",
+	}, event)
+}
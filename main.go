@@ -2,88 +2,156 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-lambda-go/cfn"
 	"github.com/aws/aws-lambda-go/lambda"
-	metricsExporter "github.com/logzio/go-metrics-sdk"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/metric"
-	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
-	"go.opentelemetry.io/otel/sdk/resource"
-	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 )
 
 const (
-	addressesEnvName             = "ADDRESSES"
-	pingCountEnvName             = "PING_COUNT"
-	pingIntervalEnvName          = "PING_INTERVAL"
-	pingTimeoutEnvName           = "PING_TIMEOUT"
-	logzioMetricsListenerEnvName = "LOGZIO_METRICS_LISTENER"
-	logzioMetricsTokenEnvName    = "LOGZIO_METRICS_TOKEN"
-	awsRegionEnvName             = "AWS_REGION"
-	awsLambdaFunctionNameEnvName = "AWS_LAMBDA_FUNCTION_NAME"
-	addressHttpsPrefix           = "https://"
-	addressHttpPrefix            = "http://"
-	addressTcpPrefix             = "tcp://"
-	addressSuffixDefaultPort     = ":80"
-	meterName                    = "ping_stats"
-	rttMetricName                = meterName + "_rtt"
-	probesSentMetricName         = meterName + "_probes_sent"
-	successfulProbesMetricName   = meterName + "_successful_probes"
-	probesFailedMetricName       = meterName + "_probes_failed"
-	awsRegionLabelName           = "aws_region"
-	awsLambdaFunctionLabelName   = "aws_lambda_function"
-	addressLabelName             = "address"
-	unitLabelName                = "unit"
-	rttMetricRttIndexLabelName   = "rtt_index"
-	rttMetricTotalRttsLabelName  = "total_rtts"
-	rttMetricUnitLabelValue      = "milliseconds"
+	addressesEnvName                  = "ADDRESSES"
+	pingCountEnvName                  = "PING_COUNT"
+	pingIntervalEnvName               = "PING_INTERVAL"
+	pingTimeoutEnvName                = "PING_TIMEOUT"
+	logzioMetricsListenerEnvName      = "LOGZIO_METRICS_LISTENER"
+	logzioMetricsTokenEnvName         = "LOGZIO_METRICS_TOKEN"
+	exportersEnvName                  = "EXPORTERS"
+	targetLabelsEnvName               = "TARGET_LABELS"
+	awsRegionEnvName                  = "AWS_REGION"
+	awsLambdaFunctionNameEnvName      = "AWS_LAMBDA_FUNCTION_NAME"
+	addressHttpsPrefix                = "https://"
+	addressHttpPrefix                 = "http://"
+	addressTcpPrefix                  = "tcp://"
+	addressSuffixDefaultPort          = ":80"
+	meterName                         = "ping_stats"
+	rttMetricName                     = meterName + "_rtt"
+	probesSentMetricName              = meterName + "_probes_sent"
+	successfulProbesMetricName        = meterName + "_successful_probes"
+	probesFailedMetricName            = meterName + "_probes_failed"
+	awsRegionLabelName                = "aws_region"
+	awsLambdaFunctionLabelName        = "aws_lambda_function"
+	addressLabelName                  = "address"
+	unitLabelName                     = "unit"
+	rttMetricRttIndexLabelName        = "rtt_index"
+	rttMetricTotalRttsLabelName       = "total_rtts"
+	rttMetricUnitLabelValue           = "milliseconds"
+	probeErrorReasonDNS               = "dns"
+	probeErrorReasonConnectionRefused = "connection_refused"
+	probeErrorReasonUnreachable       = "unreachable"
+	probeErrorReasonTimeout           = "timeout"
+	probeErrorReasonOther             = "other"
 )
 
 var (
 	debugLogger = log.New(os.Stdout, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
 	infoLogger  = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
 	errorLogger = log.New(os.Stdout, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+
+	labelNameRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+	// builtInLabelNames are the labels the exporters add themselves, besides the location labels
+	builtInLabelNames = []string{
+		addressLabelName, unitLabelName, rttMetricRttIndexLabelName, rttMetricTotalRttsLabelName,
+		awsRegionLabelName, awsLambdaFunctionLabelName, truncatedLabelName, maintenanceLabelName,
+		pingCountLabelName, pingIntervalLabelName, pingTimeoutLabelName, resolvedIPTagName, errorReasonTagName,
+	}
 )
 
 type logzioPingStatistics struct {
 	ctx                   context.Context
+	exportCtx             context.Context
 	logzioMetricsListener string
 	logzioMetricsToken    string
+	logzioDestinations    []*logzioDestination
 	addresses             []string
 	pingCount             int
 	pingInterval          time.Duration
 	pingTimeout           time.Duration
+	targetLabels          map[string]map[string]string
+	exporterNames         []string
+	exporters             []exporter
+	delivery              *deliveryConfig
+	runID                 string
 	pingsStats            []*pingStatistics
+	probeHandler          func(sequence int, probe *probeResult)
+	cycleHandler          func(pingStats *pingStatistics, elapsed time.Duration, exportErr error)
+	alerts                *alertEvaluator
+	states                *stateTracker
+	maintenanceWindows    []*maintenanceWindow
+	exportTimeReserve     time.Duration
+	exportLock            sync.Mutex
 }
 
 type pingStatistics struct {
+	runID            string
 	probesSent       int
 	successfulProbes int
 	probesFailed     int
 	address          string
+	labels           map[string]string
 	rtts             []float64
+	probes           []*probeResult
+	truncated        bool
+	state            string
+	stateTransition  *stateTransition
+	maintenance      bool
+}
+
+type rttStatistics struct {
+	min  float64
+	avg  float64
+	max  float64
+	mdev float64
+}
+
+// probeResult is the outcome of a single TCP connect to an address
+type probeResult struct {
+	timestamp   time.Time
+	address     string
+	resolvedIP  string
+	rtt         float64
+	err         error
+	errorReason string
 }
 
 func newLogzioPingStatistics(ctx context.Context) (*logzioPingStatistics, error) {
-	logzioMetricsListener := os.Getenv(logzioMetricsListenerEnvName)
-	if logzioMetricsListener == "" {
-		return nil, fmt.Errorf("%s must not be empty", logzioMetricsListenerEnvName)
+	return newOverriddenLogzioPingStatistics(ctx, nil)
+}
+
+// newOverriddenLogzioPingStatistics returns the configuration of the environment variables with the overrides
+// of an on-demand run applied, before the exporters are created so they report the configuration of the run
+func newOverriddenLogzioPingStatistics(ctx context.Context, overrides *runOverrides) (*logzioPingStatistics, error) {
+	logzioPingStats, err := newUnexportedLogzioPingStatistics(ctx, overrides)
+	if err != nil {
+		return nil, err
 	}
 
-	logzioMetricsToken := os.Getenv(logzioMetricsTokenEnvName)
-	if logzioMetricsToken == "" {
-		return nil, fmt.Errorf("%s must not be empty", logzioMetricsTokenEnvName)
+	// Exporters are created upfront so a misconfigured backend fails before probing
+	if logzioPingStats.exporters, err = logzioPingStats.createExporters(); err != nil {
+		return nil, err
 	}
 
+	return logzioPingStats, nil
+}
+
+// newUnexportedLogzioPingStatistics returns the configuration of the environment variables with the overrides
+// applied, without creating the exporters, which open listeners, connections and files
+func newUnexportedLogzioPingStatistics(ctx context.Context, overrides *runOverrides) (*logzioPingStatistics, error) {
 	addressesString := os.Getenv(addressesEnvName)
 	if addressesString == "" {
 		return nil, fmt.Errorf("%s must not be empty", addressesEnvName)
@@ -106,35 +174,128 @@ func newLogzioPingStatistics(ctx context.Context) (*logzioPingStatistics, error)
 		return nil, err
 	}
 
-	return &logzioPingStatistics{
+	targetLabels, err := getTargetLabels(os.Getenv(targetLabelsEnvName), addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	logzioDestinations, err := getLogzioDestinations(os.Getenv(logzioDestinationsEnvName), addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := newDeliveryConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	exportTimeReserve, err := getExportTimeReserve()
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := newAlertEvaluator(os.Getenv(alertRulesEnvName), os.Getenv(alertNotifiersEnvName), addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := newStateTracker()
+	if err != nil {
+		return nil, err
+	}
+
+	maintenanceWindows, err := getMaintenanceWindows(os.Getenv(maintenanceWindowsEnvName), addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	logzioPingStats := &logzioPingStatistics{
 		ctx:                   ctx,
-		logzioMetricsListener: logzioMetricsListener,
-		logzioMetricsToken:    logzioMetricsToken,
+		logzioMetricsListener: os.Getenv(logzioMetricsListenerEnvName),
+		logzioMetricsToken:    os.Getenv(logzioMetricsTokenEnvName),
+		logzioDestinations:    logzioDestinations,
 		addresses:             addresses,
 		pingCount:             *pingCount,
 		pingInterval:          time.Duration(*pingInterval) * time.Second,
 		pingTimeout:           time.Duration(*pingTimeout) * time.Second,
+		targetLabels:          targetLabels,
+		exporterNames:         getExporterNames(os.Getenv(exportersEnvName)),
+		delivery:              delivery,
+		exportTimeReserve:     exportTimeReserve,
+		alerts:                alerts,
+		states:                states,
+		maintenanceWindows:    maintenanceWindows,
 		pingsStats:            make([]*pingStatistics, 0),
-	}, nil
+	}
+
+	if overrides != nil {
+		if err = overrides.apply(logzioPingStats); err != nil {
+			return nil, fmt.Errorf("error overriding the configuration: %v", err)
+		}
+	}
+
+	return logzioPingStats, nil
 }
 
 func (lps *logzioPingStatistics) getAddressPingStatistics(address string) (*pingStatistics, error) {
+	return lps.probeAddress(address, lps.getProbeDeadline())
+}
+
+// probeAddress probes the address until its probes are done or the probe deadline
+func (lps *logzioPingStatistics) probeAddress(address string, probeDeadline time.Time) (*pingStatistics, error) {
 	debugLogger.Println("Getting ping statistics for address:", address)
 
 	rtts := make([]float64, 0)
+	probes := make([]*probeResult, 0)
 	successfulProbes := 0
+	truncated := false
+
+	probeCtx := lps.ctx
+	if probeCtx == nil {
+		probeCtx = context.Background()
+	}
 
 	for count := 0; count < lps.pingCount; count++ {
-		time.Sleep(lps.pingInterval)
+		probeTimeout, ok := lps.getProbeTimeout(probeDeadline)
+		if !ok {
+			errorLogger.Println("Not enough time left before the deadline, stopping to probe address:", address)
+			truncated = true
+			break
+		}
+
+		if !sleepContext(probeCtx, lps.pingInterval) {
+			infoLogger.Println("Probing canceled, stopping to probe address:", address)
+			truncated = true
+			break
+		}
 
 		start := time.Now()
-		conn, err := net.DialTimeout("tcp", address, lps.pingTimeout)
+		dialer := &net.Dialer{Timeout: probeTimeout}
+		conn, err := dialer.DialContext(probeCtx, "tcp", address)
 		if err != nil {
+			// A probe cut off by the cancellation says nothing about the address, so it is not counted
+			if probeCtx.Err() != nil {
+				infoLogger.Println("Probing canceled, stopping to probe address:", address)
+				truncated = true
+				break
+			}
+
 			errorLogger.Println("Error connecting to address:", address, ":", err)
+
+			probes = append(probes, &probeResult{
+				timestamp:   start,
+				address:     address,
+				resolvedIP:  getErrorResolvedIP(err),
+				err:         err,
+				errorReason: getProbeErrorReason(err),
+			})
+
+			lps.handleProbe(count+1, probes[len(probes)-1])
 			continue
 		}
 
 		end := time.Now()
+		resolvedIP := getConnResolvedIP(conn)
 
 		if err = conn.Close(); err != nil {
 			return nil, fmt.Errorf("error closing connection: %v", err)
@@ -144,6 +305,14 @@ func (lps *logzioPingStatistics) getAddressPingStatistics(address string) (*ping
 		successfulProbes++
 
 		rtts = append(rtts, rtt)
+		probes = append(probes, &probeResult{
+			timestamp:  start,
+			address:    address,
+			resolvedIP: resolvedIP,
+			rtt:        rtt,
+		})
+
+		lps.handleProbe(count+1, probes[len(probes)-1])
 	}
 
 	if len(rtts) == 0 {
@@ -151,24 +320,45 @@ func (lps *logzioPingStatistics) getAddressPingStatistics(address string) (*ping
 	}
 
 	return &pingStatistics{
-		probesSent:       lps.pingCount,
+		probesSent:       len(probes),
 		successfulProbes: successfulProbes,
-		probesFailed:     lps.pingCount - successfulProbes,
+		probesFailed:     len(probes) - successfulProbes,
 		address:          address,
+		labels:           lps.targetLabels[address],
 		rtts:             rtts,
+		probes:           probes,
+		truncated:        truncated,
 	}, nil
 }
 
+// handleProbe passes a probe to the probe handler, if there is one, as soon as the probe is done
+func (lps *logzioPingStatistics) handleProbe(sequence int, probe *probeResult) {
+	if lps.probeHandler != nil {
+		lps.probeHandler(sequence, probe)
+	}
+}
+
 func (lps *logzioPingStatistics) getAllAddressesPingStatistics() error {
 	debugLogger.Println("Getting ping statistics for all addresses...")
 
-	for _, address := range lps.addresses {
-		pingStats, err := lps.getAddressPingStatistics(address)
+	lps.runID = newRunID()
+	lps.warnIfOverBudget()
+
+	probeDeadline := lps.getProbeDeadline()
+
+	for index, address := range lps.addresses {
+		if lps.ctx != nil && lps.ctx.Err() != nil {
+			infoLogger.Println("Probing canceled, skipping the remaining addresses")
+			break
+		}
+
+		pingStats, err := lps.probeAddress(address, getAddressProbeDeadline(probeDeadline, len(lps.addresses)-index))
 		if err != nil {
 			errorLogger.Println("Error getting ping statistics for address", address, ":", err)
 			continue
 		}
 
+		pingStats.runID = lps.runID
 		lps.pingsStats = append(lps.pingsStats, pingStats)
 	}
 
@@ -179,140 +369,133 @@ func (lps *logzioPingStatistics) getAllAddressesPingStatistics() error {
 	return nil
 }
 
-func (lps *logzioPingStatistics) createController() (*controller.Controller, error) {
-	debugLogger.Println("Creating controller...")
-
-	config := metricsExporter.Config{
-		LogzioMetricsListener: lps.logzioMetricsListener,
-		LogzioMetricsToken:    lps.logzioMetricsToken,
-		RemoteTimeout:         30 * time.Second,
-		PushInterval:          15 * time.Second,
-	}
-
-	return metricsExporter.InstallNewPipeline(config,
-		controller.WithCollectPeriod(5*time.Second),
-		controller.WithResource(
-			resource.NewWithAttributes(
-				semconv.SchemaURL,
-				attribute.String(awsRegionLabelName, os.Getenv(awsRegionEnvName)),
-				attribute.String(awsLambdaFunctionLabelName, os.Getenv(awsLambdaFunctionNameEnvName)),
-			),
-		),
-	)
-}
-
-func (lps *logzioPingStatistics) getRttObserverCallback() func(context.Context, metric.Float64ObserverResult) {
-	return func(_ context.Context, result metric.Float64ObserverResult) {
-		debugLogger.Println("Running RTT observer callback...")
-
-		for _, pingStats := range lps.pingsStats {
-			for index, rtt := range pingStats.rtts {
-				result.Observe(rtt,
-					attribute.String(addressLabelName, pingStats.address),
-					attribute.Int(rttMetricRttIndexLabelName, index+1),
-					attribute.Int(rttMetricTotalRttsLabelName, len(pingStats.rtts)),
-					attribute.String(unitLabelName, rttMetricUnitLabelValue),
-				)
-			}
-		}
+// getExportContext returns the context of the exports. The daemon and the ping command cancel the probing
+// context on shutdown, and export with a context that outlives it, so the results gathered so far still go out.
+func (lps *logzioPingStatistics) getExportContext() context.Context {
+	if lps.exportCtx != nil {
+		return lps.exportCtx
 	}
-}
 
-func (lps *logzioPingStatistics) getProbesSentObserverCallback() func(context.Context, metric.Int64ObserverResult) {
-	return func(_ context.Context, result metric.Int64ObserverResult) {
-		debugLogger.Println("Running probes sent observer callback...")
+	return lps.ctx
+}
 
-		for _, pingStats := range lps.pingsStats {
-			result.Observe(int64(pingStats.probesSent),
-				attribute.String(addressLabelName, pingStats.address))
-		}
+// trackStates moves the targets between the up, degraded, down and flapping states with the results of the run
+func (lps *logzioPingStatistics) trackStates(pingsStats []*pingStatistics) {
+	if lps.states != nil {
+		lps.states.track(lps.getExportContext(), pingsStats)
 	}
 }
 
-func (lps *logzioPingStatistics) getSuccessfulProbesObserverCallback() func(context.Context, metric.Int64ObserverResult) {
-	return func(_ context.Context, result metric.Int64ObserverResult) {
-		debugLogger.Println("Running successful probes observer callback...")
-
-		for _, pingStats := range lps.pingsStats {
-			result.Observe(int64(pingStats.successfulProbes),
-				attribute.String(addressLabelName, pingStats.address))
-		}
+// evaluateAlerts notifies about the alert rules that started or stopped firing with the results of the run
+func (lps *logzioPingStatistics) evaluateAlerts(pingsStats []*pingStatistics) {
+	if lps.alerts != nil {
+		lps.alerts.evaluate(lps.getExportContext(), pingsStats)
 	}
 }
 
-func (lps *logzioPingStatistics) getProbesFailedObserverCallback() func(context.Context, metric.Int64ObserverResult) {
-	return func(_ context.Context, result metric.Int64ObserverResult) {
-		debugLogger.Println("Running probes failed observer callback...")
+func (lps *logzioPingStatistics) collectMetrics() error {
+	_, err := lps.exportPingsStats(lps.pingsStats)
+	return err
+}
+
+// exportPingsStats sends the ping statistics to every exporter, and returns the status of each export.
+// Exports are serialized, since the exporters are not safe for concurrent use and the daemon exports
+// each target as soon as its probes are done.
+func (lps *logzioPingStatistics) exportPingsStats(pingsStats []*pingStatistics) ([]*exportStatus, error) {
+	lps.exportLock.Lock()
+	defer lps.exportLock.Unlock()
 
-		for _, pingStats := range lps.pingsStats {
-			result.Observe(int64(pingStats.probesFailed),
-				attribute.String(addressLabelName, pingStats.address))
+	if lps.exporters == nil {
+		exporters, err := lps.createExporters()
+		if err != nil {
+			return nil, fmt.Errorf("error creating exporters: %v", err)
 		}
+
+		lps.exporters = exporters
 	}
-}
 
-func (lps *logzioPingStatistics) collectMetrics() error {
-	cont, err := lps.createController()
-	if err != nil {
-		panic(fmt.Errorf("error creating controller: %v", err))
+	delivery := lps.delivery
+	if delivery == nil {
+		delivery = &deliveryConfig{}
 	}
 
 	debugLogger.Println("Collecting metrics...")
 
-	defer func() {
-		handleErr(cont.Stop(lps.ctx))
-	}()
+	// An address that ran out of time before its first probe has no results, rather than zero-valued ones
+	probedPingsStats := make([]*pingStatistics, 0, len(pingsStats))
+	for _, pingStats := range pingsStats {
+		if pingStats.probesSent > 0 {
+			probedPingsStats = append(probedPingsStats, pingStats)
+		}
+	}
 
-	meter := cont.Meter(meterName)
+	pingsStats = probedPingsStats
 
-	_ = metric.Must(meter).NewFloat64GaugeObserver(
-		rttMetricName,
-		lps.getRttObserverCallback(),
-		metric.WithDescription("Ping RTT"),
-	)
+	// A failing exporter does not keep the others from delivering
+	errs := make([]string, 0)
+	exportStatuses := make([]*exportStatus, 0, len(lps.exporters))
 
-	_ = metric.Must(meter).NewInt64GaugeObserver(
-		probesSentMetricName,
-		lps.getProbesSentObserverCallback(),
-		metric.WithDescription("Ping probes sent"),
-	)
+	exportCtx := lps.getExportContext()
 
-	_ = metric.Must(meter).NewInt64GaugeObserver(
-		successfulProbesMetricName,
-		lps.getSuccessfulProbesObserverCallback(),
-		metric.WithDescription("Ping successful probes"),
-	)
+	for _, exporter := range lps.exporters {
+		delivery.sendSpooledBatches(exportCtx, exporter)
 
-	_ = metric.Must(meter).NewInt64GaugeObserver(
-		probesFailedMetricName,
-		lps.getProbesFailedObserverCallback(),
-		metric.WithDescription("Ping probes failed"),
-	)
+		if len(pingsStats) == 0 {
+			continue
+		}
 
-	return nil
-}
+		status := &exportStatus{Exporter: exporter.name(), Success: true}
 
-func run(ctx context.Context) error {
-	logzioPingStats, err := newLogzioPingStatistics(ctx)
-	if err != nil {
-		return fmt.Errorf("error creating logzioPingStatistics instance: %v", err)
+		if err := delivery.deliver(exportCtx, exporter, pingsStats); err != nil {
+			status.Success = false
+			status.Error = err.Error()
+			errs = append(errs, fmt.Sprintf("error exporting metrics with %s exporter: %v", exporter.name(), err))
+		}
+
+		exportStatuses = append(exportStatuses, status)
 	}
 
-	if err = logzioPingStats.getAllAddressesPingStatistics(); err != nil {
-		return fmt.Errorf("error getting all addresses ping statistics: %v", err)
+	if len(errs) > 0 {
+		return exportStatuses, fmt.Errorf("%s", strings.Join(errs, "; "))
 	}
 
-	if err = logzioPingStats.collectMetrics(); err != nil {
-		return fmt.Errorf("error collecting metrics: %v", err)
+	return exportStatuses, nil
+}
+
+// run probes and exports once with the configuration of the environment variables and the overrides.
+// The summary is returned whenever the addresses were probed, even if an export failed.
+func run(ctx context.Context, overrides *runOverrides) (*runSummary, error) {
+	logzioPingStats, err := newOverriddenLogzioPingStatistics(ctx, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("error creating logzioPingStatistics instance: %v", err)
 	}
 
-	return nil
+	defer logzioPingStats.shutdownExporters()
+
+	return logzioPingStats.runCycle()
 }
 
-func handleErr(err error) {
+// runCycle probes all the addresses and exports the results of this cycle only
+func (lps *logzioPingStatistics) runCycle() (*runSummary, error) {
+	lps.pingsStats = make([]*pingStatistics, 0)
+	start := time.Now()
+
+	if err := lps.getAllAddressesPingStatistics(); err != nil {
+		return nil, fmt.Errorf("error getting all addresses ping statistics: %v", err)
+	}
+
+	lps.markMaintenance(lps.pingsStats, start)
+	lps.trackStates(lps.pingsStats)
+	lps.evaluateAlerts(lps.pingsStats)
+
+	exportStatuses, err := lps.exportPingsStats(lps.pingsStats)
+	summary := getRunSummary(lps.runID, lps.pingsStats, exportStatuses)
+
 	if err != nil {
-		panic(fmt.Errorf("something went wrong: %v", err))
+		return summary, fmt.Errorf("error collecting metrics: %v", err)
 	}
+
+	return summary, nil
 }
 
 func getAddresses(addressesString string) []string {
@@ -338,6 +521,77 @@ func getAddresses(addressesString string) []string {
 	return addresses
 }
 
+// getRttStatistics returns the min/avg/max/mdev of the RTTs, computed like iputils ping does, or nil if there are none
+func getRttStatistics(rtts []float64) *rttStatistics {
+	if len(rtts) == 0 {
+		return nil
+	}
+
+	stats := &rttStatistics{min: rtts[0], max: rtts[0]}
+	sum := float64(0)
+	squaresSum := float64(0)
+
+	for _, rtt := range rtts {
+		stats.min = math.Min(stats.min, rtt)
+		stats.max = math.Max(stats.max, rtt)
+		sum += rtt
+		squaresSum += rtt * rtt
+	}
+
+	stats.avg = sum / float64(len(rtts))
+	stats.mdev = math.Sqrt(math.Max(squaresSum/float64(len(rtts))-stats.avg*stats.avg, 0))
+
+	return stats
+}
+
+// newRunID returns a random ID that ties together the results of a single run
+func newRunID() string {
+	runID := make([]byte, 16)
+	if _, err := rand.Read(runID); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(runID)
+}
+
+func getConnResolvedIP(conn net.Conn) string {
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+
+	return ""
+}
+
+// getErrorResolvedIP returns the IP a failed connect was made to, if the address was resolved before failing
+func getErrorResolvedIP(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		if tcpAddr, ok := opErr.Addr.(*net.TCPAddr); ok {
+			return tcpAddr.IP.String()
+		}
+	}
+
+	return ""
+}
+
+func getProbeErrorReason(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return probeErrorReasonDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return probeErrorReasonConnectionRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return probeErrorReasonUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return probeErrorReasonTimeout
+	default:
+		return probeErrorReasonOther
+	}
+}
+
 func getNumberEnvValue(envValue string, envName string) (*int, error) {
 	numberEnvValue, err := strconv.Atoi(envValue)
 	if err != nil {
@@ -351,31 +605,185 @@ func getNumberEnvValue(envValue string, envName string) (*int, error) {
 	return &numberEnvValue, nil
 }
 
-// Wrapper for first invocation from cloud formation custom resource
-func customResourceRun(ctx context.Context, event cfn.Event) (physicalResourceID string, data map[string]interface{}, err error) {
-	if err = run(ctx); err != nil {
-		errorLogger.Printf("Error in first running: %s", err.Error())
+// getTargetLabels parses a JSON object mapping addresses to their custom labels
+func getTargetLabels(envValue string, addresses []string) (map[string]map[string]string, error) {
+	targetLabels := make(map[string]map[string]string)
+	if envValue == "" {
+		return targetLabels, nil
 	}
-	return "MyPingResourceID", map[string]interface{}{}, err
+
+	rawTargetLabels := make(map[string]map[string]string)
+	if err := json.Unmarshal([]byte(envValue), &rawTargetLabels); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON object of address to labels: %v", targetLabelsEnvName, err)
+	}
+
+	for address, labels := range rawTargetLabels {
+		// The addresses are normalized the same way as ADDRESSES, so both can be written the same
+		normalizedAddress := getAddresses(address)[0]
+
+		if !containsString(addresses, normalizedAddress) {
+			return nil, fmt.Errorf("%s contains labels of an address that is not in %s: %s", targetLabelsEnvName, addressesEnvName, address)
+		}
+
+		if err := validateLabelNames(labels); err != nil {
+			return nil, fmt.Errorf("%s contains invalid labels of %s: %v", targetLabelsEnvName, address, err)
+		}
+
+		targetLabels[normalizedAddress] = labels
+	}
+
+	return targetLabels, nil
 }
 
-func HandleRequest(ctx context.Context, event cfn.Event) error {
-	infoLogger.Println("Starting to get ping statistics for all addresses...")
+// validateLabelNames returns an error if a label name isn't a valid Prometheus label name, is reserved for
+// internal use by starting with two underscores, or is the name of a built-in label, which it would override
+func validateLabelNames(labels map[string]string) error {
+	for labelName := range labels {
+		if !labelNameRegexp.MatchString(labelName) {
+			return fmt.Errorf("label name %q must match %s", labelName, labelNameRegexp)
+		}
 
-	// If requestID is empty - the lambda call is not from a custom resource
-	if event.RequestID == "" {
-		if err := run(ctx); err != nil {
-			return err
+		if strings.HasPrefix(labelName, "__") {
+			return fmt.Errorf("label name %q must not start with __, which is reserved", labelName)
+		}
+
+		if _, ok := locationEnvNames[labelName]; ok || containsString(builtInLabelNames, labelName) {
+			return fmt.Errorf("label name %q is the name of a built-in label", labelName)
 		}
-	} else {
-		// Custom resource invocation
-		lambda.Start(cfn.LambdaWrap(customResourceRun))
 	}
 
-	infoLogger.Println("The ping statistics have been sent to Logz.io successfully")
 	return nil
 }
 
+func containsString(values []string, value string) bool {
+	for _, currentValue := range values {
+		if currentValue == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sleepContext waits for the duration, and returns false if ctx is done before it passes
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	if duration <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func getBoolEnvValue(envValue string, envName string) (bool, error) {
+	if envValue == "" {
+		return false, nil
+	}
+
+	boolEnvValue, err := strconv.ParseBool(envValue)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", envName)
+	}
+
+	return boolEnvValue, nil
+}
+
+// getKeyValuePairs parses a comma-separated list of key=value pairs
+func getKeyValuePairs(envValue string, envName string) (map[string]string, error) {
+	pairs := make(map[string]string)
+
+	for _, pair := range strings.Split(envValue, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		keyValue := strings.SplitN(pair, "=", 2)
+		if len(keyValue) != 2 || strings.TrimSpace(keyValue[0]) == "" {
+			return nil, fmt.Errorf("%s must be a comma-separated list of key=value pairs", envName)
+		}
+
+		pairs[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+	}
+
+	return pairs, nil
+}
+
+// HandleRequest handles the CloudFormation custom resource events, and runs with the overrides
+// of the payload for any other invocation. It returns the summary of the run. A failed export fails the
+// invocation, and the error message ends with the summary, as Lambda drops the response of a failed invocation.
+func HandleRequest(ctx context.Context, payload json.RawMessage) (*runSummary, error) {
+	event := cfn.Event{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("error parsing the invocation payload: %v", err)
+		}
+	}
+
+	// If requestID is empty - the lambda call is not from a custom resource
+	if event.RequestID != "" {
+		if _, err := cfn.LambdaWrap(customResourceRun)(ctx, event); err != nil {
+			return nil, fmt.Errorf("error sending the custom resource response: %v", err)
+		}
+
+		return nil, nil
+	}
+
+	overrides, err := getRunOverrides(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	infoLogger.Println("Starting to get ping statistics for all addresses...")
+
+	summary, err := run(ctx, overrides)
+	if summary == nil {
+		return nil, err
+	}
+
+	// A failed delivery fails the invocation, so it shows in the Lambda error metrics and retries.
+	// Lambda drops the response of a failed invocation, so the summary goes in the error message.
+	if err != nil {
+		errorLogger.Println("Error in run:", err)
+		return summary, fmt.Errorf("%v, run summary: %s", err, summary)
+	}
+
+	infoLogger.Println("The ping statistics have been exported successfully with:", strings.Join(summary.getExporterNames(), ", "))
+	return summary, nil
+}
+
 func main() {
-	lambda.Start(HandleRequest)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case pingCommandName:
+			os.Exit(runPingCommand(os.Args[2:], os.Stdout))
+		case historyCommandName:
+			os.Exit(runHistoryCommand(os.Args[2:], os.Stdout, time.Now()))
+		}
+	}
+
+	daemonFlag := flag.Bool(daemonFlagName, false, "Run as a long-running daemon instead of a Lambda function")
+	flag.Parse()
+
+	runMode, err := getRunMode(*daemonFlag)
+	if err != nil {
+		errorLogger.Println(err)
+		os.Exit(1)
+	}
+
+	if runMode == runModeLambda {
+		lambda.Start(HandleRequest)
+		return
+	}
+
+	if err = runDaemon(context.Background()); err != nil {
+		errorLogger.Println("Error running daemon:", err)
+		os.Exit(1)
+	}
 }
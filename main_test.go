@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"testing"
@@ -395,20 +396,39 @@ func TestGetAllAddressesPingStatistics_Success(t *testing.T) {
 	}
 }
 
-func TestCreateController_Success(t *testing.T) {
-	logzioPingStats := &logzioPingStatistics{
-		ctx:                   context.Background(),
-		logzioMetricsListener: "https://listener.logz.io:8053",
-		logzioMetricsToken:    "123456789a",
-		addresses:             []string{"www.google.com:80", "listener.logz.io:8053"},
-		pingCount:             10,
-		pingInterval:          1 * time.Second,
-		pingTimeout:           10 * time.Second,
-	}
+func TestGetTimeSeries_Success(t *testing.T) {
+	pingsStats := getTestPingsStats()
+	pingsStats[0].labels = map[string]string{"team.name": "search"}
+
+	timeSeries := getTimeSeries(pingsStats, map[string]string{awsRegionLabelName: "us-east-1", awsLambdaFunctionLabelName: ""})
+	require.Len(t, timeSeries, 8)
+
+	assert.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: rttMetricName},
+		{Name: addressLabelName, Value: "www.google.com:80"},
+		{Name: awsRegionLabelName, Value: "us-east-1"},
+		{Name: rttMetricRttIndexLabelName, Value: "1"},
+		{Name: "team_name", Value: "search"},
+		{Name: rttMetricTotalRttsLabelName, Value: "2"},
+		{Name: unitLabelName, Value: rttMetricUnitLabelValue},
+	}, timeSeries[0].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 10.5, Timestamp: testProbesTimestamp.Add(2*time.Second).UnixNano() / int64(time.Millisecond)}}, timeSeries[0].Samples)
+	assert.Equal(t, float64(3), timeSeries[7].Samples[0].Value)
+}
 
-	cont, err := logzioPingStats.createController()
-	require.NoError(t, err)
-	require.NotNil(t, cont)
+func TestSanitizeLabels(t *testing.T) {
+	assert.Equal(t, "r_gion", sanitizeLabelName("région"))
+	assert.Equal(t, "key_1st", sanitizeLabelName("1st"))
+	assert.Equal(t, "key_team", sanitizeLabelName("_team"))
+
+	labels := sanitizeLabels(map[string]string{
+		"team-name": "logs",
+		"team.name": "search",
+		"zone":      "",
+		"région":    "eu",
+	})
+
+	assert.Equal(t, map[string]string{"team_name": "logs;search", "r_gion": "eu"}, labels)
 }
 
 func TestCollectMetrics_Success(t *testing.T) {
@@ -540,8 +560,185 @@ func TestRun_Success(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-	err = run(context.Background())
+	summary, err := run(context.Background(), nil)
 	require.NoError(t, err)
+	require.NotNil(t, summary)
 
 	os.Clearenv()
 }
+
+func TestGetAddressPingStatistics_Probes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			_ = conn.Close()
+		}
+	}()
+
+	address := listener.Addr().String()
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          context.Background(),
+		pingCount:    2,
+		pingInterval: 1 * time.Millisecond,
+		pingTimeout:  1 * time.Second,
+	}
+
+	pingStats, err := logzioPingStats.getAddressPingStatistics(address)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, pingStats.successfulProbes)
+	require.Len(t, pingStats.probes, 2)
+
+	for index, probe := range pingStats.probes {
+		assert.Equal(t, address, probe.address)
+		assert.Equal(t, "127.0.0.1", probe.resolvedIP)
+		assert.Equal(t, pingStats.rtts[index], probe.rtt)
+		assert.NoError(t, probe.err)
+		assert.False(t, probe.timestamp.IsZero())
+	}
+
+	require.NoError(t, listener.Close())
+
+	pingStats, err = logzioPingStats.getAddressPingStatistics(address)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, pingStats.probesFailed)
+	require.Len(t, pingStats.probes, 2)
+
+	for _, probe := range pingStats.probes {
+		assert.Error(t, probe.err)
+		assert.Equal(t, "127.0.0.1", probe.resolvedIP)
+		assert.Equal(t, probeErrorReasonConnectionRefused, probe.errorReason)
+	}
+}
+
+func TestGetAddressPingStatistics_Canceled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          ctx,
+		pingCount:    100,
+		pingInterval: 100 * time.Millisecond,
+		pingTimeout:  time.Second,
+	}
+
+	time.AfterFunc(250*time.Millisecond, cancel)
+	start := time.Now()
+
+	pingStats, err := logzioPingStats.getAddressPingStatistics(listener.Addr().String())
+	require.NoError(t, err)
+
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+	assert.Equal(t, 2, pingStats.probesSent)
+	assert.Equal(t, 2, pingStats.successfulProbes)
+	assert.Len(t, pingStats.probes, 2)
+	assert.True(t, pingStats.truncated)
+}
+
+func TestGetAllAddressesPingStatistics_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          ctx,
+		addresses:    []string{"127.0.0.1:1", "127.0.0.1:2"},
+		pingCount:    3,
+		pingInterval: time.Second,
+		pingTimeout:  time.Second,
+	}
+
+	start := time.Now()
+	err := logzioPingStats.getAllAddressesPingStatistics()
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Empty(t, logzioPingStats.pingsStats)
+}
+
+func TestSleepContext(t *testing.T) {
+	assert.True(t, sleepContext(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	assert.False(t, sleepContext(ctx, time.Minute))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, sleepContext(ctx, 0))
+}
+
+func TestGetTargetLabels_Success(t *testing.T) {
+	targetLabels, err := getTargetLabels(`{"https://www.google.com": {"team": "search"}, "listener.logz.io:8053": {"team": "logzio"}}`,
+		[]string{"www.google.com:80", "listener.logz.io:8053"})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[string]string{
+		"www.google.com:80":     {"team": "search"},
+		"listener.logz.io:8053": {"team": "logzio"},
+	}, targetLabels)
+}
+
+func TestGetTargetLabels_UnknownAddress(t *testing.T) {
+	_, err := getTargetLabels(`{"www.nytimes.com": {"team": "news"}}`, []string{"www.google.com:80"})
+	require.Error(t, err)
+}
+
+func TestGetTargetLabels_NoJSON(t *testing.T) {
+	_, err := getTargetLabels("team=search", []string{"www.google.com:80"})
+	require.Error(t, err)
+}
+
+func TestGetTargetLabels_InvalidLabelNames(t *testing.T) {
+	invalidTargetLabels := []string{
+		`{"www.google.com": {"team.name": "search"}}`,
+		`{"www.google.com": {"1st": "search"}}`,
+		`{"www.google.com": {"région": "eu"}}`,
+		`{"www.google.com": {"__name__": "up"}}`,
+		`{"www.google.com": {"": "search"}}`,
+		`{"www.google.com": {"address": "www.example.com"}}`,
+		`{"www.google.com": {"maintenance": "false"}}`,
+		`{"www.google.com": {"truncated": "false"}}`,
+		`{"www.google.com": {"site": "eu-west"}}`,
+	}
+
+	for _, invalidTargetLabel := range invalidTargetLabels {
+		_, err := getTargetLabels(invalidTargetLabel, []string{"www.google.com:80"})
+		assert.Error(t, err, invalidTargetLabel)
+	}
+
+	_, err := getTargetLabels(`{"www.google.com": {"_team": "search", "Team_2": "logs"}}`, []string{"www.google.com:80"})
+	assert.NoError(t, err)
+}
+
+func TestGetRttStatistics_Success(t *testing.T) {
+	rttStats := getRttStatistics([]float64{10, 20, 30})
+	require.NotNil(t, rttStats)
+
+	assert.Equal(t, float64(10), rttStats.min)
+	assert.Equal(t, float64(20), rttStats.avg)
+	assert.Equal(t, float64(30), rttStats.max)
+	assert.InDelta(t, 8.165, rttStats.mdev, 0.001)
+
+	assert.Nil(t, getRttStatistics([]float64{}))
+}
+
+func TestNewRunID_Unique(t *testing.T) {
+	runID := newRunID()
+
+	assert.Len(t, runID, 32)
+	assert.NotEqual(t, runID, newRunID())
+}
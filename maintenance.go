@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	maintenanceWindowsEnvName = "MAINTENANCE_WINDOWS"
+	maintenanceLabelName      = "maintenance"
+)
+
+// maintenanceWindow is a planned maintenance of the selected targets, either an absolute range from start to end,
+// or a cron schedule of when it starts with its duration. During a window the targets are still probed, but their
+// results are tagged and left out of the availability, state and alert evaluation.
+type maintenanceWindow struct {
+	Name     string          `json:"name"`
+	Selector *targetSelector `json:"selector"`
+	Start    *time.Time      `json:"start,omitempty"`
+	End      *time.Time      `json:"end,omitempty"`
+	Schedule string          `json:"schedule,omitempty"`
+	Duration string          `json:"duration,omitempty"`
+	cron     cron.Schedule
+	duration time.Duration
+}
+
+// getMaintenanceWindows parses MAINTENANCE_WINDOWS, a JSON array of windows
+func getMaintenanceWindows(envValue string, addresses []string) ([]*maintenanceWindow, error) {
+	windows := make([]*maintenanceWindow, 0)
+	if envValue == "" {
+		return windows, nil
+	}
+
+	if err := json.Unmarshal([]byte(envValue), &windows); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON array of windows: %v", maintenanceWindowsEnvName, err)
+	}
+
+	for index, window := range windows {
+		if window.Name == "" {
+			window.Name = strconv.Itoa(index + 1)
+		}
+
+		if err := window.parse(addresses); err != nil {
+			return nil, fmt.Errorf("%s window %s: %v", maintenanceWindowsEnvName, window.Name, err)
+		}
+	}
+
+	return windows, nil
+}
+
+func (mw *maintenanceWindow) parse(addresses []string) error {
+	if mw.Selector != nil {
+		if err := mw.Selector.normalize(addresses); err != nil {
+			return fmt.Errorf("selector: %v", err)
+		}
+	}
+
+	isRange := mw.Start != nil || mw.End != nil
+	isSchedule := mw.Schedule != "" || mw.Duration != ""
+
+	switch {
+	case isRange && isSchedule:
+		return fmt.Errorf("must have either start and end, or schedule and duration")
+	case isRange:
+		if mw.Start == nil || mw.End == nil || !mw.End.After(*mw.Start) {
+			return fmt.Errorf("must have a start and an end after it")
+		}
+	case isSchedule:
+		// Standard cron expressions, which may start with CRON_TZ=<zone> to run in a time zone other than UTC
+		schedule, err := cron.ParseStandard(mw.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid schedule: %v", err)
+		}
+
+		duration, err := time.ParseDuration(mw.Duration)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("duration must be a positive duration, like 2h")
+		}
+
+		mw.cron = schedule
+		mw.duration = duration
+	default:
+		return fmt.Errorf("must have either start and end, or schedule and duration")
+	}
+
+	return nil
+}
+
+// active returns whether the window is in progress at now
+func (mw *maintenanceWindow) active(now time.Time) bool {
+	if mw.cron == nil {
+		return !now.Before(*mw.Start) && now.Before(*mw.End)
+	}
+
+	// The window is in progress if it started within its duration before now
+	return !mw.cron.Next(now.Add(-mw.duration)).After(now)
+}
+
+// markMaintenance flags the results of the targets that had a probe start during a maintenance window. A target
+// without probes is checked at the start of the run, as probing may end long after it.
+func (lps *logzioPingStatistics) markMaintenance(pingsStats []*pingStatistics, runStart time.Time) {
+	for _, pingStats := range pingsStats {
+		timestamps := []time.Time{runStart}
+		if len(pingStats.probes) > 0 {
+			timestamps = make([]time.Time, 0, len(pingStats.probes))
+			for _, probe := range pingStats.probes {
+				timestamps = append(timestamps, probe.timestamp)
+			}
+		}
+
+		for _, window := range lps.maintenanceWindows {
+			if window.Selector.matches(pingStats.address, pingStats.labels) && window.activeAny(timestamps) {
+				debugLogger.Println("Address", pingStats.address, "is in maintenance window", window.Name)
+				pingStats.maintenance = true
+
+				break
+			}
+		}
+	}
+}
+
+// activeAny returns whether the window is active at any of the times
+func (mw *maintenanceWindow) activeAny(times []time.Time) bool {
+	for _, timestamp := range times {
+		if mw.active(timestamp) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMaintenanceWindows(t *testing.T) {
+	addresses := []string{"www.google.com:80", "listener.logz.io:8053"}
+
+	windows, err := getMaintenanceWindows("", addresses)
+	require.NoError(t, err)
+	assert.Empty(t, windows)
+
+	windows, err = getMaintenanceWindows(`[
+		{"name": "upgrade", "selector": {"addresses": ["https://listener.logz.io:8053"]}, "start": "2022-03-01T12:00:00Z", "end": "2022-03-01T14:00:00Z"},
+		{"selector": {"labels": {"team": "db"}}, "schedule": "CRON_TZ=Europe/London 0 2 * * SUN", "duration": "2h"}
+	]`, addresses)
+	require.NoError(t, err)
+	require.Len(t, windows, 2)
+	assert.Equal(t, "upgrade", windows[0].Name)
+	assert.Equal(t, []string{"listener.logz.io:8053"}, windows[0].Selector.Addresses)
+	assert.Equal(t, "2", windows[1].Name)
+	assert.Equal(t, 2*time.Hour, windows[1].duration)
+
+	invalidWindows := []string{
+		`{"start": "2022-03-01T12:00:00Z"}`,
+		`[{"name": "no time"}]`,
+		`[{"start": "2022-03-01T12:00:00Z"}]`,
+		`[{"start": "2022-03-01T12:00:00Z", "end": "2022-03-01T11:00:00Z"}]`,
+		`[{"start": "2022-03-01T12:00:00Z", "end": "2022-03-01T14:00:00Z", "schedule": "0 2 * * *", "duration": "2h"}]`,
+		`[{"schedule": "every night", "duration": "2h"}]`,
+		`[{"schedule": "0 2 * * *"}]`,
+		`[{"schedule": "0 2 * * *", "duration": "-2h"}]`,
+		`[{"selector": {"addresses": ["www.example.com"]}, "schedule": "0 2 * * *", "duration": "2h"}]`,
+	}
+
+	for _, invalidWindow := range invalidWindows {
+		_, err = getMaintenanceWindows(invalidWindow, addresses)
+		assert.Error(t, err, invalidWindow)
+	}
+}
+
+func TestMaintenanceWindow_Active(t *testing.T) {
+	windows, err := getMaintenanceWindows(`[
+		{"start": "2022-03-01T12:00:00Z", "end": "2022-03-01T14:00:00Z"},
+		{"schedule": "30 2 * * *", "duration": "90m"}
+	]`, nil)
+	require.NoError(t, err)
+
+	rangeWindow := windows[0]
+	assert.False(t, rangeWindow.active(testProbesTimestamp.Add(-time.Second)))
+	assert.True(t, rangeWindow.active(testProbesTimestamp))
+	assert.True(t, rangeWindow.active(testProbesTimestamp.Add(time.Hour)))
+	assert.False(t, rangeWindow.active(testProbesTimestamp.Add(2*time.Hour)))
+
+	scheduleWindow := windows[1]
+	night := time.Date(2022, 3, 2, 2, 30, 0, 0, time.UTC)
+	assert.False(t, scheduleWindow.active(night.Add(-time.Minute)))
+	assert.True(t, scheduleWindow.active(night))
+	assert.True(t, scheduleWindow.active(night.Add(89*time.Minute)))
+	assert.False(t, scheduleWindow.active(night.Add(90*time.Minute)))
+	assert.True(t, scheduleWindow.active(night.Add(24*time.Hour+time.Hour)))
+}
+
+func TestMarkMaintenance(t *testing.T) {
+	windows, err := getMaintenanceWindows(`[{"selector": {"labels": {"team": "logs"}}, "start": "2022-03-01T12:00:00Z", "end": "2022-03-01T14:00:00Z"}]`, nil)
+	require.NoError(t, err)
+
+	lps := &logzioPingStatistics{maintenanceWindows: windows}
+
+	pingsStats := getTestPingsStats()
+	pingsStats[1].labels = map[string]string{"team": "logs"}
+
+	// The probes are checked at their own time, not at the start of the run
+	lps.markMaintenance(pingsStats, testProbesTimestamp.Add(-time.Hour))
+	assert.False(t, pingsStats[0].maintenance)
+	require.True(t, pingsStats[1].maintenance)
+
+	beforeWindow := &pingStatistics{address: "listener.logz.io:8053", labels: map[string]string{"team": "logs"}, probes: []*probeResult{
+		{timestamp: testProbesTimestamp.Add(-time.Second)},
+	}}
+	lps.markMaintenance([]*pingStatistics{beforeWindow}, testProbesTimestamp.Add(time.Hour))
+	assert.False(t, beforeWindow.maintenance)
+
+	intoWindow := &pingStatistics{address: "listener.logz.io:8053", labels: map[string]string{"team": "logs"}, probes: []*probeResult{
+		{timestamp: testProbesTimestamp.Add(-time.Second)},
+		{timestamp: testProbesTimestamp.Add(time.Second)},
+	}}
+	lps.markMaintenance([]*pingStatistics{intoWindow}, testProbesTimestamp.Add(-time.Minute))
+	assert.True(t, intoWindow.maintenance)
+
+	// A target without probes is checked at the start of the run
+	unprobed := &pingStatistics{address: "listener.logz.io:8053", labels: map[string]string{"team": "logs"}}
+	lps.markMaintenance([]*pingStatistics{unprobed}, testProbesTimestamp.Add(3*time.Hour))
+	assert.False(t, unprobed.maintenance)
+
+	lps.markMaintenance([]*pingStatistics{unprobed}, testProbesTimestamp)
+	assert.True(t, unprobed.maintenance)
+
+	// The results are tagged, but the failed target leaves the run successful
+	assert.Equal(t, "true", pingsStats[1].getLabels()[maintenanceLabelName])
+	assert.NotContains(t, pingsStats[0].getLabels(), maintenanceLabelName)
+
+	summary := getRunSummary("run-id", pingsStats, []*exportStatus{{Exporter: "probes", Success: true}})
+	assert.True(t, summary.Success)
+	assert.True(t, summary.Targets[1].Maintenance)
+
+	assert.True(t, getProbeRecord(pingsStats[1], pingsStats[1].probes[0]).Maintenance)
+}
+
+func TestMaintenance_ExcludedFromAlertsAndStates(t *testing.T) {
+	recorder := &notificationRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	alerts := newTestAlertEvaluator(t, t.TempDir(), `[{"name": "down", "metric": "loss_ratio", "operator": ">=", "threshold": 1}]`,
+		`[{"name": "ops", "type": "webhook", "url": "`+server.URL+`"}]`)
+
+	pingsStats := getTestPingsStats()
+	pingsStats[1].maintenance = true
+
+	alerts.evaluate(context.Background(), pingsStats)
+	assert.Empty(t, recorder.getBodies())
+
+	tracker := newTestStateTracker(t, t.TempDir())
+	pingStats := &pingStatistics{address: "www.google.com:80", probesSent: 3, successfulProbes: 3}
+	tracker.track(context.Background(), []*pingStatistics{pingStats})
+
+	// Failures during maintenance don't move the target towards down
+	for run := 0; run < defaultStateFailureThreshold; run++ {
+		pingStats = &pingStatistics{address: "www.google.com:80", probesSent: 3, probesFailed: 3, maintenance: true}
+		assert.Empty(t, tracker.track(context.Background(), []*pingStatistics{pingStats}))
+		assert.Equal(t, targetStateUp, pingStats.state)
+	}
+
+	state, transition := trackRun(tracker, 0, 3)
+	assert.Equal(t, targetStateDegraded, state)
+	assert.NotNil(t, transition)
+}
+
+func TestStatusPageUptime_Maintenance(t *testing.T) {
+	points := []*statusPagePoint{
+		{Sent: 3, Successful: 3},
+		{Sent: 3, Successful: 0, Maintenance: true},
+		{Sent: 3, Successful: 1},
+	}
+
+	assert.InDelta(t, 66.67, *getStatusPageUptime(points), 0.01)
+	assert.Equal(t, statusPageMaintenance, getPointStatus(points[1]))
+	assert.Nil(t, getStatusPageUptime(points[1:2]))
+	assert.Equal(t, statusPageMaintenance, getStatusPageStatus(&pingStatistics{maintenance: true, state: targetStateDown}))
+}
+
+func TestGetHistorySummary_Maintenance(t *testing.T) {
+	pingsStats := getTestPingsStats()
+	pingsStats[1].maintenance = true
+
+	records := make([]*probeRecord, 0)
+	for _, probe := range pingsStats[1].probes {
+		records = append(records, getProbeRecord(pingsStats[1], probe))
+	}
+
+	summary := getHistorySummary("listener.logz.io:8053", testProbesTimestamp, testProbesTimestamp.Add(time.Hour), records)
+	assert.Equal(t, 0, summary.Probes)
+	assert.Equal(t, 3, summary.Maintenance)
+	assert.Empty(t, summary.Outages)
+	assert.Contains(t, formatHistorySummary(summary), "0 probes, 0 successful, 0% loss (3 probes in maintenance excluded)")
+}
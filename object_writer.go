@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3OutputPrefix            = "s3://"
+	awsAccessKeyIDEnvName     = "AWS_ACCESS_KEY_ID"
+	awsSecretAccessKeyEnvName = "AWS_SECRET_ACCESS_KEY"
+	awsSessionTokenEnvName    = "AWS_SESSION_TOKEN"
+	defaultS3Region           = "us-east-1"
+	s3Timeout                 = 30 * time.Second
+	s3MaxErrorBodyBytes       = 1 << 10
+	objectFilePermissions     = 0644
+	objectDirPermissions      = 0755
+	awsSigningAlgorithm       = "AWS4-HMAC-SHA256"
+	awsSigningDateLayout      = "20060102T150405Z"
+	awsSigningDayLayout       = "20060102"
+)
+
+// objectWriter writes named files, such as the status page, to a local dir or a bucket, and reads them back
+type objectWriter interface {
+	write(ctx context.Context, name string, contentType string, data []byte) error
+	// read returns the data of the object, and false if it does not exist
+	read(ctx context.Context, name string) ([]byte, bool, error)
+}
+
+// dirObjectWriter writes the objects as files of a local dir
+type dirObjectWriter struct {
+	dir string
+}
+
+// s3ObjectWriter puts the objects in an S3 bucket, or in a bucket of an S3-compatible service
+// when the endpoint is set, with requests signed with AWS Signature Version 4
+type s3ObjectWriter struct {
+	endpoint        string
+	bucket          string
+	prefix          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	client          *http.Client
+}
+
+// newObjectWriter returns the writer of an output, which is a local dir or an s3://bucket/prefix URL
+func newObjectWriter(output string, endpoint string, region string) (objectWriter, error) {
+	if !strings.HasPrefix(output, s3OutputPrefix) {
+		if err := os.MkdirAll(output, objectDirPermissions); err != nil {
+			return nil, fmt.Errorf("error creating dir %s: %v", output, err)
+		}
+
+		return &dirObjectWriter{dir: output}, nil
+	}
+
+	bucketAndPrefix := strings.SplitN(strings.TrimPrefix(output, s3OutputPrefix), "/", 2)
+	if bucketAndPrefix[0] == "" {
+		return nil, fmt.Errorf("%s has no bucket", output)
+	}
+
+	writer := &s3ObjectWriter{
+		endpoint:        endpoint,
+		bucket:          bucketAndPrefix[0],
+		region:          region,
+		accessKeyID:     os.Getenv(awsAccessKeyIDEnvName),
+		secretAccessKey: os.Getenv(awsSecretAccessKeyEnvName),
+		sessionToken:    os.Getenv(awsSessionTokenEnvName),
+		client:          &http.Client{Timeout: s3Timeout},
+	}
+
+	if len(bucketAndPrefix) == 2 {
+		writer.prefix = strings.Trim(bucketAndPrefix[1], "/")
+	}
+
+	if writer.region == "" {
+		writer.region = defaultS3Region
+	}
+
+	if writer.accessKeyID == "" || writer.secretAccessKey == "" {
+		return nil, fmt.Errorf("%s and %s must be set to write to %s", awsAccessKeyIDEnvName, awsSecretAccessKeyEnvName, output)
+	}
+
+	return writer, nil
+}
+
+func (dow *dirObjectWriter) write(_ context.Context, name string, _ string, data []byte) error {
+	// The file is renamed into place so a reader never sees a partial page
+	tempPath := filepath.Join(dow.dir, "."+name)
+	if err := os.WriteFile(tempPath, data, objectFilePermissions); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+
+	return os.Rename(tempPath, filepath.Join(dow.dir, name))
+}
+
+func (dow *dirObjectWriter) read(_ context.Context, name string) ([]byte, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dow.dir, name))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s: %v", name, err)
+	}
+
+	return data, true, nil
+}
+
+func (sow *s3ObjectWriter) write(ctx context.Context, name string, contentType string, data []byte) error {
+	response, err := sow.do(ctx, http.MethodPut, name, contentType, data)
+	if err != nil {
+		return err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return getS3StatusError(response)
+	}
+
+	return nil
+}
+
+func (sow *s3ObjectWriter) read(ctx context.Context, name string) ([]byte, bool, error) {
+	response, err := sow.do(ctx, http.MethodGet, name, "", nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(response.Body)
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return nil, false, getS3StatusError(response)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s: %w", path.Join(sow.prefix, name), err)
+	}
+
+	return data, true, nil
+}
+
+// do sends a signed request for the object
+func (sow *s3ObjectWriter) do(ctx context.Context, method string, name string, contentType string, data []byte) (*http.Response, error) {
+	key := path.Join(sow.prefix, name)
+
+	// Without an endpoint the bucket is addressed as a virtual host of S3, and with one by path,
+	// which S3-compatible services support
+	objectURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", sow.bucket, sow.region, awsURIEncode(key, false))
+	if sow.endpoint != "" {
+		objectURL = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(sow.endpoint, "/"), sow.bucket, awsURIEncode(key, false))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request of %s: %v", key, err)
+	}
+
+	payloadHash := sha256.Sum256(data)
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+		request.Header.Set("Cache-Control", "no-cache")
+	}
+
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	if sow.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", sow.sessionToken)
+	}
+
+	signAWSRequest(request, sow.accessKeyID, sow.secretAccessKey, sow.region, "s3", time.Now())
+
+	response, err := sow.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error sending %s request of %s: %w", method, key, err)
+	}
+
+	return response, nil
+}
+
+func getS3StatusError(response *http.Response) error {
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, s3MaxErrorBodyBytes))
+	return &httpStatusError{backend: "s3", statusCode: response.StatusCode, status: response.Status, body: string(responseBody)}
+}
+
+// signAWSRequest adds the Signature Version 4 authorization of the request, signing all of its headers.
+// The X-Amz-Content-Sha256 header must already hold the hash of the payload.
+func signAWSRequest(request *http.Request, accessKeyID string, secretAccessKey string, region string, service string, now time.Time) {
+	signingTime := now.UTC().Format(awsSigningDateLayout)
+	signingDay := now.UTC().Format(awsSigningDayLayout)
+
+	request.Header.Set("X-Amz-Date", signingTime)
+
+	headers := map[string]string{"host": request.URL.Host}
+	for headerName, headerValues := range request.Header {
+		headers[strings.ToLower(headerName)] = strings.TrimSpace(strings.Join(headerValues, ","))
+	}
+
+	headerNames := make([]string, 0, len(headers))
+	for headerName := range headers {
+		headerNames = append(headerNames, headerName)
+	}
+
+	sort.Strings(headerNames)
+
+	canonicalHeaders := &strings.Builder{}
+	for _, headerName := range headerNames {
+		canonicalHeaders.WriteString(headerName + ":" + headers[headerName] + "\n")
+	}
+
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalPath := request.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		canonicalPath,
+		getCanonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		request.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{signingDay, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{awsSigningAlgorithm, signingTime, scope, hex.EncodeToString(canonicalRequestHash[:])}, "\n")
+
+	signingKey := []byte("AWS4" + secretAccessKey)
+	for _, scopePart := range []string{signingDay, region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, scopePart)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm, accessKeyID, scope, signedHeaders, signature))
+}
+
+func getCanonicalQuery(query url.Values) string {
+	parameters := make([]string, 0, len(query))
+
+	for name, values := range query {
+		for _, value := range values {
+			parameters = append(parameters, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// awsURIEncode encodes all the characters but the unreserved ones, and slashes unless encodeSlash is set
+func awsURIEncode(value string, encodeSlash bool) string {
+	builder := &strings.Builder{}
+
+	for _, char := range []byte(value) {
+		switch {
+		case char >= 'A' && char <= 'Z', char >= 'a' && char <= 'z', char >= '0' && char <= '9',
+			char == '-', char == '_', char == '.', char == '~':
+			builder.WriteByte(char)
+		case char == '/' && !encodeSlash:
+			builder.WriteByte(char)
+		default:
+			builder.WriteString(fmt.Sprintf("%%%02X", char))
+		}
+	}
+
+	return builder.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
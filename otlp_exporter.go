@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	otlpExporterName             = "otlp"
+	otlpProtocolEnvName          = "OTLP_PROTOCOL"
+	otlpEndpointEnvName          = "OTLP_ENDPOINT"
+	otlpURLPathEnvName           = "OTLP_URL_PATH"
+	otlpHeadersEnvName           = "OTLP_HEADERS"
+	otlpInsecureEnvName          = "OTLP_INSECURE"
+	otlpCACertificateEnvName     = "OTLP_CA_CERTIFICATE"
+	otlpClientCertificateEnvName = "OTLP_CLIENT_CERTIFICATE"
+	otlpClientKeyEnvName         = "OTLP_CLIENT_KEY"
+	otlpCompressionEnvName       = "OTLP_COMPRESSION"
+	otlpTimeoutEnvName           = "OTLP_TIMEOUT"
+	otlpProtocolHTTP             = "http"
+	otlpProtocolGRPC             = "grpc"
+	otlpCompressionNone          = "none"
+	otlpCompressionGzip          = "gzip"
+	otlpDefaultTimeout           = 10 * time.Second
+	otlpControllerCollectPeriod  = 5 * time.Second
+	otlpShutdownTimeout          = 5 * time.Second
+)
+
+type otlpExporter struct {
+	exporter *otlpmetric.Exporter
+	started  bool
+}
+
+type otlpConfig struct {
+	protocol    string
+	endpoint    string
+	urlPath     string
+	headers     map[string]string
+	insecure    bool
+	tlsConfig   *tls.Config
+	compression string
+	timeout     time.Duration
+}
+
+func newOtlpExporter(_ *logzioPingStatistics) (exporter, error) {
+	config, err := getOtlpConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var client otlpmetric.Client
+	if config.protocol == otlpProtocolGRPC {
+		client = newOtlpGRPCClient(config)
+	} else {
+		client = newOtlpHTTPClient(config)
+	}
+
+	return &otlpExporter{
+		exporter: otlpmetric.NewUnstarted(client),
+	}, nil
+}
+
+func getOtlpConfig() (*otlpConfig, error) {
+	protocol := os.Getenv(otlpProtocolEnvName)
+	if protocol == "" {
+		protocol = otlpProtocolHTTP
+	}
+
+	if protocol != otlpProtocolHTTP && protocol != otlpProtocolGRPC {
+		return nil, fmt.Errorf("%s must be %s or %s", otlpProtocolEnvName, otlpProtocolHTTP, otlpProtocolGRPC)
+	}
+
+	endpoint := os.Getenv(otlpEndpointEnvName)
+	if endpoint == "" {
+		return nil, fmt.Errorf("%s must not be empty", otlpEndpointEnvName)
+	}
+
+	headers, err := getKeyValuePairs(os.Getenv(otlpHeadersEnvName), otlpHeadersEnvName)
+	if err != nil {
+		return nil, err
+	}
+
+	insecure, err := getBoolEnvValue(os.Getenv(otlpInsecureEnvName), otlpInsecureEnvName)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := getOtlpTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	compression := os.Getenv(otlpCompressionEnvName)
+	if compression == "" {
+		compression = otlpCompressionNone
+	}
+
+	if compression != otlpCompressionNone && compression != otlpCompressionGzip {
+		return nil, fmt.Errorf("%s must be %s or %s", otlpCompressionEnvName, otlpCompressionNone, otlpCompressionGzip)
+	}
+
+	timeout := otlpDefaultTimeout
+	if timeoutString := os.Getenv(otlpTimeoutEnvName); timeoutString != "" {
+		timeoutSeconds, err := getNumberEnvValue(timeoutString, otlpTimeoutEnvName)
+		if err != nil {
+			return nil, err
+		}
+
+		timeout = time.Duration(*timeoutSeconds) * time.Second
+	}
+
+	return &otlpConfig{
+		protocol:    protocol,
+		endpoint:    endpoint,
+		urlPath:     os.Getenv(otlpURLPathEnvName),
+		headers:     headers,
+		insecure:    insecure,
+		tlsConfig:   tlsConfig,
+		compression: compression,
+		timeout:     timeout,
+	}, nil
+}
+
+func getOtlpTLSConfig() (*tls.Config, error) {
+	caCertificatePath := os.Getenv(otlpCACertificateEnvName)
+	clientCertificatePath := os.Getenv(otlpClientCertificateEnvName)
+	clientKeyPath := os.Getenv(otlpClientKeyEnvName)
+
+	if caCertificatePath == "" && clientCertificatePath == "" && clientKeyPath == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if caCertificatePath != "" {
+		caCertificate, err := os.ReadFile(caCertificatePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", otlpCACertificateEnvName, err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertificate) {
+			return nil, fmt.Errorf("%s does not contain a valid PEM certificate", otlpCACertificateEnvName)
+		}
+	}
+
+	if clientCertificatePath != "" || clientKeyPath != "" {
+		if clientCertificatePath == "" || clientKeyPath == "" {
+			return nil, fmt.Errorf("%s and %s must be set together", otlpClientCertificateEnvName, otlpClientKeyEnvName)
+		}
+
+		clientCertificate, err := tls.LoadX509KeyPair(clientCertificatePath, clientKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{clientCertificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func newOtlpHTTPClient(config *otlpConfig) otlpmetric.Client {
+	options := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(config.endpoint),
+		otlpmetrichttp.WithTimeout(config.timeout),
+	}
+
+	if config.urlPath != "" {
+		options = append(options, otlpmetrichttp.WithURLPath(config.urlPath))
+	}
+
+	if len(config.headers) > 0 {
+		options = append(options, otlpmetrichttp.WithHeaders(config.headers))
+	}
+
+	if config.insecure {
+		options = append(options, otlpmetrichttp.WithInsecure())
+	} else if config.tlsConfig != nil {
+		options = append(options, otlpmetrichttp.WithTLSClientConfig(config.tlsConfig))
+	}
+
+	if config.compression == otlpCompressionGzip {
+		options = append(options, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+	} else {
+		options = append(options, otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression))
+	}
+
+	return otlpmetrichttp.NewClient(options...)
+}
+
+func newOtlpGRPCClient(config *otlpConfig) otlpmetric.Client {
+	options := []otlpmetricgrpc.Option{
+		otlpmetricgrpc.WithEndpoint(config.endpoint),
+		otlpmetricgrpc.WithTimeout(config.timeout),
+	}
+
+	if len(config.headers) > 0 {
+		options = append(options, otlpmetricgrpc.WithHeaders(config.headers))
+	}
+
+	if config.insecure {
+		options = append(options, otlpmetricgrpc.WithInsecure())
+	} else if config.tlsConfig != nil {
+		options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(config.tlsConfig)))
+	}
+
+	if config.compression == otlpCompressionGzip {
+		options = append(options, otlpmetricgrpc.WithCompressor(otlpCompressionGzip))
+	}
+
+	return otlpmetricgrpc.NewClient(options...)
+}
+
+func (oe *otlpExporter) name() string {
+	return otlpExporterName
+}
+
+func (oe *otlpExporter) export(ctx context.Context, pingsStats []*pingStatistics) error {
+	if !oe.started {
+		if err := oe.exporter.Start(ctx); err != nil {
+			return fmt.Errorf("error starting OTLP exporter: %v", err)
+		}
+
+		oe.started = true
+	}
+
+	cont := controller.New(
+		processor.NewFactory(simple.NewWithInexpensiveDistribution(), oe.exporter),
+		controller.WithExporter(oe.exporter),
+		controller.WithCollectPeriod(otlpControllerCollectPeriod),
+		controller.WithResource(createResource()),
+	)
+
+	if err := cont.Start(ctx); err != nil {
+		return fmt.Errorf("error starting controller: %v", err)
+	}
+
+	registerGaugeObservers(cont.Meter(meterName), getMetricPoints(pingsStats))
+
+	// Stopping the controller collects the observers and pushes the metrics once
+	return cont.Stop(ctx)
+}
+
+func (oe *otlpExporter) shutdown(ctx context.Context) error {
+	if !oe.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, otlpShutdownTimeout)
+	defer cancel()
+
+	oe.started = false
+	return oe.exporter.Shutdown(ctx)
+}
+
+func createResource() *resource.Resource {
+	resourceLabels := getResourceLabels()
+	attributes := make([]attribute.KeyValue, 0, len(resourceLabels))
+
+	for _, labelName := range getSortedLabelNames(resourceLabels) {
+		attributes = append(attributes, attribute.String(labelName, resourceLabels[labelName]))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attributes...)
+}
+
+// registerGaugeObservers registers a gauge observer for each metric, reporting its points once per collection
+func registerGaugeObservers(meter metric.Meter, metricPoints []*metricPoint) {
+	for _, metricName := range getMetricNames(metricPoints) {
+		_ = metric.Must(meter).NewFloat64GaugeObserver(
+			metricName,
+			getGaugeObserverCallback(metricName, metricPoints),
+			metric.WithDescription(metricDescriptions[metricName]),
+		)
+	}
+}
+
+func getGaugeObserverCallback(metricName string, metricPoints []*metricPoint) func(context.Context, metric.Float64ObserverResult) {
+	return func(_ context.Context, result metric.Float64ObserverResult) {
+		debugLogger.Println("Running observer callback for metric:", metricName)
+
+		for _, point := range metricPoints {
+			if point.name != metricName {
+				continue
+			}
+
+			attributes := make([]attribute.KeyValue, 0, len(point.labels))
+			for _, labelName := range getSortedLabelNames(point.labels) {
+				attributes = append(attributes, attribute.String(labelName, point.labels[labelName]))
+			}
+
+			result.Observe(point.value, attributes...)
+		}
+	}
+}
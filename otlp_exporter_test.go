@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectormetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type otlpTestCollector struct {
+	collectormetricpb.UnimplementedMetricsServiceServer
+
+	lock     sync.Mutex
+	requests []*collectormetricpb.ExportMetricsServiceRequest
+	headers  metadata.MD
+}
+
+func (otc *otlpTestCollector) Export(ctx context.Context, request *collectormetricpb.ExportMetricsServiceRequest) (*collectormetricpb.ExportMetricsServiceResponse, error) {
+	otc.lock.Lock()
+	defer otc.lock.Unlock()
+
+	otc.requests = append(otc.requests, request)
+	otc.headers, _ = metadata.FromIncomingContext(ctx)
+
+	return &collectormetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func getOtlpMetricNames(request *collectormetricpb.ExportMetricsServiceRequest) []string {
+	metricNames := make([]string, 0)
+
+	for _, resourceMetrics := range request.ResourceMetrics {
+		for _, libraryMetrics := range resourceMetrics.InstrumentationLibraryMetrics {
+			for _, metric := range libraryMetrics.Metrics {
+				metricNames = append(metricNames, metric.Name)
+			}
+		}
+	}
+
+	return metricNames
+}
+
+func TestNewOtlpExporter_NoEndpoint(t *testing.T) {
+	_, err := newOtlpExporter(nil)
+	require.Error(t, err)
+}
+
+func TestNewOtlpExporter_InvalidProtocol(t *testing.T) {
+	err := os.Setenv(otlpEndpointEnvName, "localhost:4318")
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpProtocolEnvName, "udp")
+	require.NoError(t, err)
+
+	_, err = newOtlpExporter(nil)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestNewOtlpExporter_InvalidHeaders(t *testing.T) {
+	err := os.Setenv(otlpEndpointEnvName, "localhost:4318")
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpHeadersEnvName, "api-key")
+	require.NoError(t, err)
+
+	_, err = newOtlpExporter(nil)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestOtlpExporter_ExportHTTP(t *testing.T) {
+	err := os.Setenv(awsRegionEnvName, "us-east-1")
+	require.NoError(t, err)
+
+	var request *collectormetricpb.ExportMetricsServiceRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, httpRequest *http.Request) {
+		assert.Equal(t, "/v1/metrics", httpRequest.URL.Path)
+		assert.Equal(t, "secret", httpRequest.Header.Get("api-key"))
+		assert.Equal(t, "gzip", httpRequest.Header.Get("Content-Encoding"))
+
+		gzipReader, err := gzip.NewReader(httpRequest.Body)
+		require.NoError(t, err)
+
+		body, err := io.ReadAll(gzipReader)
+		require.NoError(t, err)
+
+		request = &collectormetricpb.ExportMetricsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, request))
+
+		response, err := proto.Marshal(&collectormetricpb.ExportMetricsServiceResponse{})
+		require.NoError(t, err)
+
+		writer.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = io.Copy(writer, bytes.NewReader(response))
+	}))
+	defer server.Close()
+
+	err = os.Setenv(otlpEndpointEnvName, strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpInsecureEnvName, "true")
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpHeadersEnvName, "api-key=secret")
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpCompressionEnvName, otlpCompressionGzip)
+	require.NoError(t, err)
+
+	otlpExp, err := newOtlpExporter(nil)
+	require.NoError(t, err)
+
+	err = otlpExp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	err = otlpExp.shutdown(context.Background())
+	require.NoError(t, err)
+
+	require.NotNil(t, request)
+	assert.ElementsMatch(t, []string{rttMetricName, probesSentMetricName, successfulProbesMetricName, probesFailedMetricName}, getOtlpMetricNames(request))
+
+	resourceAttributes := make(map[string]string)
+	for _, attribute := range request.ResourceMetrics[0].Resource.Attributes {
+		resourceAttributes[attribute.Key] = attribute.Value.GetStringValue()
+	}
+
+	assert.Equal(t, "us-east-1", resourceAttributes[awsRegionLabelName])
+
+	os.Clearenv()
+}
+
+func TestOtlpExporter_ExportGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	collector := &otlpTestCollector{}
+	server := grpc.NewServer()
+	collectormetricpb.RegisterMetricsServiceServer(server, collector)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	err = os.Setenv(otlpProtocolEnvName, otlpProtocolGRPC)
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpEndpointEnvName, listener.Addr().String())
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpInsecureEnvName, "true")
+	require.NoError(t, err)
+
+	err = os.Setenv(otlpHeadersEnvName, "api-key=secret")
+	require.NoError(t, err)
+
+	otlpExp, err := newOtlpExporter(nil)
+	require.NoError(t, err)
+
+	err = otlpExp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	err = otlpExp.shutdown(context.Background())
+	require.NoError(t, err)
+
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+
+	require.Len(t, collector.requests, 1)
+	assert.ElementsMatch(t, []string{rttMetricName, probesSentMetricName, successfulProbesMetricName, probesFailedMetricName}, getOtlpMetricNames(collector.requests[0]))
+	assert.Equal(t, []string{"secret"}, collector.headers.Get("api-key"))
+
+	os.Clearenv()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// overrideMaxCount is well beyond what fits in a Lambda invocation, even with the shortest interval
+const overrideMaxCount = 1000
+
+// runOverrides is the JSON payload of a manual or EventBridge invocation. It overrides the configuration
+// of the environment variables for that run only.
+type runOverrides struct {
+	Addresses []string                     `json:"addresses"`
+	Count     *int                         `json:"count"`
+	Interval  *int                         `json:"interval"`
+	Timeout   *int                         `json:"timeout"`
+	Labels    map[string]map[string]string `json:"labels"`
+}
+
+// eventBridgeEvent is the envelope of an EventBridge event, which carries the overrides in its detail
+type eventBridgeEvent struct {
+	DetailType string          `json:"detail-type"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// getRunOverrides returns the overrides of the invocation payload, or nil if it has none.
+// A scheduled EventBridge event has an empty detail, so the scheduled runs keep the environment configuration.
+func getRunOverrides(payload json.RawMessage) (*runOverrides, error) {
+	if isEmptyPayload(payload) {
+		return nil, nil
+	}
+
+	event := &eventBridgeEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, fmt.Errorf("invocation payload must be a JSON object: %v", err)
+	}
+
+	if event.DetailType != "" {
+		if isEmptyPayload(event.Detail) {
+			return nil, nil
+		}
+
+		payload = event.Detail
+	}
+
+	overrides := &runOverrides{}
+	if err := json.Unmarshal(payload, overrides); err != nil {
+		return nil, fmt.Errorf("invocation payload must be a JSON object of overrides: %v", err)
+	}
+
+	if overrides.Addresses == nil && overrides.Count == nil && overrides.Interval == nil && overrides.Timeout == nil && overrides.Labels == nil {
+		return nil, nil
+	}
+
+	return overrides, nil
+}
+
+func isEmptyPayload(payload json.RawMessage) bool {
+	trimmedPayload := bytes.TrimSpace(payload)
+	return len(trimmedPayload) == 0 || bytes.Equal(trimmedPayload, []byte("null")) || bytes.Equal(trimmedPayload, []byte("{}"))
+}
+
+// apply overrides the configuration of the run. Labels replace the labels of the given addresses,
+// the other addresses keep the ones of TARGET_LABELS.
+func (ro *runOverrides) apply(lps *logzioPingStatistics) error {
+	if ro.Addresses != nil {
+		if len(ro.Addresses) == 0 {
+			return fmt.Errorf("addresses override must not be empty")
+		}
+
+		lps.addresses = getAddresses(strings.Join(ro.Addresses, ","))
+	}
+
+	if ro.Count != nil {
+		if *ro.Count < 1 || *ro.Count > overrideMaxCount {
+			return fmt.Errorf("count override must be between 1 and %d", overrideMaxCount)
+		}
+
+		lps.pingCount = *ro.Count
+	}
+
+	if ro.Interval != nil {
+		if *ro.Interval < 1 {
+			return fmt.Errorf("interval override must be a positive number")
+		}
+
+		lps.pingInterval = time.Duration(*ro.Interval) * time.Second
+	}
+
+	if ro.Timeout != nil {
+		if *ro.Timeout < 1 {
+			return fmt.Errorf("timeout override must be a positive number")
+		}
+
+		lps.pingTimeout = time.Duration(*ro.Timeout) * time.Second
+	}
+
+	if ro.Labels != nil {
+		targetLabels := make(map[string]map[string]string)
+		for address, labels := range lps.targetLabels {
+			targetLabels[address] = labels
+		}
+
+		for address, labels := range ro.Labels {
+			normalizedAddress := getAddresses(address)[0]
+
+			if !containsString(lps.addresses, normalizedAddress) {
+				return fmt.Errorf("labels override contains labels of an address that is not probed: %s", address)
+			}
+
+			if err := validateLabelNames(labels); err != nil {
+				return fmt.Errorf("labels override contains invalid labels of %s: %v", address, err)
+			}
+
+			targetLabels[normalizedAddress] = labels
+		}
+
+		lps.targetLabels = targetLabels
+	}
+
+	infoLogger.Printf("Overriding the configuration for this run: %d addresses, count %d, interval %s, timeout %s",
+		len(lps.addresses), lps.pingCount, lps.pingInterval, lps.pingTimeout)
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRunOverrides_Success(t *testing.T) {
+	overrides, err := getRunOverrides(json.RawMessage(`{"addresses": ["www.google.com"], "count": 50, "timeout": 2, "labels": {"www.google.com": {"check": "deep"}}}`))
+	require.NoError(t, err)
+	require.NotNil(t, overrides)
+
+	assert.Equal(t, []string{"www.google.com"}, overrides.Addresses)
+	assert.Equal(t, 50, *overrides.Count)
+	assert.Nil(t, overrides.Interval)
+	assert.Equal(t, 2, *overrides.Timeout)
+	assert.Equal(t, map[string]map[string]string{"www.google.com": {"check": "deep"}}, overrides.Labels)
+}
+
+func TestGetRunOverrides_EventBridge(t *testing.T) {
+	overrides, err := getRunOverrides(json.RawMessage(`{"version": "0", "detail-type": "Deep check", "source": "custom", "detail": {"count": 50}}`))
+	require.NoError(t, err)
+	require.NotNil(t, overrides)
+
+	assert.Equal(t, 50, *overrides.Count)
+	assert.Nil(t, overrides.Addresses)
+}
+
+func TestGetRunOverrides_None(t *testing.T) {
+	payloads := []string{
+		``,
+		`null`,
+		`{}`,
+		`{"version": "0", "detail-type": "Scheduled Event", "source": "aws.events", "detail": {}}`,
+	}
+
+	for _, payload := range payloads {
+		overrides, err := getRunOverrides(json.RawMessage(payload))
+		require.NoError(t, err, payload)
+		assert.Nil(t, overrides, payload)
+	}
+}
+
+func TestGetRunOverrides_Invalid(t *testing.T) {
+	_, err := getRunOverrides(json.RawMessage(`{"count": "50"}`))
+	assert.Error(t, err)
+
+	_, err = getRunOverrides(json.RawMessage(`["www.google.com"]`))
+	assert.Error(t, err)
+}
+
+func TestRunOverridesApply_Success(t *testing.T) {
+	logzioPingStats := &logzioPingStatistics{
+		addresses:    []string{"www.google.com:80", "listener.logz.io:8053"},
+		pingCount:    3,
+		pingInterval: time.Second,
+		pingTimeout:  10 * time.Second,
+		targetLabels: map[string]map[string]string{"listener.logz.io:8053": {"team": "logs"}},
+	}
+
+	count := 50
+	overrides := &runOverrides{
+		Addresses: []string{"www.google.com", "https://listener.logz.io:8053"},
+		Count:     &count,
+		Labels:    map[string]map[string]string{"https://www.google.com:80": {"check": "deep"}},
+	}
+
+	err := overrides.apply(logzioPingStats)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"www.google.com:80", "listener.logz.io:8053"}, logzioPingStats.addresses)
+	assert.Equal(t, 50, logzioPingStats.pingCount)
+	assert.Equal(t, time.Second, logzioPingStats.pingInterval)
+	assert.Equal(t, 10*time.Second, logzioPingStats.pingTimeout)
+	assert.Equal(t, map[string]map[string]string{
+		"www.google.com:80":     {"check": "deep"},
+		"listener.logz.io:8053": {"team": "logs"},
+	}, logzioPingStats.targetLabels)
+}
+
+func TestRunOverridesApply_Invalid(t *testing.T) {
+	zero := 0
+	tooMany := 1000000000000
+	invalidOverrides := []*runOverrides{
+		{Addresses: []string{}},
+		{Count: &zero},
+		{Count: &tooMany},
+		{Interval: &zero},
+		{Timeout: &zero},
+		{Labels: map[string]map[string]string{"www.example.com": {"check": "deep"}}},
+		{Labels: map[string]map[string]string{"www.google.com": {"check-type": "deep"}}},
+	}
+
+	for _, overrides := range invalidOverrides {
+		logzioPingStats := &logzioPingStatistics{addresses: []string{"www.google.com:80"}}
+		assert.Error(t, overrides.apply(logzioPingStats))
+	}
+}
+
+func TestHandleRequest_Overrides(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	probesPath := filepath.Join(t.TempDir(), "probes.jsonl")
+
+	envs := map[string]string{
+		addressesEnvName:    "127.0.0.1:1",
+		pingCountEnvName:    "1",
+		pingIntervalEnvName: "1",
+		pingTimeoutEnvName:  "1",
+		exportersEnvName:    probesExporterName,
+		probesOutputEnvName: probesPath,
+		disableSpoolEnvName: "true",
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+
+	defer os.Clearenv()
+
+	address := listener.Addr().String()
+	payload := `{"addresses": ["` + address + `"], "count": 2, "labels": {"` + address + `": {"check": "deep"}}}`
+
+	summary, err := HandleRequest(context.Background(), json.RawMessage(payload))
+	require.NoError(t, err)
+	require.NotNil(t, summary)
+	assert.True(t, summary.Success)
+
+	probes, err := os.ReadFile(probesPath)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(probes)), "\n")
+	require.Len(t, lines, 2)
+
+	for _, line := range lines {
+		record := &probeRecord{}
+		require.NoError(t, json.Unmarshal([]byte(line), record))
+
+		assert.Equal(t, address, record.Address)
+		assert.True(t, record.Success)
+		assert.Equal(t, "deep", record.Labels["check"])
+	}
+}
+
+func TestNewOverriddenLogzioPingStatistics_ExportersUseOverrides(t *testing.T) {
+	envs := map[string]string{
+		addressesEnvName:               "www.google.com",
+		pingCountEnvName:               "3",
+		pingIntervalEnvName:            "1",
+		pingTimeoutEnvName:             "10",
+		exportersEnvName:               prometheusExporterName,
+		prometheusListenAddressEnvName: "127.0.0.1:0",
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+
+	defer os.Clearenv()
+
+	overrides, err := getRunOverrides(json.RawMessage(`{"count": 50, "timeout": 2}`))
+	require.NoError(t, err)
+
+	logzioPingStats, err := newOverriddenLogzioPingStatistics(context.Background(), overrides)
+	require.NoError(t, err)
+
+	defer logzioPingStats.shutdownExporters()
+
+	require.Len(t, logzioPingStats.exporters, 1)
+	runInfoLabels := logzioPingStats.exporters[0].(*prometheusExporter).runInfoLabels
+	assert.Equal(t, "50", runInfoLabels[pingCountLabelName])
+	assert.Equal(t, "1", runInfoLabels[pingIntervalLabelName])
+	assert.Equal(t, "2", runInfoLabels[pingTimeoutLabelName])
+
+	_, err = newOverriddenLogzioPingStatistics(context.Background(), &runOverrides{Addresses: []string{}, Labels: map[string]map[string]string{"www.example.com": {}}})
+	assert.Error(t, err)
+}
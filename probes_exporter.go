@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	probesExporterName      = "probes"
+	probesOutputEnvName     = "PROBES_OUTPUT"
+	probesFormatEnvName     = "PROBES_FORMAT"
+	probesOutputStdout      = "stdout"
+	probesFormatJSONL       = "jsonl"
+	probesFormatCSV         = "csv"
+	probesFilePermissions   = 0644
+	probeRecordTimeLayout   = time.RFC3339Nano
+	probeRecordRttPrecision = 3
+	probeRecordCSVLabelsSep = ";"
+)
+
+var probeRecordCSVHeader = []string{"run_id", "timestamp", "address", "resolved_ip", "success", "rtt_ms", "error", "error_reason", "labels", "maintenance"}
+
+type probesExporter struct {
+	format        string
+	writer        io.Writer
+	file          *os.File
+	headerWritten bool
+	lock          sync.Mutex
+}
+
+// probeRecord is the JSON Lines record written for each probe
+type probeRecord struct {
+	RunID       string            `json:"run_id"`
+	Timestamp   string            `json:"timestamp"`
+	Address     string            `json:"address"`
+	ResolvedIP  string            `json:"resolved_ip"`
+	Success     bool              `json:"success"`
+	RTT         *float64          `json:"rtt_ms"`
+	Error       string            `json:"error"`
+	ErrorReason string            `json:"error_reason"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Maintenance bool              `json:"maintenance,omitempty"`
+}
+
+func newProbesExporter(_ *logzioPingStatistics) (exporter, error) {
+	output := os.Getenv(probesOutputEnvName)
+	if output == "" {
+		output = probesOutputStdout
+	}
+
+	format := os.Getenv(probesFormatEnvName)
+	if format == "" {
+		format = probesFormatJSONL
+	}
+
+	if format != probesFormatJSONL && format != probesFormatCSV {
+		return nil, fmt.Errorf("%s must be %s or %s", probesFormatEnvName, probesFormatJSONL, probesFormatCSV)
+	}
+
+	pe := &probesExporter{
+		format: format,
+		writer: os.Stdout,
+	}
+
+	if output == probesOutputStdout {
+		return pe, nil
+	}
+
+	file, err := os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, probesFilePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", output, err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error reading %s info: %v", output, err)
+	}
+
+	// A CSV file that already has records also has a header
+	pe.headerWritten = fileInfo.Size() > 0
+	pe.file = file
+	pe.writer = file
+
+	return pe, nil
+}
+
+func (pe *probesExporter) name() string {
+	return probesExporterName
+}
+
+func (pe *probesExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	if pe.format == probesFormatCSV {
+		return pe.writeCSV(pingsStats)
+	}
+
+	return pe.writeJSONL(pingsStats)
+}
+
+func (pe *probesExporter) shutdown(_ context.Context) error {
+	if pe.file == nil {
+		return nil
+	}
+
+	err := pe.file.Close()
+	pe.file = nil
+
+	return err
+}
+
+func (pe *probesExporter) writeJSONL(pingsStats []*pingStatistics) error {
+	encoder := json.NewEncoder(pe.writer)
+
+	for _, pingStats := range pingsStats {
+		for _, probe := range pingStats.probes {
+			if err := encoder.Encode(getProbeRecord(pingStats, probe)); err != nil {
+				return fmt.Errorf("error writing probe record: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pe *probesExporter) writeCSV(pingsStats []*pingStatistics) error {
+	writer := csv.NewWriter(pe.writer)
+
+	if !pe.headerWritten {
+		if err := writer.Write(probeRecordCSVHeader); err != nil {
+			return fmt.Errorf("error writing CSV header: %v", err)
+		}
+
+		pe.headerWritten = true
+	}
+
+	for _, pingStats := range pingsStats {
+		for _, probe := range pingStats.probes {
+			record := getProbeRecord(pingStats, probe)
+
+			rtt := ""
+			if record.RTT != nil {
+				rtt = strconv.FormatFloat(*record.RTT, 'f', probeRecordRttPrecision, 64)
+			}
+
+			if err := writer.Write([]string{
+				record.RunID,
+				record.Timestamp,
+				record.Address,
+				record.ResolvedIP,
+				strconv.FormatBool(record.Success),
+				rtt,
+				record.Error,
+				record.ErrorReason,
+				formatProbeRecordCSVLabels(record.Labels),
+				strconv.FormatBool(record.Maintenance),
+			}); err != nil {
+				return fmt.Errorf("error writing probe record: %v", err)
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatProbeRecordCSVLabels writes the labels as name=value pairs sorted by name, like env=prod;team=db
+func formatProbeRecordCSVLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for labelName, labelValue := range labels {
+		pairs = append(pairs, labelName+"="+labelValue)
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, probeRecordCSVLabelsSep)
+}
+
+func getProbeRecord(pingStats *pingStatistics, probe *probeResult) *probeRecord {
+	record := &probeRecord{
+		RunID:       pingStats.runID,
+		Timestamp:   probe.timestamp.UTC().Format(probeRecordTimeLayout),
+		Address:     probe.address,
+		ResolvedIP:  probe.resolvedIP,
+		Success:     probe.err == nil,
+		Labels:      pingStats.labels,
+		Maintenance: pingStats.maintenance,
+	}
+
+	if probe.err == nil {
+		rtt := probe.rtt
+		record.RTT = &rtt
+	} else {
+		record.Error = probe.err.Error()
+		record.ErrorReason = probe.errorReason
+	}
+
+	return record
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestRunPingsStats() []*pingStatistics {
+	pingsStats := getTestPingsStats()
+	for _, pingStats := range pingsStats {
+		pingStats.runID = "0123456789abcdef"
+	}
+
+	return pingsStats
+}
+
+func TestNewProbesExporter_InvalidFormat(t *testing.T) {
+	err := os.Setenv(probesFormatEnvName, "xml")
+	require.NoError(t, err)
+
+	_, err = newProbesExporter(nil)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestProbesExporter_ExportJSONL(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	probesExp := &probesExporter{format: probesFormatJSONL, writer: buffer}
+
+	err := probesExp.export(context.Background(), getTestRunPingsStats())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 6)
+
+	records := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		record := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+
+		records = append(records, record)
+	}
+
+	assert.Equal(t, "0123456789abcdef", records[0]["run_id"])
+	assert.Equal(t, "2022-03-01T12:00:00Z", records[0]["timestamp"])
+	assert.Equal(t, "www.google.com:80", records[0]["address"])
+	assert.Equal(t, "1.1.1.1", records[0]["resolved_ip"])
+	assert.Equal(t, true, records[0]["success"])
+	assert.Equal(t, 10.5, records[0]["rtt_ms"])
+	assert.Equal(t, "", records[0]["error"])
+
+	assert.Equal(t, false, records[1]["success"])
+	assert.Nil(t, records[1]["rtt_ms"])
+	assert.Equal(t, probeErrorReasonConnectionRefused, records[1]["error_reason"])
+}
+
+func TestProbesExporter_ExportCSVFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "probes.csv")
+
+	err := os.Setenv(probesOutputEnvName, filePath)
+	require.NoError(t, err)
+
+	err = os.Setenv(probesFormatEnvName, probesFormatCSV)
+	require.NoError(t, err)
+
+	for run := 0; run < 2; run++ {
+		exp, err := newProbesExporter(nil)
+		require.NoError(t, err)
+
+		err = exp.export(context.Background(), getTestRunPingsStats())
+		require.NoError(t, err)
+
+		err = exp.shutdown(context.Background())
+		require.NoError(t, err)
+	}
+
+	file, err := os.Open(filePath)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	records, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+
+	// The header is written once, even when the file is reopened by a later run
+	require.Len(t, records, 13)
+	assert.Equal(t, probeRecordCSVHeader, records[0])
+	assert.Equal(t, []string{"0123456789abcdef", "2022-03-01T12:00:00Z", "www.google.com:80", "1.1.1.1", "true", "10.500", "", "", "", "false"}, records[1])
+	assert.Equal(t, []string{"0123456789abcdef", "2022-03-01T12:00:01Z", "www.google.com:80", "", "false", "", "connection refused", probeErrorReasonConnectionRefused, "", "false"}, records[2])
+
+	os.Clearenv()
+}
+
+func TestProbesExporter_ExportCSVLabels(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	probesExp := &probesExporter{format: probesFormatCSV, writer: buffer}
+
+	pingsStats := getTestRunPingsStats()
+	pingsStats[1].labels = map[string]string{"team": "logs", "env": "prod"}
+	pingsStats[1].maintenance = true
+
+	require.NoError(t, probesExp.export(context.Background(), pingsStats))
+
+	records, err := csv.NewReader(buffer).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 7)
+
+	// The CSV rows carry the same labels and maintenance tag as the JSON Lines records
+	assert.Equal(t, []string{"", "false"}, records[1][8:])
+	assert.Equal(t, []string{"env=prod;team=logs", "true"}, records[4][8:])
+}
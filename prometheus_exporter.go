@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	prometheusExporterName            = "prometheus"
+	prometheusListenAddressEnvName    = "PROMETHEUS_LISTEN_ADDRESS"
+	prometheusDefaultListenAddress    = ":9464"
+	prometheusMetricsPath             = "/metrics"
+	prometheusTextContentType         = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType            = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	openMetricsAcceptType             = "application/openmetrics-text"
+	lastUpdateTimestampMetricName     = meterName + "_last_update_timestamp_seconds"
+	updatesMetricName                 = meterName + "_updates"
+	runInfoMetricName                 = meterName + "_run_info"
+	pingCountLabelName                = "ping_count"
+	pingIntervalLabelName             = "ping_interval_seconds"
+	pingTimeoutLabelName              = "ping_timeout_seconds"
+	prometheusServerReadHeaderTimeout = 10 * time.Second
+)
+
+type prometheusExporter struct {
+	server         *http.Server
+	listener       net.Listener
+	resourceLabels map[string]string
+	runInfoLabels  map[string]string
+	lock           sync.RWMutex
+	snapshot       *prometheusSnapshot
+}
+
+// prometheusSnapshot holds the latest results served to scrapers. It is never modified after being published.
+type prometheusSnapshot struct {
+	pingsStats []*pingStatistics
+	updatedAt  time.Time
+	updates    int
+}
+
+func newPrometheusExporter(lps *logzioPingStatistics) (exporter, error) {
+	listenAddress := os.Getenv(prometheusListenAddressEnvName)
+	if listenAddress == "" {
+		listenAddress = prometheusDefaultListenAddress
+	}
+
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %v", listenAddress, err)
+	}
+
+	pe := &prometheusExporter{
+		listener:       listener,
+		resourceLabels: getResourceLabels(),
+		runInfoLabels: map[string]string{
+			pingCountLabelName:    strconv.Itoa(lps.pingCount),
+			pingIntervalLabelName: strconv.FormatFloat(lps.pingInterval.Seconds(), 'g', -1, 64),
+			pingTimeoutLabelName:  strconv.FormatFloat(lps.pingTimeout.Seconds(), 'g', -1, 64),
+		},
+		snapshot: &prometheusSnapshot{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(prometheusMetricsPath, pe.handleMetrics)
+
+	pe.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: prometheusServerReadHeaderTimeout,
+	}
+
+	go func() {
+		if err := pe.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			errorLogger.Println("Error serving Prometheus metrics:", err)
+		}
+	}()
+
+	infoLogger.Println("Serving Prometheus metrics on", listener.Addr().String()+prometheusMetricsPath)
+	return pe, nil
+}
+
+func (pe *prometheusExporter) name() string {
+	return prometheusExporterName
+}
+
+// export publishes a new snapshot in which the given addresses' results replace the previous ones
+func (pe *prometheusExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	pe.lock.Lock()
+	defer pe.lock.Unlock()
+
+	updatedAddresses := make(map[string]bool)
+	for _, pingStats := range pingsStats {
+		updatedAddresses[pingStats.address] = true
+	}
+
+	newPingsStats := make([]*pingStatistics, 0, len(pe.snapshot.pingsStats)+len(pingsStats))
+	for _, pingStats := range pe.snapshot.pingsStats {
+		if !updatedAddresses[pingStats.address] {
+			newPingsStats = append(newPingsStats, pingStats)
+		}
+	}
+
+	pe.snapshot = &prometheusSnapshot{
+		pingsStats: append(newPingsStats, pingsStats...),
+		updatedAt:  time.Now(),
+		updates:    pe.snapshot.updates + 1,
+	}
+
+	return nil
+}
+
+func (pe *prometheusExporter) shutdown(ctx context.Context) error {
+	return pe.server.Shutdown(ctx)
+}
+
+func (pe *prometheusExporter) getSnapshot() *prometheusSnapshot {
+	pe.lock.RLock()
+	defer pe.lock.RUnlock()
+
+	return pe.snapshot
+}
+
+func (pe *prometheusExporter) handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	openMetrics := strings.Contains(request.Header.Get("Accept"), openMetricsAcceptType)
+
+	if openMetrics {
+		writer.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		writer.Header().Set("Content-Type", prometheusTextContentType)
+	}
+
+	if _, err := writer.Write([]byte(pe.formatSnapshot(pe.getSnapshot(), openMetrics))); err != nil {
+		errorLogger.Println("Error writing Prometheus metrics:", err)
+	}
+}
+
+func (pe *prometheusExporter) formatSnapshot(snapshot *prometheusSnapshot, openMetrics bool) string {
+	builder := &strings.Builder{}
+	metricPoints := getMetricPoints(snapshot.pingsStats)
+
+	for _, metricName := range getMetricNames(metricPoints) {
+		writeMetricFamilyHeader(builder, metricName, "gauge", metricDescriptions[metricName])
+
+		for _, point := range metricPoints {
+			if point.name == metricName {
+				builder.WriteString(formatMetricPoint(point, pe.resourceLabels) + "\n")
+			}
+		}
+	}
+
+	lastUpdateTimestamp := float64(0)
+	if !snapshot.updatedAt.IsZero() {
+		lastUpdateTimestamp = float64(snapshot.updatedAt.UnixNano()) / float64(time.Second)
+	}
+
+	writeMetricFamilyHeader(builder, lastUpdateTimestampMetricName, "gauge", "Unix time of the last ping statistics update")
+	builder.WriteString(formatMetricPoint(&metricPoint{name: lastUpdateTimestampMetricName, value: lastUpdateTimestamp}, pe.resourceLabels) + "\n")
+
+	// OpenMetrics names the counter family without the _total suffix of its sample
+	updatesFamilyName := updatesMetricName + "_total"
+	if openMetrics {
+		updatesFamilyName = updatesMetricName
+	}
+
+	writeMetricFamilyHeader(builder, updatesFamilyName, "counter", "Number of ping statistics updates")
+	builder.WriteString(formatMetricPoint(&metricPoint{name: updatesMetricName + "_total", value: float64(snapshot.updates)}, pe.resourceLabels) + "\n")
+
+	writeMetricFamilyHeader(builder, runInfoMetricName, "gauge", "Ping statistics run configuration")
+	builder.WriteString(formatMetricPoint(&metricPoint{name: runInfoMetricName, labels: pe.runInfoLabels, value: 1}, pe.resourceLabels) + "\n")
+
+	if openMetrics {
+		builder.WriteString("# EOF\n")
+	}
+
+	return builder.String()
+}
+
+func writeMetricFamilyHeader(builder *strings.Builder, familyName string, metricType string, description string) {
+	builder.WriteString("# HELP " + familyName + " " + description + "\n")
+	builder.WriteString("# TYPE " + familyName + " " + metricType + "\n")
+}
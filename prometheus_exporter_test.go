@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getPrometheusMetrics(t *testing.T, url string, accept string) (string, string) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+
+	defer func(body io.ReadCloser) {
+		if err = body.Close(); err != nil {
+			panic(err)
+		}
+	}(response.Body)
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	return response.Header.Get("Content-Type"), string(body)
+}
+
+func TestPrometheusExporter_Export(t *testing.T) {
+	err := os.Setenv(prometheusListenAddressEnvName, "127.0.0.1:0")
+	require.NoError(t, err)
+
+	err = os.Setenv(awsRegionEnvName, "us-east-1")
+	require.NoError(t, err)
+
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          context.Background(),
+		pingCount:    3,
+		pingInterval: 1 * time.Second,
+		pingTimeout:  10 * time.Second,
+	}
+
+	exp, err := newPrometheusExporter(logzioPingStats)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, exp.shutdown(context.Background()))
+	}()
+
+	url := "http://" + exp.(*prometheusExporter).listener.Addr().String() + prometheusMetricsPath
+
+	_, body := getPrometheusMetrics(t, url, "")
+	assert.NotContains(t, body, rttMetricName)
+	assert.Contains(t, body, "ping_stats_updates_total{aws_lambda_function=\"\",aws_region=\"us-east-1\"} 0\n")
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	// A later export only replaces the results of the addresses it contains
+	err = exp.export(context.Background(), []*pingStatistics{
+		{
+			probesSent:       3,
+			successfulProbes: 3,
+			probesFailed:     0,
+			address:          "listener.logz.io:8053",
+			rtts:             []float64{1, 2, 3},
+		},
+	})
+	require.NoError(t, err)
+
+	contentType, body := getPrometheusMetrics(t, url, "")
+	assert.Equal(t, prometheusTextContentType, contentType)
+	assert.Contains(t, body, "# TYPE ping_stats_rtt gauge\n")
+	assert.Contains(t, body, `ping_stats_rtt{address="www.google.com:80",aws_lambda_function="",aws_region="us-east-1",rtt_index="2",total_rtts="2",unit="milliseconds"} 12.25`)
+	assert.Contains(t, body, `ping_stats_probes_failed{address="listener.logz.io:8053",aws_lambda_function="",aws_region="us-east-1"} 0`)
+	assert.NotContains(t, body, `ping_stats_probes_failed{address="listener.logz.io:8053",aws_lambda_function="",aws_region="us-east-1"} 3`)
+	assert.Contains(t, body, "# TYPE ping_stats_updates_total counter\n")
+	assert.Contains(t, body, "ping_stats_updates_total{aws_lambda_function=\"\",aws_region=\"us-east-1\"} 2\n")
+	assert.Contains(t, body, `ping_stats_run_info{aws_lambda_function="",aws_region="us-east-1",ping_count="3",ping_interval_seconds="1",ping_timeout_seconds="10"} 1`)
+	assert.NotContains(t, body, "# EOF")
+
+	contentType, body = getPrometheusMetrics(t, url, "application/openmetrics-text; version=1.0.0")
+	assert.Equal(t, openMetricsContentType, contentType)
+	assert.Contains(t, body, "# TYPE ping_stats_updates counter\n")
+	assert.Contains(t, body, "ping_stats_updates_total{aws_lambda_function=\"\",aws_region=\"us-east-1\"} 2\n")
+	assert.Contains(t, body, "\n# EOF\n")
+
+	os.Clearenv()
+}
+
+func TestNewPrometheusExporter_AddressInUse(t *testing.T) {
+	err := os.Setenv(prometheusListenAddressEnvName, "127.0.0.1:0")
+	require.NoError(t, err)
+
+	exp, err := newPrometheusExporter(&logzioPingStatistics{})
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, exp.shutdown(context.Background()))
+	}()
+
+	err = os.Setenv(prometheusListenAddressEnvName, exp.(*prometheusExporter).listener.Addr().String())
+	require.NoError(t, err)
+
+	_, err = newPrometheusExporter(&logzioPingStatistics{})
+	require.Error(t, err)
+
+	os.Clearenv()
+}
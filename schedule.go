@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	targetSchedulesEnvName = "TARGET_SCHEDULES"
+	scheduleJitterEnvName  = "SCHEDULE_JITTER"
+)
+
+// targetSchedule is how often an address is probed in daemon mode, and up to how long its first probe is delayed
+type targetSchedule struct {
+	address  string
+	interval time.Duration
+	jitter   time.Duration
+}
+
+// rawTargetSchedule is a TARGET_SCHEDULES entry, in seconds
+type rawTargetSchedule struct {
+	Interval *int `json:"interval"`
+	Jitter   *int `json:"jitter"`
+}
+
+// getTargetSchedules returns a schedule for each address. The addresses that are not in TARGET_SCHEDULES,
+// and the entries that leave out a value, use the SCHEDULE_INTERVAL and SCHEDULE_JITTER defaults.
+func getTargetSchedules(envValue string, addresses []string, defaultInterval time.Duration, defaultJitter time.Duration) ([]*targetSchedule, error) {
+	rawTargetSchedules := make(map[string]*rawTargetSchedule)
+
+	if envValue != "" {
+		if err := json.Unmarshal([]byte(envValue), &rawTargetSchedules); err != nil {
+			return nil, fmt.Errorf("%s must be a JSON object of address to schedule: %v", targetSchedulesEnvName, err)
+		}
+	}
+
+	normalizedSchedules := make(map[string]*rawTargetSchedule)
+
+	for address, rawSchedule := range rawTargetSchedules {
+		normalizedAddress := getAddresses(address)[0]
+
+		if !containsString(addresses, normalizedAddress) {
+			return nil, fmt.Errorf("%s contains a schedule of an address that is not in %s: %s", targetSchedulesEnvName, addressesEnvName, address)
+		}
+
+		if rawSchedule == nil {
+			continue
+		}
+
+		if rawSchedule.Interval != nil && *rawSchedule.Interval < 1 {
+			return nil, fmt.Errorf("%s interval of %s must be a positive number", targetSchedulesEnvName, address)
+		}
+
+		if rawSchedule.Jitter != nil && *rawSchedule.Jitter < 0 {
+			return nil, fmt.Errorf("%s jitter of %s must be a non-negative number", targetSchedulesEnvName, address)
+		}
+
+		normalizedSchedules[normalizedAddress] = rawSchedule
+	}
+
+	schedules := make([]*targetSchedule, 0, len(addresses))
+
+	for _, address := range addresses {
+		schedule := &targetSchedule{
+			address:  address,
+			interval: defaultInterval,
+			jitter:   defaultJitter,
+		}
+
+		if rawSchedule, ok := normalizedSchedules[address]; ok {
+			if rawSchedule.Interval != nil {
+				schedule.interval = time.Duration(*rawSchedule.Interval) * time.Second
+			}
+
+			if rawSchedule.Jitter != nil {
+				schedule.jitter = time.Duration(*rawSchedule.Jitter) * time.Second
+			}
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+func getScheduleJitter() (time.Duration, error) {
+	scheduleJitterString := os.Getenv(scheduleJitterEnvName)
+	if scheduleJitterString == "" {
+		return 0, nil
+	}
+
+	scheduleJitter, err := strconv.Atoi(scheduleJitterString)
+	if err != nil || scheduleJitter < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number", scheduleJitterEnvName)
+	}
+
+	return time.Duration(scheduleJitter) * time.Second, nil
+}
+
+// runTargetSchedule probes the address of the schedule every interval, after a random start delay up to the jitter,
+// and exports each cycle's results on their own, until stopCtx is done
+func (lps *logzioPingStatistics) runTargetSchedule(stopCtx context.Context, schedule *targetSchedule) {
+	if schedule.jitter > 0 {
+		startDelay := time.Duration(rand.Int63n(int64(schedule.jitter)))
+		debugLogger.Println("Delaying the first probe of", schedule.address, "by", startDelay)
+
+		if !sleepContext(stopCtx, startDelay) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(schedule.interval)
+	defer ticker.Stop()
+
+	for stopCtx.Err() == nil {
+		if err := lps.runTargetCycle(schedule.address); err != nil {
+			errorLogger.Println("Error in probe cycle of address", schedule.address, ":", err)
+		}
+
+		select {
+		case <-stopCtx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// runTargetCycle probes a single address and exports its results as a run of their own
+func (lps *logzioPingStatistics) runTargetCycle(address string) error {
+	start := time.Now()
+
+	pingStats, err := lps.getAddressPingStatistics(address)
+	if err != nil {
+		return fmt.Errorf("error getting ping statistics: %v", err)
+	}
+
+	elapsed := time.Since(start)
+
+	// A cycle canceled before its first probe has nothing to export
+	if pingStats.probesSent == 0 && lps.ctx != nil && lps.ctx.Err() != nil {
+		return nil
+	}
+
+	pingStats.runID = newRunID()
+	lps.markMaintenance([]*pingStatistics{pingStats}, start)
+	lps.trackStates([]*pingStatistics{pingStats})
+	lps.evaluateAlerts([]*pingStatistics{pingStats})
+
+	_, err = lps.exportPingsStats([]*pingStatistics{pingStats})
+
+	if lps.cycleHandler != nil {
+		lps.cycleHandler(pingStats, elapsed, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error collecting metrics: %v", err)
+	}
+
+	return nil
+}
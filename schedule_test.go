@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingExporter records the addresses of each export, and is safe to export to concurrently
+type recordingExporter struct {
+	lock    sync.Mutex
+	exports [][]string
+}
+
+func (re *recordingExporter) name() string {
+	return "recording"
+}
+
+func (re *recordingExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	re.lock.Lock()
+	defer re.lock.Unlock()
+
+	addresses := make([]string, 0, len(pingsStats))
+	for _, pingStats := range pingsStats {
+		addresses = append(addresses, pingStats.address)
+	}
+
+	re.exports = append(re.exports, addresses)
+	return nil
+}
+
+func (re *recordingExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+func (re *recordingExporter) getExports() [][]string {
+	re.lock.Lock()
+	defer re.lock.Unlock()
+
+	return append([][]string{}, re.exports...)
+}
+
+func TestGetTargetSchedules_Success(t *testing.T) {
+	addresses := []string{"www.google.com:80", "listener.logz.io:8053", "www.example.com:443"}
+
+	schedules, err := getTargetSchedules(`{"https://www.google.com": {"interval": 10, "jitter": 2}, "listener.logz.io:8053": {"interval": 300}}`,
+		addresses, time.Minute, 5*time.Second)
+	require.NoError(t, err)
+
+	require.Len(t, schedules, 3)
+	assert.Equal(t, &targetSchedule{address: "www.google.com:80", interval: 10 * time.Second, jitter: 2 * time.Second}, schedules[0])
+	assert.Equal(t, &targetSchedule{address: "listener.logz.io:8053", interval: 5 * time.Minute, jitter: 5 * time.Second}, schedules[1])
+	assert.Equal(t, &targetSchedule{address: "www.example.com:443", interval: time.Minute, jitter: 5 * time.Second}, schedules[2])
+}
+
+func TestGetTargetSchedules_Invalid(t *testing.T) {
+	addresses := []string{"www.google.com:80"}
+	invalidValues := []string{
+		`["www.google.com"]`,
+		`{"www.example.com": {"interval": 10}}`,
+		`{"www.google.com": {"interval": 0}}`,
+		`{"www.google.com": {"jitter": -1}}`,
+	}
+
+	for _, invalidValue := range invalidValues {
+		_, err := getTargetSchedules(invalidValue, addresses, time.Minute, 0)
+		assert.Error(t, err, invalidValue)
+	}
+}
+
+func TestGetScheduleJitter(t *testing.T) {
+	scheduleJitter, err := getScheduleJitter()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), scheduleJitter)
+
+	err = os.Setenv(scheduleJitterEnvName, "3")
+	require.NoError(t, err)
+
+	scheduleJitter, err = getScheduleJitter()
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, scheduleJitter)
+
+	err = os.Setenv(scheduleJitterEnvName, "-3")
+	require.NoError(t, err)
+
+	_, err = getScheduleJitter()
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestRunTargetSchedule_ExportsEachTargetOnItsOwn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func(listener net.Listener) {
+		_ = listener.Close()
+	}(listener)
+
+	recordingExp := &recordingExporter{}
+	logzioPingStats := &logzioPingStatistics{
+		ctx:          context.Background(),
+		pingCount:    1,
+		pingInterval: 0,
+		pingTimeout:  time.Second,
+		exporters:    []exporter{recordingExp},
+	}
+
+	fastAddress := listener.Addr().String()
+	slowAddress := "127.0.0.1:1"
+
+	stopCtx, stop := context.WithTimeout(context.Background(), 1100*time.Millisecond)
+	defer stop()
+
+	waitGroup := &sync.WaitGroup{}
+	for _, schedule := range []*targetSchedule{
+		{address: fastAddress, interval: 200 * time.Millisecond, jitter: 100 * time.Millisecond},
+		{address: slowAddress, interval: time.Hour},
+	} {
+		waitGroup.Add(1)
+		go func(schedule *targetSchedule) {
+			defer waitGroup.Done()
+			logzioPingStats.runTargetSchedule(stopCtx, schedule)
+		}(schedule)
+	}
+
+	waitGroup.Wait()
+
+	fastExports := 0
+	slowExports := 0
+
+	for _, addresses := range recordingExp.getExports() {
+		require.Len(t, addresses, 1)
+
+		if addresses[0] == fastAddress {
+			fastExports++
+		} else {
+			slowExports++
+		}
+	}
+
+	assert.GreaterOrEqual(t, fastExports, 4)
+	assert.Equal(t, 1, slowExports)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	stateDirEnvName        = "STATE_DIR"
+	stateS3EndpointEnvName = "STATE_S3_ENDPOINT"
+	stateS3RegionEnvName   = "STATE_S3_REGION"
+	defaultStateDirName    = "logzio-ping-statistics-state"
+	stateFileSuffix        = ".json"
+	stateFilePermissions   = 0600
+	stateDirPermissions    = 0700
+)
+
+var stateKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// stateStore keeps the state that has to outlive a run, such as which alerts were notified and the target states.
+// A key holds a single JSON value.
+type stateStore interface {
+	// load reads the value of the key into value, and returns false if the key was never saved
+	load(ctx context.Context, key string, value interface{}) (bool, error)
+	save(ctx context.Context, key string, value interface{}) error
+}
+
+// fileStateStore keeps each key in a JSON file of its own
+type fileStateStore struct {
+	dir string
+}
+
+// objectStateStore keeps each key in a JSON object of a bucket, so the state outlives the Lambda environment
+type objectStateStore struct {
+	objects objectWriter
+}
+
+// newStateStore returns the state store of STATE_DIR, which is a local dir or an s3://bucket/prefix URL
+func newStateStore() (stateStore, error) {
+	stateDir := getStateDir()
+
+	if strings.HasPrefix(stateDir, s3OutputPrefix) {
+		region := os.Getenv(stateS3RegionEnvName)
+		if region == "" {
+			region = os.Getenv(awsRegionEnvName)
+		}
+
+		objects, err := newObjectWriter(stateDir, os.Getenv(stateS3EndpointEnvName), region)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", stateDirEnvName, err)
+		}
+
+		return &objectStateStore{objects: objects}, nil
+	}
+
+	// In Lambda the default temp dir is /tmp, so the state survives between warm invocations only
+	if os.Getenv(stateDirEnvName) == "" && os.Getenv(awsLambdaFunctionNameEnvName) != "" {
+		infoLogger.Println(stateDirEnvName, "is not set, so the state is kept in", stateDir, "and starts over after a cold start")
+	}
+
+	return newFileStateStore(stateDir)
+}
+
+// getStateDir returns STATE_DIR, or a dir in the temp dir
+func getStateDir() string {
+	if stateDir := os.Getenv(stateDirEnvName); stateDir != "" {
+		return stateDir
+	}
+
+	return filepath.Join(os.TempDir(), defaultStateDirName)
+}
+
+func newFileStateStore(dir string) (*fileStateStore, error) {
+	if err := os.MkdirAll(dir, stateDirPermissions); err != nil {
+		return nil, fmt.Errorf("error creating state dir %s: %v", dir, err)
+	}
+
+	return &fileStateStore{dir: dir}, nil
+}
+
+func (fss *fileStateStore) load(_ context.Context, key string, value interface{}) (bool, error) {
+	if !stateKeyRegexp.MatchString(key) {
+		return false, fmt.Errorf("invalid state key: %s", key)
+	}
+
+	data, err := os.ReadFile(filepath.Join(fss.dir, key+stateFileSuffix))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error reading state %s: %v", key, err)
+	}
+
+	if err = json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("error parsing state %s: %v", key, err)
+	}
+
+	return true, nil
+}
+
+func (fss *fileStateStore) save(_ context.Context, key string, value interface{}) error {
+	if !stateKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid state key: %s", key)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error marshaling state %s: %v", key, err)
+	}
+
+	// The state is renamed into place so a crash never leaves a partial file
+	tempPath := filepath.Join(fss.dir, "."+key+stateFileSuffix)
+	if err = os.WriteFile(tempPath, data, stateFilePermissions); err != nil {
+		return fmt.Errorf("error writing state %s: %v", key, err)
+	}
+
+	return os.Rename(tempPath, filepath.Join(fss.dir, key+stateFileSuffix))
+}
+
+func (oss *objectStateStore) load(ctx context.Context, key string, value interface{}) (bool, error) {
+	if !stateKeyRegexp.MatchString(key) {
+		return false, fmt.Errorf("invalid state key: %s", key)
+	}
+
+	data, found, err := oss.objects.read(ctx, key+stateFileSuffix)
+	if err != nil || !found {
+		return false, err
+	}
+
+	if err = json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("error parsing state %s: %v", key, err)
+	}
+
+	return true, nil
+}
+
+func (oss *objectStateStore) save(ctx context.Context, key string, value interface{}) error {
+	if !stateKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid state key: %s", key)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error marshaling state %s: %v", key, err)
+	}
+
+	return oss.objects.write(ctx, key+stateFileSuffix, "application/json", data)
+}
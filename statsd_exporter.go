@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	statsdExporterName       = "statsd"
+	statsdAddressEnvName     = "STATSD_ADDRESS"
+	statsdPrefixEnvName      = "STATSD_PREFIX"
+	statsdTagFormatEnvName   = "STATSD_TAG_FORMAT"
+	statsdTagFormatNone      = "none"
+	statsdTagFormatDogStatsD = "dogstatsd"
+	statsdUDPPrefix          = "udp://"
+	statsdUnixPrefix         = "unix://"
+	statsdUDPMaxPacketSize   = 1432
+	statsdUnixMaxPacketSize  = 8192
+	statsdDialTimeout        = 5 * time.Second
+	statsdTimingType         = "ms"
+	statsdCounterType        = "c"
+	statsdGaugeType          = "g"
+)
+
+var (
+	statsdNameInvalidCharsRegexp = regexp.MustCompile("[^a-zA-Z0-9_-]")
+	statsdTagInvalidCharsRegexp  = regexp.MustCompile("[,|#\n]")
+
+	// statsdFlagNames are the labels that plain StatsD adds to the metric name, so flagged results stay apart
+	statsdFlagNames = []string{truncatedLabelName, maintenanceLabelName}
+)
+
+type statsdExporter struct {
+	network        string
+	address        string
+	prefix         string
+	dogStatsD      bool
+	maxPacketSize  int
+	resourceLabels map[string]string
+	conn           net.Conn
+}
+
+func newStatsdExporter(_ *logzioPingStatistics) (exporter, error) {
+	address := os.Getenv(statsdAddressEnvName)
+	if address == "" {
+		return nil, fmt.Errorf("%s must not be empty", statsdAddressEnvName)
+	}
+
+	tagFormat := os.Getenv(statsdTagFormatEnvName)
+	if tagFormat == "" {
+		tagFormat = statsdTagFormatNone
+	}
+
+	if tagFormat != statsdTagFormatNone && tagFormat != statsdTagFormatDogStatsD {
+		return nil, fmt.Errorf("%s must be %s or %s", statsdTagFormatEnvName, statsdTagFormatNone, statsdTagFormatDogStatsD)
+	}
+
+	se := &statsdExporter{
+		network:        "udp",
+		address:        strings.TrimPrefix(address, statsdUDPPrefix),
+		prefix:         os.Getenv(statsdPrefixEnvName),
+		dogStatsD:      tagFormat == statsdTagFormatDogStatsD,
+		maxPacketSize:  statsdUDPMaxPacketSize,
+		resourceLabels: getResourceLabels(),
+	}
+
+	if strings.HasPrefix(address, statsdUnixPrefix) {
+		se.network = "unixgram"
+		se.address = strings.TrimPrefix(address, statsdUnixPrefix)
+		se.maxPacketSize = statsdUnixMaxPacketSize
+	}
+
+	if se.prefix != "" && !strings.HasSuffix(se.prefix, ".") {
+		se.prefix += "."
+	}
+
+	return se, nil
+}
+
+func (se *statsdExporter) name() string {
+	return statsdExporterName
+}
+
+func (se *statsdExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	if se.conn == nil {
+		conn, err := net.DialTimeout(se.network, se.address, statsdDialTimeout)
+		if err != nil {
+			return fmt.Errorf("error connecting to StatsD at %s: %w", se.address, err)
+		}
+
+		se.conn = conn
+	}
+
+	packet := &strings.Builder{}
+
+	for _, line := range se.getLines(pingsStats) {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > se.maxPacketSize {
+			if err := se.sendPacket(packet.String()); err != nil {
+				return err
+			}
+
+			packet.Reset()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+
+		packet.WriteString(line)
+	}
+
+	if packet.Len() == 0 {
+		return nil
+	}
+
+	return se.sendPacket(packet.String())
+}
+
+func (se *statsdExporter) shutdown(_ context.Context) error {
+	if se.conn == nil {
+		return nil
+	}
+
+	err := se.conn.Close()
+	se.conn = nil
+
+	return err
+}
+
+// sendPacket writes the packet, and drops the connection if it fails, so the next attempt dials again.
+// A restarted agent has a new socket, and the old connection would fail for the rest of the process.
+func (se *statsdExporter) sendPacket(packet string) error {
+	if _, err := se.conn.Write([]byte(packet)); err != nil {
+		_ = se.conn.Close()
+		se.conn = nil
+
+		return fmt.Errorf("error writing StatsD packet: %w", err)
+	}
+
+	return nil
+}
+
+// getLines returns a timing line per RTT and a counter line per probe counter of each address
+func (se *statsdExporter) getLines(pingsStats []*pingStatistics) []string {
+	lines := make([]string, 0)
+
+	for _, pingStats := range pingsStats {
+		labels := mergeLabels(se.resourceLabels, pingStats.getLabels())
+
+		for _, rtt := range pingStats.rtts {
+			lines = append(lines, se.formatLine(rttMetricName, rtt, statsdTimingType, labels))
+		}
+
+		lines = append(lines,
+			se.formatLine(probesSentMetricName, float64(pingStats.probesSent), statsdCounterType, labels),
+			se.formatLine(successfulProbesMetricName, float64(pingStats.successfulProbes), statsdCounterType, labels),
+			se.formatLine(probesFailedMetricName, float64(pingStats.probesFailed), statsdCounterType, labels),
+		)
+
+		if pingStats.state != "" {
+			lines = append(lines, se.formatLine(stateMetricName, targetStateValues[pingStats.state], statsdGaugeType, labels))
+		}
+	}
+
+	return lines
+}
+
+func (se *statsdExporter) formatLine(metricName string, value float64, metricType string, labels map[string]string) string {
+	formattedValue := strconv.FormatFloat(value, 'f', -1, 64)
+
+	if !se.dogStatsD {
+		// Plain StatsD has no tags, so the address and the flags of the results become part of the metric name
+		name := metricName + "." + statsdNameInvalidCharsRegexp.ReplaceAllString(labels[addressLabelName], "_")
+		for _, flagName := range statsdFlagNames {
+			if labels[flagName] == strconv.FormatBool(true) {
+				name += "." + flagName
+			}
+		}
+
+		return se.prefix + name + ":" + formattedValue + "|" + metricType
+	}
+
+	tags := make([]string, 0, len(labels))
+	for _, labelName := range getSortedLabelNames(labels) {
+		if labels[labelName] == "" {
+			continue
+		}
+
+		tags = append(tags, labelName+":"+statsdTagInvalidCharsRegexp.ReplaceAllString(labels[labelName], "_"))
+	}
+
+	return se.prefix + metricName + ":" + formattedValue + "|" + metricType + "|#" + strings.Join(tags, ",")
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readStatsdLines(t *testing.T, packetConn net.PacketConn) []string {
+	lines := make([]string, 0)
+	buffer := make([]byte, statsdUnixMaxPacketSize)
+
+	for {
+		err := packetConn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		require.NoError(t, err)
+
+		n, _, err := packetConn.ReadFrom(buffer)
+		if err != nil {
+			return lines
+		}
+
+		lines = append(lines, strings.Split(string(buffer[:n]), "\n")...)
+	}
+}
+
+func TestNewStatsdExporter_InvalidTagFormat(t *testing.T) {
+	err := os.Setenv(statsdAddressEnvName, "127.0.0.1:8125")
+	require.NoError(t, err)
+
+	err = os.Setenv(statsdTagFormatEnvName, "influx")
+	require.NoError(t, err)
+
+	_, err = newStatsdExporter(nil)
+	require.Error(t, err)
+
+	os.Clearenv()
+}
+
+func TestStatsdExporter_ExportUDP(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, packetConn.Close())
+	}()
+
+	err = os.Setenv(statsdAddressEnvName, statsdUDPPrefix+packetConn.LocalAddr().String())
+	require.NoError(t, err)
+
+	err = os.Setenv(statsdPrefixEnvName, "network")
+	require.NoError(t, err)
+
+	exp, err := newStatsdExporter(nil)
+	require.NoError(t, err)
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	err = exp.shutdown(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"network.ping_stats_rtt.www_google_com_80:10.5|ms",
+		"network.ping_stats_rtt.www_google_com_80:12.25|ms",
+		"network.ping_stats_probes_sent.www_google_com_80:3|c",
+		"network.ping_stats_successful_probes.www_google_com_80:2|c",
+		"network.ping_stats_probes_failed.www_google_com_80:1|c",
+		"network.ping_stats_probes_sent.listener_logz_io_8053:3|c",
+		"network.ping_stats_successful_probes.listener_logz_io_8053:0|c",
+		"network.ping_stats_probes_failed.listener_logz_io_8053:3|c",
+	}, readStatsdLines(t, packetConn))
+
+	os.Clearenv()
+}
+
+func TestStatsdExporter_ExportDogStatsDUnix(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+
+	packetConn, err := net.ListenPacket("unixgram", socketPath)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, packetConn.Close())
+	}()
+
+	err = os.Setenv(statsdAddressEnvName, statsdUnixPrefix+socketPath)
+	require.NoError(t, err)
+
+	err = os.Setenv(statsdTagFormatEnvName, statsdTagFormatDogStatsD)
+	require.NoError(t, err)
+
+	err = os.Setenv(awsRegionEnvName, "us-east-1")
+	require.NoError(t, err)
+
+	exp, err := newStatsdExporter(nil)
+	require.NoError(t, err)
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	err = exp.shutdown(context.Background())
+	require.NoError(t, err)
+
+	lines := readStatsdLines(t, packetConn)
+	require.Len(t, lines, 8)
+
+	assert.Equal(t, "ping_stats_rtt:10.5|ms|#address:www.google.com:80,aws_region:us-east-1", lines[0])
+	assert.Equal(t, "ping_stats_probes_failed:3|c|#address:listener.logz.io:8053,aws_region:us-east-1", lines[7])
+
+	os.Clearenv()
+}
+
+func TestStatsdExporter_ReconnectsAfterAgentRestart(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+
+	packetConn, err := net.ListenPacket("unixgram", socketPath)
+	require.NoError(t, err)
+
+	err = os.Setenv(statsdAddressEnvName, statsdUnixPrefix+socketPath)
+	require.NoError(t, err)
+
+	defer os.Clearenv()
+
+	exp, err := newStatsdExporter(nil)
+	require.NoError(t, err)
+
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()))
+	assert.Len(t, readStatsdLines(t, packetConn), 8)
+
+	// The agent stops, and its socket is gone
+	require.NoError(t, packetConn.Close())
+	require.NoError(t, os.Remove(socketPath))
+	assert.Error(t, exp.export(context.Background(), getTestPingsStats()))
+	assert.Nil(t, exp.(*statsdExporter).conn)
+
+	packetConn, err = net.ListenPacket("unixgram", socketPath)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, packetConn.Close())
+	}()
+
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()))
+	assert.Len(t, readStatsdLines(t, packetConn), 8)
+	require.NoError(t, exp.shutdown(context.Background()))
+}
+
+func TestStatsdExporter_ExportSplitsPackets(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, packetConn.Close())
+	}()
+
+	exp := &statsdExporter{
+		network:       "udp",
+		address:       packetConn.LocalAddr().String(),
+		maxPacketSize: 64,
+	}
+
+	err = exp.export(context.Background(), getTestPingsStats())
+	require.NoError(t, err)
+
+	assert.Len(t, readStatsdLines(t, packetConn), 8)
+}
+
+func TestStatsdExporter_PlainFlags(t *testing.T) {
+	exp := &statsdExporter{prefix: "network."}
+
+	pingStats := &pingStatistics{address: "www.google.com:80", labels: map[string]string{"team": "search"}, truncated: true, maintenance: true}
+	labels := pingStats.getLabels()
+
+	// The flags are part of the metric name, and the custom labels are left out
+	assert.Equal(t, "network.ping_stats_probes_sent.www_google_com_80.truncated.maintenance:3|c",
+		exp.formatLine(probesSentMetricName, 3, statsdCounterType, labels))
+
+	pingStats.truncated = false
+	assert.Equal(t, "network.ping_stats_probes_sent.www_google_com_80.maintenance:3|c",
+		exp.formatLine(probesSentMetricName, 3, statsdCounterType, pingStats.getLabels()))
+}
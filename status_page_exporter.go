@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statusPageExporterName        = "status_page"
+	statusPageOutputEnvName       = "STATUS_PAGE_OUTPUT"
+	statusPageTitleEnvName        = "STATUS_PAGE_TITLE"
+	statusPageGroupLabelEnvName   = "STATUS_PAGE_GROUP_LABEL"
+	statusPageHistoryEnvName      = "STATUS_PAGE_HISTORY"
+	statusPageS3EndpointEnvName   = "STATUS_PAGE_S3_ENDPOINT"
+	statusPageS3RegionEnvName     = "STATUS_PAGE_S3_REGION"
+	defaultStatusPageTitle        = "Service status"
+	defaultStatusPageGroupLabel   = "group"
+	defaultStatusPageGroup        = "Services"
+	defaultStatusPageHistory      = 90
+	statusPageStateKey            = "status_page"
+	statusPageHTMLName            = "index.html"
+	statusPageJSONName            = "status.json"
+	statusPageUnknown             = "unknown"
+	statusPageMaintenance         = "maintenance"
+	statusPageSparklineWidth      = 180
+	statusPageSparklineHeight     = 28
+	statusPageSparklinePrecision  = 1
+	statusPageUptimePrecision     = 2
+	statusPageFeedTimestampLayout = time.RFC3339
+)
+
+// statusPageRanks orders the statuses from the best to the worst, and the worst status of the targets is the status of their group
+var statusPageRanks = map[string]int{
+	statusPageUnknown:     0,
+	statusPageMaintenance: 1,
+	targetStateUp:         2,
+	targetStateDegraded:   3,
+	targetStateFlapping:   4,
+	targetStateDown:       5,
+}
+
+var statusPageDescriptions = map[string]string{
+	statusPageUnknown:     "No data yet",
+	statusPageMaintenance: "Under maintenance",
+	targetStateUp:         "Operational",
+	targetStateDegraded:   "Degraded performance",
+	targetStateFlapping:   "Intermittent outage",
+	targetStateDown:       "Outage",
+}
+
+// statusPageExporter keeps the recent runs of each target and writes them as a static HTML page and a JSON feed,
+// so the health of the targets can be shared without access to the metrics backend
+type statusPageExporter struct {
+	writer      objectWriter
+	title       string
+	groupLabel  string
+	historySize int
+	addresses   []string
+	store       stateStore
+	lps         *logzioPingStatistics
+	lock        sync.Mutex
+}
+
+// statusPageTargetHistory is the kept state of a target, with its runs oldest first
+type statusPageTargetHistory struct {
+	Group  string             `json:"group"`
+	Status string             `json:"status"`
+	Points []*statusPagePoint `json:"points"`
+}
+
+// statusPagePoint is a run of a target
+type statusPagePoint struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Sent        int       `json:"sent"`
+	Successful  int       `json:"successful"`
+	RttAvg      *float64  `json:"rtt_avg,omitempty"`
+	Maintenance bool      `json:"maintenance,omitempty"`
+}
+
+// statusPageFeed is the JSON feed, which the HTML page is rendered from
+type statusPageFeed struct {
+	Title       string             `json:"title"`
+	GeneratedAt time.Time          `json:"generated_at"`
+	Status      string             `json:"status"`
+	Groups      []*statusPageGroup `json:"groups"`
+}
+
+type statusPageGroup struct {
+	Name    string              `json:"name"`
+	Status  string              `json:"status"`
+	Uptime  *float64            `json:"uptime,omitempty"`
+	Targets []*statusPageTarget `json:"targets"`
+	History []*statusPagePoint  `json:"history"`
+}
+
+type statusPageTarget struct {
+	Address       string             `json:"address"`
+	Status        string             `json:"status"`
+	Uptime        *float64           `json:"uptime,omitempty"`
+	RttAvg        *float64           `json:"rtt_avg,omitempty"`
+	LastCheckedAt *time.Time         `json:"last_checked_at,omitempty"`
+	History       []*statusPagePoint `json:"history"`
+}
+
+func newStatusPageExporter(lps *logzioPingStatistics) (exporter, error) {
+	output := os.Getenv(statusPageOutputEnvName)
+	if output == "" {
+		return nil, fmt.Errorf("%s must not be empty", statusPageOutputEnvName)
+	}
+
+	region := os.Getenv(statusPageS3RegionEnvName)
+	if region == "" {
+		region = os.Getenv(awsRegionEnvName)
+	}
+
+	writer, err := newObjectWriter(output, os.Getenv(statusPageS3EndpointEnvName), region)
+	if err != nil {
+		return nil, err
+	}
+
+	spe := &statusPageExporter{
+		writer:      writer,
+		title:       os.Getenv(statusPageTitleEnvName),
+		groupLabel:  os.Getenv(statusPageGroupLabelEnvName),
+		historySize: defaultStatusPageHistory,
+		lps:         lps,
+	}
+
+	// The page shows the configured targets, including those an override run does not probe
+	if addressesString := os.Getenv(addressesEnvName); addressesString != "" {
+		spe.addresses = getAddresses(addressesString)
+	}
+
+	if spe.title == "" {
+		spe.title = defaultStatusPageTitle
+	}
+
+	if spe.groupLabel == "" {
+		spe.groupLabel = defaultStatusPageGroupLabel
+	}
+
+	if historySizeString := os.Getenv(statusPageHistoryEnvName); historySizeString != "" {
+		historySize, err := getNumberEnvValue(historySizeString, statusPageHistoryEnvName)
+		if err != nil {
+			return nil, err
+		}
+
+		spe.historySize = *historySize
+	}
+
+	if spe.store, err = newStateStore(); err != nil {
+		return nil, err
+	}
+
+	return spe, nil
+}
+
+func (spe *statusPageExporter) name() string {
+	return statusPageExporterName
+}
+
+func (spe *statusPageExporter) export(ctx context.Context, pingsStats []*pingStatistics) error {
+	// The daemon exports each target as its probes are done, and the page has all of them
+	spe.lock.Lock()
+	defer spe.lock.Unlock()
+
+	// Only a missing history starts over, as saving over a history that failed to load would lose it
+	histories := make(map[string]*statusPageTargetHistory)
+	if _, err := spe.store.load(ctx, statusPageStateKey, &histories); err != nil {
+		return fmt.Errorf("error loading the status page history: %v", err)
+	}
+
+	spe.addRuns(histories, pingsStats)
+
+	if err := spe.store.save(ctx, statusPageStateKey, histories); err != nil {
+		errorLogger.Println("Error saving the status page history:", err)
+	}
+
+	feed := spe.getFeed(histories, time.Now().UTC())
+
+	feedJSON, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling status feed: %v", err)
+	}
+
+	page := &bytes.Buffer{}
+	if err = statusPageTemplate.Execute(page, feed); err != nil {
+		return fmt.Errorf("error rendering status page: %v", err)
+	}
+
+	if err = spe.writer.write(ctx, statusPageJSONName, "application/json", feedJSON); err != nil {
+		return err
+	}
+
+	return spe.writer.write(ctx, statusPageHTMLName, "text/html; charset=utf-8", page.Bytes())
+}
+
+func (spe *statusPageExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+// addRuns adds the runs to the histories, and drops the targets that are no longer configured
+func (spe *statusPageExporter) addRuns(histories map[string]*statusPageTargetHistory, pingsStats []*pingStatistics) {
+	for _, pingStats := range pingsStats {
+		if pingStats.probesSent == 0 {
+			continue
+		}
+
+		history, ok := histories[pingStats.address]
+		if !ok {
+			history = &statusPageTargetHistory{}
+			histories[pingStats.address] = history
+		}
+
+		history.Group = pingStats.labels[spe.groupLabel]
+		if history.Group == "" {
+			history.Group = defaultStatusPageGroup
+		}
+
+		history.Status = getStatusPageStatus(pingStats)
+
+		point := &statusPagePoint{
+			Timestamp:   time.Now().UTC(),
+			Sent:        pingStats.probesSent,
+			Successful:  pingStats.successfulProbes,
+			Maintenance: pingStats.maintenance,
+		}
+
+		if len(pingStats.probes) > 0 {
+			point.Timestamp = pingStats.probes[len(pingStats.probes)-1].timestamp.UTC()
+		}
+
+		if rttStats := getRttStatistics(pingStats.rtts); rttStats != nil {
+			point.RttAvg = &rttStats.avg
+		}
+
+		// Retries and spool replays export a run again, and it's counted once
+		if history.hasPoint(point.Timestamp) {
+			continue
+		}
+
+		// Spooled batches are exported late, so their runs are put in place
+		history.Points = append(history.Points, point)
+		sort.SliceStable(history.Points, func(i, j int) bool {
+			return history.Points[i].Timestamp.Before(history.Points[j].Timestamp)
+		})
+
+		if len(history.Points) > spe.historySize {
+			history.Points = history.Points[len(history.Points)-spe.historySize:]
+		}
+	}
+
+	if spe.addresses == nil {
+		return
+	}
+
+	for address := range histories {
+		if !containsString(spe.addresses, address) {
+			delete(histories, address)
+		}
+	}
+}
+
+// hasPoint returns whether the history has a run that ended at the timestamp
+func (spth *statusPageTargetHistory) hasPoint(timestamp time.Time) bool {
+	for _, point := range spth.Points {
+		if point.Timestamp.Equal(timestamp) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getFeed returns the feed of the targets, grouped in the order the groups first appear in the addresses
+func (spe *statusPageExporter) getFeed(histories map[string]*statusPageTargetHistory, now time.Time) *statusPageFeed {
+	feed := &statusPageFeed{
+		Title:       spe.title,
+		GeneratedAt: now,
+		Status:      statusPageUnknown,
+		Groups:      make([]*statusPageGroup, 0),
+	}
+
+	addresses := make([]string, 0, len(histories))
+	if spe.addresses != nil {
+		addresses = append(addresses, spe.addresses...)
+	} else {
+		for address := range histories {
+			addresses = append(addresses, address)
+		}
+
+		sort.Strings(addresses)
+	}
+
+	groups := make(map[string]*statusPageGroup)
+
+	for _, address := range addresses {
+		history, ok := histories[address]
+		if !ok {
+			history = &statusPageTargetHistory{Group: spe.getConfiguredGroup(address), Status: statusPageUnknown}
+		}
+
+		target := &statusPageTarget{
+			Address: address,
+			Status:  history.Status,
+			Uptime:  getStatusPageUptime(history.Points),
+			History: history.Points,
+		}
+
+		if target.History == nil {
+			target.History = make([]*statusPagePoint, 0)
+		}
+
+		if len(history.Points) > 0 {
+			lastPoint := history.Points[len(history.Points)-1]
+			target.RttAvg = lastPoint.RttAvg
+			target.LastCheckedAt = &lastPoint.Timestamp
+		}
+
+		group, ok := groups[history.Group]
+		if !ok {
+			group = &statusPageGroup{Name: history.Group, Status: statusPageUnknown, Targets: make([]*statusPageTarget, 0)}
+			groups[history.Group] = group
+			feed.Groups = append(feed.Groups, group)
+		}
+
+		group.Targets = append(group.Targets, target)
+		group.Status = getWorseStatusPageStatus(group.Status, target.Status)
+		feed.Status = getWorseStatusPageStatus(feed.Status, target.Status)
+	}
+
+	for _, group := range feed.Groups {
+		group.History = getStatusPageGroupHistory(group.Targets)
+		group.Uptime = getStatusPageUptime(group.History)
+	}
+
+	return feed
+}
+
+// getConfiguredGroup returns the group of a target that has no runs yet, from its configured labels
+func (spe *statusPageExporter) getConfiguredGroup(address string) string {
+	if spe.lps == nil {
+		return defaultStatusPageGroup
+	}
+
+	if group := spe.lps.targetLabels[address][spe.groupLabel]; group != "" {
+		return group
+	}
+
+	return defaultStatusPageGroup
+}
+
+// getStatusPageGroupHistory rolls up the runs of the targets of a group. The daemon probes each target on its own
+// schedule, so the latest runs of the targets are aligned rather than their timestamps. A run of the group is in
+// maintenance only if the runs of all its targets are.
+func getStatusPageGroupHistory(targets []*statusPageTarget) []*statusPagePoint {
+	size := 0
+	for _, target := range targets {
+		if len(target.History) > size {
+			size = len(target.History)
+		}
+	}
+
+	points := make([]*statusPagePoint, size)
+	rttSums := make([]float64, size)
+	rttCounts := make([]int, size)
+
+	for index := range points {
+		points[index] = &statusPagePoint{Maintenance: true}
+	}
+
+	for _, target := range targets {
+		offset := size - len(target.History)
+
+		for index, targetPoint := range target.History {
+			point := points[offset+index]
+
+			if targetPoint.Timestamp.After(point.Timestamp) {
+				point.Timestamp = targetPoint.Timestamp
+			}
+
+			if targetPoint.RttAvg != nil {
+				rttSums[offset+index] += *targetPoint.RttAvg
+				rttCounts[offset+index]++
+			}
+
+			if targetPoint.Maintenance {
+				continue
+			}
+
+			point.Maintenance = false
+			point.Sent += targetPoint.Sent
+			point.Successful += targetPoint.Successful
+		}
+	}
+
+	for index, point := range points {
+		if rttCounts[index] > 0 {
+			rttAvg := rttSums[index] / float64(rttCounts[index])
+			point.RttAvg = &rttAvg
+		}
+	}
+
+	return points
+}
+
+// getStatusPageStatus returns the tracked state of the target, or the status of the run if states are not tracked
+func getStatusPageStatus(pingStats *pingStatistics) string {
+	switch {
+	case pingStats.maintenance:
+		return statusPageMaintenance
+	case pingStats.state != "":
+		return pingStats.state
+	case pingStats.successfulProbes == 0:
+		return targetStateDown
+	case pingStats.probesFailed > 0:
+		return targetStateDegraded
+	default:
+		return targetStateUp
+	}
+}
+
+func getWorseStatusPageStatus(status string, otherStatus string) string {
+	if statusPageRanks[otherStatus] > statusPageRanks[status] {
+		return otherStatus
+	}
+
+	return status
+}
+
+// getStatusPageUptime returns the percentage of successful probes of the runs out of maintenance, or nil if there are none
+func getStatusPageUptime(points []*statusPagePoint) *float64 {
+	sent := 0
+	successful := 0
+
+	for _, point := range points {
+		if point.Maintenance {
+			continue
+		}
+
+		sent += point.Sent
+		successful += point.Successful
+	}
+
+	if sent == 0 {
+		return nil
+	}
+
+	uptime := float64(successful) / float64(sent) * 100
+	return &uptime
+}
+
+// getSparklinePoints returns the SVG polyline points of the average RTTs of the runs, scaled to the sparkline
+func getSparklinePoints(points []*statusPagePoint) string {
+	minRtt := math.Inf(1)
+	maxRtt := math.Inf(-1)
+
+	for _, point := range points {
+		if point.RttAvg != nil {
+			minRtt = math.Min(minRtt, *point.RttAvg)
+			maxRtt = math.Max(maxRtt, *point.RttAvg)
+		}
+	}
+
+	coordinates := make([]string, 0, len(points))
+	step := float64(statusPageSparklineWidth)
+	if len(points) > 1 {
+		step = float64(statusPageSparklineWidth) / float64(len(points)-1)
+	}
+
+	for index, point := range points {
+		if point.RttAvg == nil {
+			continue
+		}
+
+		// A flat line is drawn in the middle
+		y := float64(statusPageSparklineHeight) / 2
+		if maxRtt > minRtt {
+			y = float64(statusPageSparklineHeight) - (*point.RttAvg-minRtt)/(maxRtt-minRtt)*float64(statusPageSparklineHeight)
+		}
+
+		coordinates = append(coordinates, strconv.FormatFloat(float64(index)*step, 'f', statusPageSparklinePrecision, 64)+","+
+			strconv.FormatFloat(y, 'f', statusPageSparklinePrecision, 64))
+	}
+
+	return strings.Join(coordinates, " ")
+}
+
+func getPointStatus(point *statusPagePoint) string {
+	switch {
+	case point.Maintenance:
+		return statusPageMaintenance
+	case point.Successful == 0:
+		return targetStateDown
+	case point.Successful < point.Sent:
+		return targetStateDegraded
+	default:
+		return targetStateUp
+	}
+}
+
+func formatStatusPageUptime(uptime *float64) string {
+	if uptime == nil {
+		return "-"
+	}
+
+	return strconv.FormatFloat(*uptime, 'f', statusPageUptimePrecision, 64) + "%"
+}
+
+func formatStatusPageRtt(rtt *float64) string {
+	if rtt == nil {
+		return "-"
+	}
+
+	return strconv.FormatFloat(*rtt, 'f', statusPageSparklinePrecision, 64) + " ms"
+}
+
+var statusPageTemplate = template.Must(template.New(statusPageHTMLName).Funcs(template.FuncMap{
+	"description":   func(status string) string { return statusPageDescriptions[status] },
+	"sparkline":     getSparklinePoints,
+	"pointStatus":   getPointStatus,
+	"uptime":        formatStatusPageUptime,
+	"rtt":           formatStatusPageRtt,
+	"formatTime":    func(timestamp time.Time) string { return timestamp.Format(statusPageFeedTimestampLayout) },
+	"sparkWidth":    func() int { return statusPageSparklineWidth },
+	"sparkHeight":   func() int { return statusPageSparklineHeight },
+	"hasSparkline":  func(points []*statusPagePoint) bool { return getSparklinePoints(points) != "" },
+	"pointTitle":    formatStatusPagePointTitle,
+	"lastCheckedAt": formatStatusPageLastCheckedAt,
+}).Parse(statusPageHTML))
+
+func formatStatusPagePointTitle(point *statusPagePoint) string {
+	return fmt.Sprintf("%s: %d/%d probes succeeded, %s", point.Timestamp.Format(statusPageFeedTimestampLayout), point.Successful, point.Sent, formatStatusPageRtt(point.RttAvg))
+}
+
+func formatStatusPageLastCheckedAt(lastCheckedAt *time.Time) string {
+	if lastCheckedAt == nil {
+		return "never"
+	}
+
+	return lastCheckedAt.Format(statusPageFeedTimestampLayout)
+}
+
+const statusPageHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0 auto; max-width: 960px; padding: 24px; color: #1f2933; }
+.banner { border-radius: 6px; padding: 16px; color: #fff; font-size: 20px; margin-bottom: 24px; }
+.status-up { background: #2f9e44; } .status-degraded { background: #f08c00; } .status-flapping { background: #e8590c; }
+.status-down { background: #e03131; } .status-unknown { background: #868e96; } .status-maintenance { background: #1c7ed6; }
+table { width: 100%; border-collapse: collapse; margin-bottom: 24px; }
+th, td { text-align: left; padding: 8px; border-bottom: 1px solid #e4e7eb; vertical-align: middle; }
+.dot { display: inline-block; width: 10px; height: 10px; border-radius: 50%; margin-right: 6px; }
+.bars { display: flex; gap: 1px; height: 20px; }
+.bars span { flex: 1; min-width: 2px; border-radius: 1px; }
+.group-history { display: flex; gap: 16px; align-items: center; margin-bottom: 8px; }
+.group-history .bars { flex: 1; }
+polyline { fill: none; stroke: #3b5bdb; stroke-width: 1.5; }
+footer { color: #7b8794; font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="banner status-{{.Status}}">{{description .Status}}</div>
+{{range .Groups}}
+<h2><span class="dot status-{{.Status}}"></span>{{.Name}} <small>{{uptime .Uptime}} uptime</small></h2>
+{{if .History}}<div class="group-history"><div class="bars">{{range .History}}<span class="status-{{pointStatus .}}" title="{{pointTitle .}}"></span>{{end}}</div>{{if hasSparkline .History}}<svg width="{{sparkWidth}}" height="{{sparkHeight}}" viewBox="0 0 {{sparkWidth}} {{sparkHeight}}" preserveAspectRatio="none"><polyline points="{{sparkline .History}}"/></svg>{{end}}</div>{{end}}
+<table>
+<tr><th>Target</th><th>Status</th><th>Uptime</th><th>Latency</th><th>Recent runs</th></tr>
+{{range .Targets}}
+<tr>
+<td>{{.Address}}</td>
+<td><span class="dot status-{{.Status}}"></span>{{description .Status}}</td>
+<td>{{uptime .Uptime}}</td>
+<td>{{rtt .RttAvg}}{{if hasSparkline .History}}<br><svg width="{{sparkWidth}}" height="{{sparkHeight}}" viewBox="0 0 {{sparkWidth}} {{sparkHeight}}" preserveAspectRatio="none"><polyline points="{{sparkline .History}}"/></svg>{{end}}</td>
+<td><div class="bars">{{range .History}}<span class="status-{{pointStatus .}}" title="{{pointTitle .}}"></span>{{end}}</div><small>Last checked {{lastCheckedAt .LastCheckedAt}}</small></td>
+</tr>
+{{end}}
+</table>
+{{end}}
+<footer>Generated at {{formatTime .GeneratedAt}}. Also available as <a href="` + statusPageJSONName + `">JSON</a>.</footer>
+</body>
+</html>
+`
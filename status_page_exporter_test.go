@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStatusPageExporter(t *testing.T, lps *logzioPingStatistics) *statusPageExporter {
+	envs := map[string]string{
+		statusPageOutputEnvName:  filepath.Join(t.TempDir(), "status"),
+		statusPageTitleEnvName:   "Partner status",
+		statusPageHistoryEnvName: "2",
+		stateDirEnvName:          t.TempDir(),
+	}
+
+	if lps != nil {
+		envs[addressesEnvName] = strings.Join(lps.addresses, ",")
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+
+	defer os.Clearenv()
+
+	exp, err := newStatusPageExporter(lps)
+	require.NoError(t, err)
+
+	return exp.(*statusPageExporter)
+}
+
+// shiftTestProbes moves the probes in time, so the results are of another run
+func shiftTestProbes(pingsStats []*pingStatistics, shift time.Duration) {
+	for _, pingStats := range pingsStats {
+		for _, probe := range pingStats.probes {
+			probe.timestamp = probe.timestamp.Add(shift)
+		}
+	}
+}
+
+func readStatusFeed(t *testing.T, exp *statusPageExporter) *statusPageFeed {
+	data, err := os.ReadFile(filepath.Join(exp.writer.(*dirObjectWriter).dir, statusPageJSONName))
+	require.NoError(t, err)
+
+	feed := &statusPageFeed{}
+	require.NoError(t, json.Unmarshal(data, feed))
+
+	return feed
+}
+
+func TestNewStatusPageExporter_NoOutput(t *testing.T) {
+	_, err := newStatusPageExporter(nil)
+	assert.Error(t, err)
+}
+
+func TestStatusPageExporter_Export(t *testing.T) {
+	lps := &logzioPingStatistics{
+		addresses:    []string{"www.google.com:80", "listener.logz.io:8053", "api.logz.io:443"},
+		targetLabels: map[string]map[string]string{"api.logz.io:443": {"group": "API"}},
+	}
+
+	exp := newTestStatusPageExporter(t, lps)
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()))
+
+	feed := readStatusFeed(t, exp)
+	assert.Equal(t, "Partner status", feed.Title)
+	assert.Equal(t, targetStateDown, feed.Status)
+	require.Len(t, feed.Groups, 2)
+
+	services := feed.Groups[0]
+	assert.Equal(t, defaultStatusPageGroup, services.Name)
+	assert.Equal(t, targetStateDown, services.Status)
+	assert.InDelta(t, 100.0/3, *services.Uptime, 0.001)
+	require.Len(t, services.History, 1)
+	assert.Equal(t, 6, services.History[0].Sent)
+	assert.Equal(t, 11.375, *services.History[0].RttAvg)
+	require.Len(t, services.Targets, 2)
+
+	google := services.Targets[0]
+	assert.Equal(t, "www.google.com:80", google.Address)
+	assert.Equal(t, targetStateDegraded, google.Status)
+	assert.InDelta(t, 200.0/3, *google.Uptime, 0.001)
+	assert.Equal(t, 11.375, *google.RttAvg)
+	assert.Equal(t, testProbesTimestamp.Add(2*time.Second), *google.LastCheckedAt)
+	require.Len(t, google.History, 1)
+
+	listener := services.Targets[1]
+	assert.Equal(t, targetStateDown, listener.Status)
+	assert.Nil(t, listener.RttAvg)
+
+	api := feed.Groups[1]
+	assert.Equal(t, "API", api.Name)
+	assert.Equal(t, statusPageUnknown, api.Status)
+	assert.Nil(t, api.Uptime)
+	assert.Empty(t, api.History)
+	assert.Empty(t, api.Targets[0].History)
+
+	page, err := os.ReadFile(filepath.Join(exp.writer.(*dirObjectWriter).dir, statusPageHTMLName))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "<title>Partner status</title>")
+	assert.Contains(t, string(page), "www.google.com:80")
+	assert.Contains(t, string(page), statusPageDescriptions[targetStateDown])
+
+	// The history is kept between runs, up to its size, and the tracked state of a target is its status
+	pingsStats := getTestPingsStats()
+	pingsStats[1].state = targetStateFlapping
+
+	shiftTestProbes(pingsStats, time.Minute)
+	require.NoError(t, exp.export(context.Background(), pingsStats))
+	shiftTestProbes(pingsStats, time.Minute)
+	require.NoError(t, exp.export(context.Background(), pingsStats))
+
+	feed = readStatusFeed(t, exp)
+	assert.Len(t, feed.Groups[0].Targets[0].History, 2)
+	assert.Equal(t, targetStateFlapping, feed.Groups[0].Targets[1].Status)
+
+	// Targets that are no longer configured are dropped
+	exp.addresses = exp.addresses[:1]
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()[:1]))
+
+	feed = readStatusFeed(t, exp)
+	require.Len(t, feed.Groups, 1)
+	assert.Len(t, feed.Groups[0].Targets, 1)
+	assert.Equal(t, targetStateDegraded, feed.Status)
+}
+
+func TestStatusPageExporter_OverrideRunKeepsOtherTargets(t *testing.T) {
+	lps := &logzioPingStatistics{addresses: []string{"www.google.com:80", "listener.logz.io:8053"}}
+
+	exp := newTestStatusPageExporter(t, lps)
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()))
+
+	// An override run probes only some of the configured targets
+	lps.addresses = lps.addresses[1:]
+	pingsStats := getTestPingsStats()[1:]
+	shiftTestProbes(pingsStats, time.Minute)
+	require.NoError(t, exp.export(context.Background(), pingsStats))
+
+	feed := readStatusFeed(t, exp)
+	require.Len(t, feed.Groups, 1)
+	require.Len(t, feed.Groups[0].Targets, 2)
+
+	google := feed.Groups[0].Targets[0]
+	assert.Equal(t, "www.google.com:80", google.Address)
+	assert.Len(t, google.History, 1)
+	assert.InDelta(t, 200.0/3, *google.Uptime, 0.001)
+	assert.Len(t, feed.Groups[0].Targets[1].History, 2)
+}
+
+func TestStatusPageExporter_ExportAgainAddsRunOnce(t *testing.T) {
+	exp := newTestStatusPageExporter(t, &logzioPingStatistics{addresses: []string{"www.google.com:80", "listener.logz.io:8053"}})
+
+	// A retry or a spool replay exports the same run again
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()))
+	require.NoError(t, exp.export(context.Background(), getTestPingsStats()))
+
+	feed := readStatusFeed(t, exp)
+	assert.Len(t, feed.Groups[0].Targets[0].History, 1)
+	assert.Len(t, feed.Groups[0].History, 1)
+	assert.InDelta(t, 200.0/3, *feed.Groups[0].Targets[0].Uptime, 0.001)
+}
+
+func TestStatusPageExporter_LoadErrorKeepsHistory(t *testing.T) {
+	exp := newTestStatusPageExporter(t, &logzioPingStatistics{addresses: []string{"www.google.com:80", "listener.logz.io:8053"}})
+
+	historyPath := filepath.Join(exp.store.(*fileStateStore).dir, statusPageStateKey+stateFileSuffix)
+	require.NoError(t, os.WriteFile(historyPath, []byte("{not json"), 0644))
+
+	assert.Error(t, exp.export(context.Background(), getTestPingsStats()))
+
+	data, err := os.ReadFile(historyPath)
+	require.NoError(t, err)
+	assert.Equal(t, "{not json", string(data))
+}
+
+func TestGetStatusPageGroupHistory(t *testing.T) {
+	rtt := func(value float64) *float64 {
+		return &value
+	}
+
+	history := getStatusPageGroupHistory([]*statusPageTarget{
+		{History: []*statusPagePoint{
+			{Timestamp: testProbesTimestamp, Sent: 3, Successful: 3, RttAvg: rtt(10)},
+			{Timestamp: testProbesTimestamp.Add(time.Minute), Sent: 3, Successful: 0, Maintenance: true},
+		}},
+		{History: []*statusPagePoint{
+			{Timestamp: testProbesTimestamp.Add(time.Second), Sent: 3, Successful: 1, RttAvg: rtt(30)},
+		}},
+		{History: []*statusPagePoint{}},
+	})
+
+	// The latest runs of the targets are aligned
+	require.Len(t, history, 2)
+	assert.Equal(t, &statusPagePoint{Timestamp: testProbesTimestamp, Sent: 3, Successful: 3, RttAvg: rtt(10)}, history[0])
+	assert.Equal(t, &statusPagePoint{Timestamp: testProbesTimestamp.Add(time.Minute), Sent: 3, Successful: 1, RttAvg: rtt(30)}, history[1])
+	assert.Equal(t, targetStateDegraded, getPointStatus(history[1]))
+}
+
+func TestGetSparklinePoints(t *testing.T) {
+	rtt := func(value float64) *float64 {
+		return &value
+	}
+
+	assert.Equal(t, "", getSparklinePoints(nil))
+	assert.Equal(t, "0.0,14.0", getSparklinePoints([]*statusPagePoint{{RttAvg: rtt(10)}}))
+	assert.Equal(t, "0.0,28.0 120.0,0.0 180.0,14.0",
+		getSparklinePoints([]*statusPagePoint{{RttAvg: rtt(10)}, {}, {RttAvg: rtt(30)}, {RttAvg: rtt(20)}}))
+}
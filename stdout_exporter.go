@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type stdoutExporter struct {
+	writer         io.Writer
+	resourceLabels map[string]string
+}
+
+func newStdoutExporter(_ *logzioPingStatistics) (exporter, error) {
+	return &stdoutExporter{
+		writer:         os.Stdout,
+		resourceLabels: getResourceLabels(),
+	}, nil
+}
+
+func (se *stdoutExporter) name() string {
+	return stdoutExporterName
+}
+
+func (se *stdoutExporter) export(_ context.Context, pingsStats []*pingStatistics) error {
+	for _, point := range getMetricPoints(pingsStats) {
+		if _, err := fmt.Fprintln(se.writer, formatMetricPoint(point, se.resourceLabels)); err != nil {
+			return fmt.Errorf("error writing metric %s: %v", point.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (se *stdoutExporter) shutdown(_ context.Context) error {
+	return nil
+}
+
+// formatMetricPoint formats a metric point as a line of the Prometheus text exposition format
+func formatMetricPoint(point *metricPoint, extraLabels map[string]string) string {
+	labels := mergeLabels(extraLabels, point.labels)
+	labelPairs := make([]string, 0, len(labels))
+
+	for _, labelName := range getSortedLabelNames(labels) {
+		labelPairs = append(labelPairs, labelName+"="+escapeLabelValue(labels[labelName]))
+	}
+
+	return point.name + "{" + strings.Join(labelPairs, ",") + "} " + strconv.FormatFloat(point.value, 'g', -1, 64)
+}
+
+func escapeLabelValue(labelValue string) string {
+	labelValue = strings.ReplaceAll(labelValue, `\`, `\\`)
+	labelValue = strings.ReplaceAll(labelValue, "\n", `\n`)
+	labelValue = strings.ReplaceAll(labelValue, `"`, `\"`)
+
+	return `"` + labelValue + `"`
+}
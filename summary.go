@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// runSummary is what the Lambda function returns for a run, so the automation that invokes it
+// synchronously can act on the results
+type runSummary struct {
+	RunID   string           `json:"run_id"`
+	Success bool             `json:"success"`
+	Targets []*targetSummary `json:"targets"`
+	Exports []*exportStatus  `json:"exports"`
+}
+
+type targetSummary struct {
+	Address        string          `json:"address"`
+	Sent           int             `json:"sent"`
+	Successful     int             `json:"successful"`
+	Failed         int             `json:"failed"`
+	Truncated      bool            `json:"truncated"`
+	Rtt            *pingSummaryRtt `json:"rtt,omitempty"`
+	FailureReasons map[string]int  `json:"failure_reasons,omitempty"`
+	State          string          `json:"state,omitempty"`
+	Maintenance    bool            `json:"maintenance,omitempty"`
+}
+
+func (rs *runSummary) String() string {
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return fmt.Sprintf("error marshaling run summary: %v", err)
+	}
+
+	return string(data)
+}
+
+// getExporterNames returns the names of the exporters the run was exported with
+func (rs *runSummary) getExporterNames() []string {
+	names := make([]string, 0, len(rs.Exports))
+	for _, status := range rs.Exports {
+		if !containsString(names, status.Exporter) {
+			names = append(names, status.Exporter)
+		}
+	}
+
+	return names
+}
+
+// exportStatus is the outcome of exporting a batch with one exporter, after its retries
+type exportStatus struct {
+	Exporter string `json:"exporter"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+// getRunSummary summarizes the run. The run is successful if every address out of maintenance accepted at least one connection
+// and every export succeeded, like the exit code of the ping command.
+func getRunSummary(runID string, pingsStats []*pingStatistics, exportStatuses []*exportStatus) *runSummary {
+	summary := &runSummary{
+		RunID:   runID,
+		Success: true,
+		Targets: make([]*targetSummary, 0, len(pingsStats)),
+		Exports: exportStatuses,
+	}
+
+	if summary.Exports == nil {
+		summary.Exports = make([]*exportStatus, 0)
+	}
+
+	for _, pingStats := range pingsStats {
+		target := &targetSummary{
+			Address:     pingStats.address,
+			Sent:        pingStats.probesSent,
+			Successful:  pingStats.successfulProbes,
+			Failed:      pingStats.probesFailed,
+			Truncated:   pingStats.truncated,
+			State:       pingStats.state,
+			Maintenance: pingStats.maintenance,
+		}
+
+		if rttStats := getRttStatistics(pingStats.rtts); rttStats != nil {
+			target.Rtt = &pingSummaryRtt{Min: rttStats.min, Avg: rttStats.avg, Max: rttStats.max, Mdev: rttStats.mdev}
+		}
+
+		for _, probe := range pingStats.probes {
+			if probe.err == nil {
+				continue
+			}
+
+			if target.FailureReasons == nil {
+				target.FailureReasons = make(map[string]int)
+			}
+
+			target.FailureReasons[probe.errorReason]++
+		}
+
+		if pingStats.successfulProbes == 0 && !pingStats.maintenance {
+			summary.Success = false
+		}
+
+		summary.Targets = append(summary.Targets, target)
+	}
+
+	for _, status := range summary.Exports {
+		if !status.Success {
+			summary.Success = false
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRunSummary_Success(t *testing.T) {
+	pingsStats := getTestPingsStats()
+	pingsStats[1].truncated = true
+
+	summary := getRunSummary("run-id", pingsStats, []*exportStatus{{Exporter: "probes", Success: true}})
+
+	assert.Equal(t, "run-id", summary.RunID)
+	assert.False(t, summary.Success)
+	require.Len(t, summary.Targets, 2)
+
+	assert.Equal(t, &targetSummary{
+		Address:        "www.google.com:80",
+		Sent:           3,
+		Successful:     2,
+		Failed:         1,
+		Rtt:            &pingSummaryRtt{Min: 10.5, Avg: 11.375, Max: 12.25, Mdev: 0.875},
+		FailureReasons: map[string]int{probeErrorReasonConnectionRefused: 1},
+	}, summary.Targets[0])
+
+	assert.Equal(t, &targetSummary{
+		Address:        "listener.logz.io:8053",
+		Sent:           3,
+		Failed:         3,
+		Truncated:      true,
+		FailureReasons: map[string]int{probeErrorReasonTimeout: 3},
+	}, summary.Targets[1])
+}
+
+func TestGetRunSummary_FailedExport(t *testing.T) {
+	pingsStats := getTestPingsStats()[:1]
+
+	summary := getRunSummary("run-id", pingsStats, []*exportStatus{{Exporter: "probes", Success: true}})
+	assert.True(t, summary.Success)
+
+	summary = getRunSummary("run-id", pingsStats, []*exportStatus{
+		{Exporter: "probes", Success: true},
+		{Exporter: "logzio", Error: "500 Internal Server Error"},
+	})
+	assert.False(t, summary.Success)
+
+	output, err := json.Marshal(summary)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `{"exporter":"logzio","success":false,"error":"500 Internal Server Error"}`)
+}
+
+func TestRunCycle_SummaryOnFailedExport(t *testing.T) {
+	testExp := &testExporter{errs: []error{errors.New("permanent failure")}}
+	logzioPingStats := &logzioPingStatistics{
+		ctx:         context.Background(),
+		addresses:   []string{"127.0.0.1:1"},
+		pingCount:   1,
+		pingTimeout: time.Second,
+		exporters:   []exporter{testExp},
+		delivery:    &deliveryConfig{},
+	}
+
+	summary, err := logzioPingStats.runCycle()
+	require.Error(t, err)
+	require.NotNil(t, summary)
+
+	assert.False(t, summary.Success)
+	require.Len(t, summary.Exports, 1)
+	assert.Equal(t, "permanent failure", summary.Exports[0].Error)
+	assert.Equal(t, map[string]int{probeErrorReasonConnectionRefused: 1}, summary.Targets[0].FailureReasons)
+}
+
+func TestHandleRequest_FailedExport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	envs := map[string]string{
+		addressesEnvName:      "127.0.0.1:1",
+		pingCountEnvName:      "1",
+		pingIntervalEnvName:   "1",
+		pingTimeoutEnvName:    "1",
+		exportersEnvName:      influxdbExporterName,
+		influxdbURLEnvName:    server.URL,
+		influxdbOrgEnvName:    "org",
+		influxdbBucketEnvName: "bucket",
+		influxdbTokenEnvName:  "token",
+		disableSpoolEnvName:   "true",
+	}
+
+	for envName, envValue := range envs {
+		require.NoError(t, os.Setenv(envName, envValue))
+	}
+
+	defer os.Clearenv()
+
+	// The invocation fails, with the summary in its error
+	summary, err := HandleRequest(context.Background(), nil)
+	require.Error(t, err)
+	require.NotNil(t, summary)
+	assert.False(t, summary.Success)
+	assert.Contains(t, err.Error(), `"exporter":"influxdb","success":false`)
+	assert.Equal(t, []string{influxdbExporterName}, summary.getExporterNames())
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+)
+
+// targetSelector selects targets by address and by labels. An empty selector selects every target.
+type targetSelector struct {
+	Addresses []string          `json:"addresses,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// normalize writes the selector addresses the same way as ADDRESSES and checks they are probed
+func (ts *targetSelector) normalize(addresses []string) error {
+	for index, address := range ts.Addresses {
+		normalizedAddress := getAddresses(address)[0]
+
+		if !containsString(addresses, normalizedAddress) {
+			return fmt.Errorf("address is not in %s: %s", addressesEnvName, address)
+		}
+
+		ts.Addresses[index] = normalizedAddress
+	}
+
+	return nil
+}
+
+// matches returns whether the target is one of the selector addresses and has all the selector labels
+func (ts *targetSelector) matches(address string, labels map[string]string) bool {
+	if ts == nil {
+		return true
+	}
+
+	if len(ts.Addresses) > 0 && !containsString(ts.Addresses, address) {
+		return false
+	}
+
+	for labelName, labelValue := range ts.Labels {
+		if value, ok := labels[labelName]; !ok || value != labelValue {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ts *targetSelector) filter(pingsStats []*pingStatistics) []*pingStatistics {
+	filteredPingsStats := make([]*pingStatistics, 0, len(pingsStats))
+
+	for _, pingStats := range pingsStats {
+		if ts.matches(pingStats.address, pingStats.labels) {
+			filteredPingsStats = append(filteredPingsStats, pingStats)
+		}
+	}
+
+	return filteredPingsStats
+}
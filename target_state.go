@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	trackTargetStateEnvName       = "TRACK_TARGET_STATE"
+	stateFailureThresholdEnvName  = "STATE_FAILURE_THRESHOLD"
+	stateRecoveryThresholdEnvName = "STATE_RECOVERY_THRESHOLD"
+	stateFlapThresholdEnvName     = "STATE_FLAP_THRESHOLD"
+	stateFlapWindowEnvName        = "STATE_FLAP_WINDOW"
+	defaultStateFailureThreshold  = 3
+	defaultStateRecoveryThreshold = 2
+	defaultStateFlapThreshold     = 4
+	defaultStateFlapWindow        = 10
+	targetStatesKey               = "target_states"
+	stateMetricName               = meterName + "_state"
+	targetStateUp                 = "up"
+	targetStateDegraded           = "degraded"
+	targetStateDown               = "down"
+	targetStateFlapping           = "flapping"
+)
+
+// targetStateValues are the values of the ping_stats_state gauge
+var targetStateValues = map[string]float64{
+	targetStateDown:     0,
+	targetStateUp:       1,
+	targetStateDegraded: 2,
+	targetStateFlapping: 3,
+}
+
+// targetState is the state of a target across runs
+type targetState struct {
+	State                string    `json:"state"`
+	Since                time.Time `json:"since"`
+	ConsecutiveFailures  int       `json:"consecutive_failures"`
+	ConsecutiveSuccesses int       `json:"consecutive_successes"`
+	// BaseState is the state before flap detection
+	BaseState string `json:"base_state"`
+	// History holds whether the target was reachable in each of the last runs, oldest first
+	History []bool `json:"history"`
+}
+
+// stateTransition is emitted when a target moves from one state to another
+type stateTransition struct {
+	Address   string            `json:"address"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Since     time.Time         `json:"since"`
+	ChangedAt time.Time         `json:"changed_at"`
+	RunID     string            `json:"run_id,omitempty"`
+}
+
+// stateTracker moves each target between the up, degraded, down and flapping states, so a single failed run
+// is not an outage and a target that keeps bouncing is reported once as flapping
+type stateTracker struct {
+	failureThreshold  int
+	recoveryThreshold int
+	flapThreshold     int
+	flapWindow        int
+	store             stateStore
+	lock              sync.Mutex
+}
+
+// newStateTracker returns the state tracker, or nil if TRACK_TARGET_STATE is not set
+func newStateTracker() (*stateTracker, error) {
+	trackTargetState, err := getBoolEnvValue(os.Getenv(trackTargetStateEnvName), trackTargetStateEnvName)
+	if err != nil || !trackTargetState {
+		return nil, err
+	}
+
+	tracker := &stateTracker{
+		failureThreshold:  defaultStateFailureThreshold,
+		recoveryThreshold: defaultStateRecoveryThreshold,
+		flapThreshold:     defaultStateFlapThreshold,
+		flapWindow:        defaultStateFlapWindow,
+	}
+
+	thresholds := map[string]*int{
+		stateFailureThresholdEnvName:  &tracker.failureThreshold,
+		stateRecoveryThresholdEnvName: &tracker.recoveryThreshold,
+		stateFlapThresholdEnvName:     &tracker.flapThreshold,
+		stateFlapWindowEnvName:        &tracker.flapWindow,
+	}
+
+	for envName, threshold := range thresholds {
+		envValue := os.Getenv(envName)
+		if envValue == "" {
+			continue
+		}
+
+		value, err := getNumberEnvValue(envValue, envName)
+		if err != nil {
+			return nil, err
+		}
+
+		*threshold = *value
+	}
+
+	if tracker.flapThreshold >= tracker.flapWindow {
+		return nil, fmt.Errorf("%s must be lower than %s", stateFlapThresholdEnvName, stateFlapWindowEnvName)
+	}
+
+	if tracker.store, err = newStateStore(); err != nil {
+		return nil, err
+	}
+
+	return tracker, nil
+}
+
+// track sets the state of each target from the results of the run and returns the transitions.
+// Targets without probes in this run, or in maintenance, keep their state.
+func (st *stateTracker) track(ctx context.Context, pingsStats []*pingStatistics) []*stateTransition {
+	// The daemon tracks each target as its probes are done, and the states are stored together
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	states := make(map[string]*targetState)
+	if _, err := st.store.load(ctx, targetStatesKey, &states); err != nil {
+		errorLogger.Println("Error loading the target states, starting over:", err)
+	}
+
+	transitions := make([]*stateTransition, 0)
+
+	for _, pingStats := range pingsStats {
+		if pingStats.probesSent == 0 {
+			continue
+		}
+
+		state, ok := states[pingStats.address]
+		if !ok {
+			state = &targetState{}
+			states[pingStats.address] = state
+		}
+
+		// The state is kept as is during maintenance
+		if pingStats.maintenance {
+			pingStats.state = state.State
+			continue
+		}
+
+		now := time.Now().UTC()
+		previousState := state.State
+		previousSince := state.Since
+
+		st.update(state, pingStats)
+		pingStats.state = state.State
+
+		if state.State == previousState {
+			continue
+		}
+
+		state.Since = now
+
+		// The first run of a target only sets its initial state
+		if previousState == "" {
+			continue
+		}
+
+		pingStats.stateTransition = &stateTransition{
+			Address:   pingStats.address,
+			Labels:    pingStats.labels,
+			From:      previousState,
+			To:        state.State,
+			Since:     previousSince,
+			ChangedAt: now,
+			RunID:     pingStats.runID,
+		}
+
+		transitions = append(transitions, pingStats.stateTransition)
+	}
+
+	if err := st.store.save(ctx, targetStatesKey, states); err != nil {
+		errorLogger.Println("Error saving the target states:", err)
+	}
+
+	for _, transition := range transitions {
+		transitionJSON, _ := json.Marshal(transition)
+		infoLogger.Println("State transition:", string(transitionJSON))
+	}
+
+	return transitions
+}
+
+// update moves the state with the outcome of a run. A run without successful probes is a failure,
+// and a run with some failed probes leaves an up target degraded.
+func (st *stateTracker) update(state *targetState, pingStats *pingStatistics) {
+	lastState := state.BaseState
+	nextState := targetStateUp
+
+	if pingStats.successfulProbes == 0 {
+		state.ConsecutiveFailures++
+		state.ConsecutiveSuccesses = 0
+
+		if state.ConsecutiveFailures < st.failureThreshold && lastState != targetStateDown {
+			nextState = targetStateDegraded
+		} else {
+			nextState = targetStateDown
+		}
+	} else {
+		state.ConsecutiveSuccesses++
+		state.ConsecutiveFailures = 0
+
+		if lastState == targetStateDown && state.ConsecutiveSuccesses < st.recoveryThreshold {
+			nextState = targetStateDown
+		} else if pingStats.probesFailed > 0 {
+			nextState = targetStateDegraded
+		}
+	}
+
+	state.History = append(state.History, pingStats.successfulProbes > 0)
+	if len(state.History) > st.flapWindow {
+		state.History = state.History[len(state.History)-st.flapWindow:]
+	}
+
+	state.BaseState = nextState
+	state.State = nextState
+
+	// A target that keeps changing between reachable and unreachable is flapping, whatever its base state
+	if getReachabilityChanges(state.History) >= st.flapThreshold {
+		state.State = targetStateFlapping
+	}
+}
+
+func getReachabilityChanges(history []bool) int {
+	changes := 0
+
+	for index := 1; index < len(history); index++ {
+		if history[index] != history[index-1] {
+			changes++
+		}
+	}
+
+	return changes
+}
+
+// getStateMetricPoint returns the ping_stats_state gauge of the target, or nil if its state is not tracked
+func (ps *pingStatistics) getStateMetricPoint() *metricPoint {
+	if ps.state == "" {
+		return nil
+	}
+
+	return &metricPoint{
+		name:   stateMetricName,
+		labels: ps.getLabels(),
+		value:  targetStateValues[ps.state],
+	}
+}
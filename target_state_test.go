@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStateTracker(t *testing.T, stateDir string) *stateTracker {
+	store, err := newFileStateStore(stateDir)
+	require.NoError(t, err)
+
+	return &stateTracker{
+		failureThreshold:  defaultStateFailureThreshold,
+		recoveryThreshold: defaultStateRecoveryThreshold,
+		flapThreshold:     defaultStateFlapThreshold,
+		flapWindow:        defaultStateFlapWindow,
+		store:             store,
+	}
+}
+
+// trackRun tracks a run of www.google.com:80 with the probe counts, and returns its state and transition
+func trackRun(tracker *stateTracker, successfulProbes int, probesFailed int) (string, *stateTransition) {
+	pingStats := &pingStatistics{
+		address:          "www.google.com:80",
+		probesSent:       successfulProbes + probesFailed,
+		successfulProbes: successfulProbes,
+		probesFailed:     probesFailed,
+	}
+
+	tracker.track(context.Background(), []*pingStatistics{pingStats})
+
+	return pingStats.state, pingStats.stateTransition
+}
+
+func TestNewStateTracker(t *testing.T) {
+	defer os.Clearenv()
+
+	tracker, err := newStateTracker()
+	require.NoError(t, err)
+	assert.Nil(t, tracker)
+
+	require.NoError(t, os.Setenv(stateDirEnvName, t.TempDir()))
+	require.NoError(t, os.Setenv(trackTargetStateEnvName, "true"))
+	require.NoError(t, os.Setenv(stateFailureThresholdEnvName, "5"))
+
+	tracker, err = newStateTracker()
+	require.NoError(t, err)
+	require.NotNil(t, tracker)
+	assert.Equal(t, 5, tracker.failureThreshold)
+	assert.Equal(t, defaultStateRecoveryThreshold, tracker.recoveryThreshold)
+
+	require.NoError(t, os.Setenv(stateFlapThresholdEnvName, "10"))
+
+	_, err = newStateTracker()
+	assert.Error(t, err)
+
+	require.NoError(t, os.Setenv(stateRecoveryThresholdEnvName, "0"))
+
+	_, err = newStateTracker()
+	assert.Error(t, err)
+}
+
+func TestStateTracker_DownAndRecovery(t *testing.T) {
+	tracker := newTestStateTracker(t, t.TempDir())
+
+	state, transition := trackRun(tracker, 3, 0)
+	assert.Equal(t, targetStateUp, state)
+	assert.Nil(t, transition)
+
+	// A single failed run is not an outage
+	state, transition = trackRun(tracker, 0, 3)
+	assert.Equal(t, targetStateDegraded, state)
+	require.NotNil(t, transition)
+	assert.Equal(t, targetStateUp, transition.From)
+	assert.Equal(t, targetStateDegraded, transition.To)
+
+	state, _ = trackRun(tracker, 0, 3)
+	assert.Equal(t, targetStateDegraded, state)
+
+	state, transition = trackRun(tracker, 0, 3)
+	assert.Equal(t, targetStateDown, state)
+	require.NotNil(t, transition)
+	assert.Equal(t, targetStateDown, transition.To)
+
+	// A down target stays down until it succeeds in enough consecutive runs
+	state, transition = trackRun(tracker, 3, 0)
+	assert.Equal(t, targetStateDown, state)
+	assert.Nil(t, transition)
+
+	state, transition = trackRun(tracker, 3, 0)
+	assert.Equal(t, targetStateUp, state)
+	require.NotNil(t, transition)
+	assert.Equal(t, targetStateDown, transition.From)
+
+	state, _ = trackRun(tracker, 2, 1)
+	assert.Equal(t, targetStateDegraded, state)
+}
+
+func TestStateTracker_Flapping(t *testing.T) {
+	tracker := newTestStateTracker(t, t.TempDir())
+	tracker.failureThreshold = 1
+	tracker.recoveryThreshold = 1
+
+	states := make([]string, 0)
+	transitions := 0
+
+	for run := 0; run < 8; run++ {
+		state, transition := trackRun(tracker, 3*(run%2), 3*((run+1)%2))
+		states = append(states, state)
+
+		if transition != nil {
+			transitions++
+		}
+	}
+
+	assert.Equal(t, []string{targetStateDown, targetStateUp, targetStateDown, targetStateUp, targetStateFlapping, targetStateFlapping, targetStateFlapping, targetStateFlapping}, states)
+	assert.Equal(t, 4, transitions)
+
+	// The target settles once the changes in the flap window drop below the threshold
+	for run := 0; run < defaultStateFlapWindow; run++ {
+		trackRun(tracker, 3, 0)
+	}
+
+	state, _ := trackRun(tracker, 3, 0)
+	assert.Equal(t, targetStateUp, state)
+}
+
+func TestStateTracker_Persisted(t *testing.T) {
+	stateDir := t.TempDir()
+
+	tracker := newTestStateTracker(t, stateDir)
+	trackRun(tracker, 3, 0)
+	trackRun(tracker, 0, 3)
+	trackRun(tracker, 0, 3)
+
+	// A new tracker, like the next Lambda invocation, continues the count of consecutive failures
+	tracker = newTestStateTracker(t, stateDir)
+	state, transition := trackRun(tracker, 0, 3)
+	assert.Equal(t, targetStateDown, state)
+	require.NotNil(t, transition)
+	assert.Equal(t, targetStateDegraded, transition.From)
+	assert.False(t, transition.Since.IsZero())
+}
+
+func TestGetMetricPoints_State(t *testing.T) {
+	pingsStats := getTestPingsStats()
+	assert.NotContains(t, getMetricNames(getMetricPoints(pingsStats)), stateMetricName)
+
+	pingsStats[0].state = targetStateDegraded
+	metricPoints := getMetricPoints(pingsStats)
+
+	statePoints := make([]*metricPoint, 0)
+	for _, point := range metricPoints {
+		if point.name == stateMetricName {
+			statePoints = append(statePoints, point)
+		}
+	}
+
+	require.Len(t, statePoints, 1)
+	assert.Equal(t, float64(2), statePoints[0].value)
+	assert.Equal(t, pingsStats[0].address, statePoints[0].labels[addressLabelName])
+}